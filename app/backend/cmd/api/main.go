@@ -4,13 +4,19 @@ import (
 	"context"
 	"log"
 	"os"
+	"time"
 
 	_ "slackgo/docs"
 	"slackgo/internal/config"
 	"slackgo/internal/db"
+	"slackgo/internal/events"
 	httpapi "slackgo/internal/http"
 	"slackgo/internal/http/handlers"
 	"slackgo/internal/http/middleware"
+	"slackgo/internal/identity"
+	"slackgo/internal/jobs"
+	"slackgo/internal/ratelimit"
+	"slackgo/internal/scan"
 	"slackgo/internal/storage"
 	"slackgo/internal/ws"
 
@@ -32,35 +38,68 @@ func main() {
 		log.Fatal(err)
 	}
 
-	// S3 依存初期化
-	s3deps, err := storage.NewS3Deps(context.Background(), cfg)
+	// ストレージ初期化（STORAGE_DRIVER: s3 | local）
+	store, err := storage.New(context.Background(), cfg)
 	if err != nil {
-		log.Fatalf("init s3 deps failed: %v", err)
+		log.Fatalf("init storage failed: %v", err)
 	}
-	if s3deps.Bucket == "" {
-		log.Fatal("S3_BUCKET が未設定です")
+
+	// アップロードのウイルススキャン（SCAN_DRIVER: none | clamd）
+	scanner, err := scan.New(cfg)
+	if err != nil {
+		log.Fatalf("init scanner failed: %v", err)
 	}
 
 	// Handlers
-	authH := handlers.NewAuthHandler(gdb) // ← 変数名を authH に
 	hub := ws.NewHub()
-	msgH := handlers.NewMessagesHandler(gdb, hub)
-	chH := handlers.NewChannelsHandler(gdb)
-	wsH := handlers.NewWorkspacesHandler(gdb)
+	// 外部 URL（イベント配信・スラッシュコマンド・bot の interaction）へ送るクライアント
+	outbound := events.NewHTTPClient(cfg.OutboundAllowPrivate)
+	avatars, err := handlers.NewAvatarURLs(cfg.AvatarURLSecret, cfg.APIPublicURL, cfg.AvatarURLTTL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	msgH := handlers.NewMessagesHandler(gdb, hub, avatars)
+	chH := handlers.NewChannelsHandler(gdb, hub)
+	wsH := handlers.NewWorkspacesHandler(gdb, cfg.WorkspacePurgeGrace)
+	hookLimiter := ratelimit.New(cfg.WebhookRatePerMin, cfg.WebhookRateBurst)
+	whH := handlers.NewWebhooksHandler(gdb, msgH, hookLimiter, cfg.APIPublicURL)
+	cmdH := handlers.NewCommandsHandler(gdb, hub, msgH, chH, outbound)
+	filesH := handlers.NewFilesHandler(gdb, store, hub, storage.NewUploadPolicy(cfg))
 
 	// WebSocket でも使う共通JWT Verifier
-	verifier, err := authpkg.NewVerifier(context.Background(), authpkg.Config{
-		Domain:   cfg.Auth0Domain,
-		Audience: cfg.Auth0Audience,
-	})
+	verifier, err := authpkg.New(context.Background(), authConfig(cfg))
 	if err != nil {
 		log.Fatal(err)
 	}
+	if cfg.AuthMode == authpkg.ModeLocal {
+		log.Printf("[auth] AUTH_MODE=local: accepting HS256 dev tokens signed with JWT_SECRET (do not use in production)")
+	}
 
-	jwtMw := middleware.JWTAuth0(gdb, verifier)
+	ids := identity.NewResolver(gdb, legacyIssuer(cfg))
+	authH := handlers.NewAuthHandler(gdb, ids, verifier)  // ← 変数名を authH に
+	authMw := middleware.Authenticate(gdb, ids, verifier) // JWT / PAT / bot トークン
+
+	// 定期ジョブ
+	ctx := context.Background()
+	go jobs.Every(ctx, "workspace-purge", time.Hour, jobs.PurgeWorkspaces(gdb, store))
+	go jobs.Every(ctx, "status-expiry", time.Minute, jobs.ExpireStatuses(gdb, hub))
+	go jobs.Every(ctx, "reminders", 15*time.Second, jobs.DeliverReminders(gdb, hub))
+	go jobs.Every(ctx, "pending-upload-expiry", 10*time.Minute, jobs.ExpirePendingUploads(gdb, store))
+	go jobs.Every(ctx, "multipart-janitor", time.Hour, jobs.AbortAbandonedMultipart(gdb, store))
+	go jobs.Every(ctx, "file-scan", 5*time.Second, jobs.ScanFiles(gdb, store, scanner, cfg.ScanMaxBytes, hub))
+	go jobs.Every(ctx, "file-hash", 5*time.Second, jobs.HashFiles(gdb, store))
+	go jobs.Every(ctx, "image-processing", 5*time.Second, jobs.ProcessImages(gdb, store))
+	fileGC := jobs.FileGC{OrphanAfter: cfg.FileOrphanAfter, Retention: cfg.FileRetention, DryRun: cfg.FileGCDryRun}
+	go jobs.Every(ctx, "file-orphan-gc", time.Hour, jobs.CollectOrphanFiles(gdb, fileGC))
+	go jobs.Every(ctx, "file-purge", time.Hour, jobs.PurgeDeletedFiles(gdb, store, fileGC))
+	go jobs.Every(ctx, "webhook-ratelimit-sweep", 10*time.Minute, func(context.Context) error {
+		hookLimiter.Sweep()
+		return nil
+	})
+	go jobs.Every(ctx, "event-delivery", 5*time.Second, events.NewDeliverer(gdb, outbound).Run)
 
 	// ルータ作成（NewRouter の引数順はあなたの定義に合わせて）
-	router := httpapi.NewRouter(authH, msgH, chH, wsH, jwtMw, hub, gdb, s3deps, verifier)
+	router := httpapi.NewRouter(authH, msgH, chH, wsH, whH, cmdH, filesH, avatars, authMw, hub, gdb, store, verifier, ids, outbound)
 
 	log.Printf("listening on %s", cfg.BindAddr)
 	if err := router.Run(cfg.BindAddr); err != nil {
@@ -68,3 +107,43 @@ func main() {
 	}
 	_ = os.Setenv // keep import
 }
+
+func authConfig(cfg config.Config) authpkg.Config {
+	ac := authpkg.Config{
+		Mode:        cfg.AuthMode,
+		Auth0Domain: cfg.Auth0Domain,
+		OIDCIssuer:  cfg.OIDCIssuer,
+		JWTSecret:   cfg.JWTSecret,
+	}
+	if cfg.AuthMode == authpkg.ModeMulti {
+		issuers, err := authpkg.ParseIssuers(cfg.AuthIssuers)
+		if err != nil {
+			log.Fatal(err)
+		}
+		ac.Issuers = issuers
+	}
+	switch cfg.AuthMode {
+	case authpkg.ModeAuth0:
+		ac.Audience = cfg.Auth0Audience
+	case authpkg.ModeOIDC:
+		ac.Audience = cfg.OIDCAudience
+	}
+	return ac
+}
+
+// legacyIssuer は external_id（sub のみ）で登録済みのユーザーを引き継ぐ issuer。
+// 移行前は Auth0 単独運用だったので、既定は Auth0 の issuer
+func legacyIssuer(cfg config.Config) string {
+	if cfg.AuthLegacyIssuer != "" {
+		return cfg.AuthLegacyIssuer
+	}
+	switch {
+	case cfg.Auth0Domain != "":
+		return "https://" + cfg.Auth0Domain + "/"
+	case cfg.AuthMode == authpkg.ModeLocal:
+		return authpkg.LocalIssuer
+	case cfg.AuthMode == authpkg.ModeOIDC:
+		return cfg.OIDCIssuer
+	}
+	return ""
+}
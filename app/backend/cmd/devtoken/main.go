@@ -0,0 +1,54 @@
+// devtoken は AUTH_MODE=local の API 向けに HS256 トークンを発行する開発専用コマンド。
+//
+//	go run ./cmd/devtoken -email alice@example.com -name Alice
+//	TOKEN=$(go run ./cmd/devtoken -sub bob) && curl -H "Authorization: Bearer $TOKEN" localhost:8000/users/me
+//
+// JWT_SECRET（または -secret）は API と同じ値を使うこと。
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"slackgo/internal/auth"
+)
+
+func main() {
+	secret := os.Getenv("JWT_SECRET")
+
+	sub := flag.String("sub", "", "subject (default: local|<email>)")
+	email := flag.String("email", "", "email claim")
+	name := flag.String("name", "", "name claim")
+	verified := flag.Bool("email-verified", true, "email_verified claim")
+	ttl := flag.Duration("ttl", 24*time.Hour, "token lifetime")
+	flag.StringVar(&secret, "secret", secret, "HS256 secret (default: $JWT_SECRET)")
+	flag.Parse()
+
+	if secret == "" {
+		log.Fatal("devtoken: JWT_SECRET or -secret is required")
+	}
+	if *sub == "" {
+		if *email == "" {
+			log.Fatal("devtoken: -sub or -email is required")
+		}
+		*sub = "local|" + *email
+	}
+
+	l, err := auth.NewLocal(secret, "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	tok, err := l.Sign(auth.Claims{
+		Sub:           *sub,
+		Email:         *email,
+		Name:          *name,
+		EmailVerified: *verified && *email != "",
+	}, *ttl)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(tok)
+}
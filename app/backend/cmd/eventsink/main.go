@@ -0,0 +1,44 @@
+// eventsink はイベント配信先のローカル用スタンドイン。署名を検証してイベントをログに出す。
+//
+//	go run ./cmd/eventsink -addr :9000 -secret 0123456789abcdef0123
+//	# 購読作成時に url=http://localhost:9000/events, signing_secret=<同じ値> を指定する
+//
+// -fail-rate で一定割合を 500 にして、再送・自動無効化の挙動を確かめられる。
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"math/rand/v2"
+	"net/http"
+
+	"slackgo/internal/events"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	path := flag.String("path", "/events", "request path")
+	secret := flag.String("secret", "", "signing secret (same as the subscription)")
+	failRate := flag.Float64("fail-rate", 0, "fraction of events answered with 500 (0..1)")
+	flag.Parse()
+	if *secret == "" {
+		log.Fatal("eventsink: -secret is required")
+	}
+
+	sink := &events.Sink{
+		Secret: *secret,
+		OnEvent: func(env events.Envelope, retryNum string) error {
+			if rand.Float64() < *failRate {
+				log.Printf("fail   event=%s retry=%s", env.EventID, retryNum)
+				return errors.New("injected failure")
+			}
+			log.Printf("event  id=%s ws=%s retry=%s %s", env.EventID, env.WorkspaceID, retryNum, env.Event)
+			return nil
+		},
+	}
+	mux := http.NewServeMux()
+	mux.Handle(*path, sink)
+	log.Printf("eventsink listening on %s%s", *addr, *path)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
@@ -0,0 +1,134 @@
+// Package apitoken は PAT（personal access token）と bot トークンの発行・検証。
+// トークンは高エントロピーの乱数なので、保存は SHA-256 で十分（bcrypt 等は不要）。
+package apitoken
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/authz"
+	"slackgo/internal/model"
+)
+
+const (
+	KindPersonal = "personal"
+	KindBot      = "bot"
+
+	prefixPersonal = "xoxp-"
+	prefixBot      = "xoxb-"
+)
+
+var (
+	ErrInvalid      = errors.New("invalid api token")
+	ErrInvalidScope = errors.New("invalid scope")
+)
+
+// Looks は raw が（JWT ではなく）API トークンの形か
+func Looks(raw string) bool {
+	return strings.HasPrefix(raw, prefixPersonal) || strings.HasPrefix(raw, prefixBot)
+}
+
+func Hash(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeScopes は重複を除き、未知のスコープがあればエラー。ScopeAll は付与できない
+func NormalizeScopes(in []string) ([]string, error) {
+	out := make([]string, 0, len(in))
+	seen := map[string]struct{}{}
+	for _, s := range in {
+		s = strings.TrimSpace(s)
+		if !authz.ValidScope(s) {
+			return nil, ErrInvalidScope
+		}
+		if _, ok := seen[s]; ok {
+			continue
+		}
+		seen[s] = struct{}{}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// NewSecret は prefix + 32 バイトの乱数（base64url）を返す。webhook の URL トークン等にも使う
+func NewSecret(prefix string) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return prefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Issue はトークンを作って保存し、平文を返す（平文はこのとき一度だけ）
+func Issue(db *gorm.DB, rec *model.APIToken, scopes []string) (string, error) {
+	prefix := prefixPersonal
+	if rec.Kind == KindBot {
+		prefix = prefixBot
+	}
+	raw, err := NewSecret(prefix)
+	if err != nil {
+		return "", err
+	}
+
+	rec.TokenHash = Hash(raw)
+	rec.TokenPrefix = raw[:len(prefix)+6]
+	rec.Scopes = strings.Join(scopes, " ")
+	if err := db.Create(rec).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// Lookup は有効なトークン（未失効・期限内・bot なら無効化されていない）を返す
+func Lookup(db *gorm.DB, raw string) (*model.APIToken, error) {
+	var t model.APIToken
+	now := time.Now()
+	err := db.Where("token_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", Hash(raw), now).
+		Where(`kind <> ? OR EXISTS (
+			SELECT 1 FROM bots b WHERE b.user_id = api_tokens.user_id AND b.deactivated_at IS NULL
+		)`, KindBot).
+		First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 毎リクエスト書き込まないよう、1 分以上経っていれば更新
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > time.Minute {
+		if err := db.Model(&model.APIToken{}).Where("id = ?", t.ID).
+			Update("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+		t.LastUsedAt = &now
+	}
+	return &t, nil
+}
+
+// ScopeList は保存形式（空白区切り）をスライスにする
+func ScopeList(t *model.APIToken) []string {
+	return strings.Fields(t.Scopes)
+}
+
+// Revoke は userID のトークンを失効させる。該当なしなら gorm.ErrRecordNotFound
+func Revoke(db *gorm.DB, userID, tokenID uuid.UUID) error {
+	res := db.Model(&model.APIToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	keyfunc "github.com/MicahParks/keyfunc/v3"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWKSVerifier は JWKS で公開鍵を取得して RS256/ES256 トークンを検証する（Auth0 / OIDC 共通）
+type JWKSVerifier struct {
+	issuer     string
+	audience   string
+	algorithms []string
+	kf         keyfunc.Keyfunc
+}
+
+// defaultAlgorithms は algorithms 未指定時に受け付ける署名方式
+var defaultAlgorithms = []string{"RS256", "ES256"}
+
+func NewJWKSVerifier(ctx context.Context, jwksURL, issuer, audience string, algorithms ...string) (*JWKSVerifier, error) {
+	if jwksURL == "" || issuer == "" {
+		return nil, errors.New("auth: jwks url and issuer are required")
+	}
+	if len(algorithms) == 0 {
+		algorithms = defaultAlgorithms
+	}
+	for _, alg := range algorithms {
+		if strings.HasPrefix(alg, "HS") || alg == "none" {
+			return nil, fmt.Errorf("auth: algorithm %q is not allowed with JWKS", alg)
+		}
+	}
+	kf, err := keyfunc.NewDefaultCtx(ctx, []string{jwksURL})
+	if err != nil {
+		return nil, err
+	}
+	return &JWKSVerifier{issuer: issuer, audience: audience, algorithms: algorithms, kf: kf}, nil
+}
+
+// Issuer は検証対象の iss
+func (v *JWKSVerifier) Issuer() string { return v.issuer }
+
+// NewAuth0Verifier は Auth0 テナント（例: your-tenant.us.auth0.com）用
+func NewAuth0Verifier(ctx context.Context, domain, audience string) (*JWKSVerifier, error) {
+	if domain == "" {
+		return nil, errors.New("auth: AUTH0_DOMAIN is required")
+	}
+	return NewJWKSVerifier(ctx,
+		"https://"+domain+"/.well-known/jwks.json",
+		"https://"+domain+"/",
+		audience,
+	)
+}
+
+func (v *JWKSVerifier) Verify(raw string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithIssuer(v.issuer),
+		jwt.WithValidMethods(v.algorithms),
+		jwt.WithLeeway(leeway),
+	}
+	if v.audience != "" {
+		opts = append(opts, jwt.WithAudience(v.audience))
+	}
+	tok, err := jwt.Parse(raw, v.kf.Keyfunc, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !tok.Valid {
+		return nil, jwt.ErrTokenSignatureInvalid
+	}
+	return claimsFrom(tok)
+}
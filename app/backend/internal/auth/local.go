@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"slackgo/internal/config"
+)
+
+// LocalIssuer はローカル HS256 トークンの iss
+const LocalIssuer = "myslack-local"
+
+// Local は JWT_SECRET による HS256 の署名・検証（開発・結合テスト専用。本番では使わない）
+type Local struct {
+	secret   []byte
+	audience string
+}
+
+func NewLocal(secret, audience string) (*Local, error) {
+	// 鍵が弱いと誰でも任意のユーザーのトークンを作れるので、短い鍵では起動させない
+	if len(secret) < config.MinSecretBytes {
+		return nil, fmt.Errorf("auth: JWT_SECRET must be at least %d bytes (generate one with: openssl rand -hex 32)", config.MinSecretBytes)
+	}
+	return &Local{secret: []byte(secret), audience: audience}, nil
+}
+
+// Issuer は検証対象の iss
+func (l *Local) Issuer() string { return LocalIssuer }
+
+// Sign は c の内容で ttl 有効なトークンを発行する
+func (l *Local) Sign(c Claims, ttl time.Duration) (string, error) {
+	if c.Sub == "" {
+		return "", errors.New("auth: sub is required")
+	}
+	now := time.Now()
+	mc := jwt.MapClaims{
+		"iss":            LocalIssuer,
+		"sub":            c.Sub,
+		"iat":            now.Unix(),
+		"exp":            now.Add(ttl).Unix(),
+		"email_verified": c.EmailVerified,
+	}
+	if l.audience != "" {
+		mc["aud"] = l.audience
+	}
+	if c.Email != "" {
+		mc["email"] = c.Email
+	}
+	if c.Name != "" {
+		mc["name"] = c.Name
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, mc).SignedString(l.secret)
+}
+
+func (l *Local) Verify(raw string) (*Claims, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithIssuer(LocalIssuer),
+		jwt.WithValidMethods([]string{"HS256"}),
+		jwt.WithLeeway(leeway),
+		jwt.WithExpirationRequired(),
+	}
+	if l.audience != "" {
+		opts = append(opts, jwt.WithAudience(l.audience))
+	}
+	tok, err := jwt.Parse(raw, func(*jwt.Token) (any, error) { return l.secret, nil }, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if !tok.Valid {
+		return nil, jwt.ErrTokenSignatureInvalid
+	}
+	return claimsFrom(tok)
+}
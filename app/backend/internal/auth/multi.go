@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// IssuerConfig は AUTH_ISSUERS（JSON 配列）の 1 要素。
+// jwks_url を省略すると issuer の OIDC discovery で解決する。issuer が "local" ならローカル HS256
+type IssuerConfig struct {
+	Issuer     string   `json:"issuer"`
+	JWKSURL    string   `json:"jwks_url,omitempty"`
+	Audience   string   `json:"audience,omitempty"`
+	Algorithms []string `json:"algorithms,omitempty"`
+}
+
+// IssuerVerifier は特定の iss だけを検証する Verifier
+type IssuerVerifier interface {
+	Verifier
+	Issuer() string
+}
+
+// Multi は未検証の iss を見て、信頼済み issuer の Verifier に振り分ける
+type Multi struct {
+	byIssuer map[string]IssuerVerifier
+}
+
+var ErrUntrustedIssuer = errors.New("auth: untrusted issuer")
+
+func NewMulti(vs ...IssuerVerifier) (*Multi, error) {
+	m := &Multi{byIssuer: map[string]IssuerVerifier{}}
+	for _, v := range vs {
+		key := normalizeIssuer(v.Issuer())
+		if _, dup := m.byIssuer[key]; dup {
+			return nil, fmt.Errorf("auth: duplicate issuer %s", v.Issuer())
+		}
+		m.byIssuer[key] = v
+	}
+	if len(m.byIssuer) == 0 {
+		return nil, errors.New("auth: no trusted issuers")
+	}
+	return m, nil
+}
+
+// NewMultiFromConfig は AUTH_ISSUERS の設定から Multi を作る
+func NewMultiFromConfig(ctx context.Context, issuers []IssuerConfig, jwtSecret string) (*Multi, error) {
+	vs := make([]IssuerVerifier, 0, len(issuers))
+	for _, ic := range issuers {
+		var (
+			v   IssuerVerifier
+			err error
+		)
+		switch {
+		case ic.Issuer == ModeLocal || ic.Issuer == LocalIssuer:
+			v, err = NewLocal(jwtSecret, ic.Audience)
+		case ic.JWKSURL != "":
+			v, err = NewJWKSVerifier(ctx, ic.JWKSURL, ic.Issuer, ic.Audience, ic.Algorithms...)
+		default:
+			v, err = NewOIDCVerifier(ctx, ic.Issuer, ic.Audience, ic.Algorithms...)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("auth: issuer %s: %w", ic.Issuer, err)
+		}
+		vs = append(vs, v)
+	}
+	return NewMulti(vs...)
+}
+
+func (m *Multi) Verify(raw string) (*Claims, error) {
+	// 署名はまだ検証しない。iss で検証器を選ぶだけ（選んだ検証器が iss も含めて検証し直す）
+	var mc jwt.MapClaims
+	if _, _, err := jwt.NewParser().ParseUnverified(raw, &mc); err != nil {
+		return nil, err
+	}
+	iss, _ := mc["iss"].(string)
+	v, ok := m.byIssuer[normalizeIssuer(iss)]
+	if !ok {
+		return nil, ErrUntrustedIssuer
+	}
+	return v.Verify(raw)
+}
+
+// Issuers は信頼している issuer の一覧
+func (m *Multi) Issuers() []string {
+	out := make([]string, 0, len(m.byIssuer))
+	for _, v := range m.byIssuer {
+		out = append(out, v.Issuer())
+	}
+	return out
+}
+
+func normalizeIssuer(s string) string {
+	return strings.TrimSuffix(s, "/")
+}
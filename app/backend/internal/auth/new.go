@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Mode は AUTH_MODE の値
+const (
+	ModeAuth0 = "auth0"
+	ModeOIDC  = "oidc"
+	ModeLocal = "local"
+	ModeMulti = "multi" // AUTH_ISSUERS に列挙した複数 IdP を同時に信頼する
+)
+
+type Config struct {
+	Mode string
+
+	Auth0Domain string // e.g. your-tenant.us.auth0.com
+	OIDCIssuer  string // e.g. https://keycloak.example.com/realms/myslack
+	Audience    string // e.g. https://api.myslack.local
+	JWTSecret   string // local のみ
+
+	Issuers []IssuerConfig // multi のみ
+}
+
+// ParseIssuers は AUTH_ISSUERS（JSON 配列）を読む。例:
+//
+//	[{"issuer":"https://tenant.us.auth0.com/","audience":"https://api.myslack.local"},
+//	 {"issuer":"https://kc.example.com/realms/partner","audience":"myslack","algorithms":["RS256"]}]
+func ParseIssuers(raw string) ([]IssuerConfig, error) {
+	var out []IssuerConfig
+	if err := json.Unmarshal([]byte(raw), &out); err != nil {
+		return nil, fmt.Errorf("auth: AUTH_ISSUERS: %w", err)
+	}
+	for _, ic := range out {
+		if ic.Issuer == "" {
+			return nil, fmt.Errorf("auth: AUTH_ISSUERS: issuer is required")
+		}
+	}
+	return out, nil
+}
+
+// New は cfg.Mode に応じた Verifier を作る
+func New(ctx context.Context, cfg Config) (Verifier, error) {
+	switch cfg.Mode {
+	case ModeAuth0:
+		return NewAuth0Verifier(ctx, cfg.Auth0Domain, cfg.Audience)
+	case ModeOIDC:
+		return NewOIDCVerifier(ctx, cfg.OIDCIssuer, cfg.Audience)
+	case ModeLocal:
+		return NewLocal(cfg.JWTSecret, cfg.Audience)
+	case ModeMulti:
+		return NewMultiFromConfig(ctx, cfg.Issuers, cfg.JWTSecret)
+	default:
+		return nil, fmt.Errorf("auth: unknown AUTH_MODE %q", cfg.Mode)
+	}
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// NewOIDCVerifier は issuer の /.well-known/openid-configuration から jwks_uri を解決する（Keycloak, Google, Cognito 等）
+func NewOIDCVerifier(ctx context.Context, issuer, audience string, algorithms ...string) (*JWKSVerifier, error) {
+	if issuer == "" {
+		return nil, fmt.Errorf("auth: OIDC_ISSUER is required")
+	}
+	url := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+
+	dctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(dctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("auth: oidc discovery: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("auth: oidc discovery: %s returned %d", url, res.StatusCode)
+	}
+
+	var doc struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("auth: oidc discovery: %w", err)
+	}
+	// iss は discovery の値をそのまま使う（末尾スラッシュの有無が IdP ごとに違うため）
+	if strings.TrimSuffix(doc.Issuer, "/") != strings.TrimSuffix(issuer, "/") {
+		return nil, fmt.Errorf("auth: oidc discovery: issuer mismatch (%s)", doc.Issuer)
+	}
+	return NewJWKSVerifier(ctx, doc.JWKSURI, doc.Issuer, audience, algorithms...)
+}
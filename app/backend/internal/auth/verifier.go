@@ -1,55 +1,56 @@
 package auth
 
 import (
-	"context"
 	"time"
 
-	keyfunc "github.com/MicahParks/keyfunc/v3"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-type Config struct {
-	Domain   string // e.g. your-tenant.us.auth0.com
-	Audience string // e.g. https://api.myslack.local
-}
-
-type Verifier struct {
-	cfg Config
-	kf  keyfunc.Keyfunc
-}
-
-func NewVerifier(ctx context.Context, cfg Config) (*Verifier, error) {
-	kf, err := keyfunc.NewDefaultCtx(ctx, []string{
-		"https://" + cfg.Domain + "/.well-known/jwks.json",
-	})
-	if err != nil {
-		return nil, err
-	}
-	return &Verifier{cfg: cfg, kf: kf}, nil
+// Verifier はアクセストークンを検証してクレームを返す。
+// 実装: Auth0（JWKS）/ 汎用 OIDC（discovery）/ ローカル HS256（開発用）
+type Verifier interface {
+	Verify(raw string) (*Claims, error)
 }
 
 type Claims struct {
-	Sub   string
-	Email string
-	Name  string
+	Issuer string
+	Sub    string
+	Email  string
+	Name   string
+	// EmailVerified は IdP が email の所有確認を済ませているか（Auth0 の email_verified）
+	EmailVerified bool
 }
 
-func (v *Verifier) Verify(raw string) (*Claims, error) {
-	tok, err := jwt.Parse(raw, v.kf.Keyfunc,
-		jwt.WithAudience(v.cfg.Audience),
-		jwt.WithIssuer("https://"+v.cfg.Domain+"/"),
-		jwt.WithValidMethods([]string{"RS256"}),
-		jwt.WithLeeway(30*time.Second),
-	)
-	if err != nil || !tok.Valid {
-		return nil, err
-	}
+// leeway は exp/nbf/iat の時計ずれ許容
+const leeway = 30 * time.Second
+
+// claimsFrom は検証済みトークンから Claims を取り出す。sub 必須
+func claimsFrom(tok *jwt.Token) (*Claims, error) {
 	mc, _ := tok.Claims.(jwt.MapClaims)
+	iss, _ := mc["iss"].(string)
 	sub, _ := mc["sub"].(string)
 	email, _ := mc["email"].(string)
 	name, _ := mc["name"].(string)
 	if sub == "" {
 		return nil, jwt.ErrTokenInvalidClaims
 	}
-	return &Claims{Sub: sub, Email: email, Name: name}, nil
+	return &Claims{
+		Issuer:        iss,
+		Sub:           sub,
+		Email:         email,
+		Name:          name,
+		EmailVerified: boolClaim(mc["email_verified"]),
+	}, nil
+}
+
+// boolClaim は bool / "true" 文字列のどちらで来ても解釈する（IdP によって型が揺れるため）
+func boolClaim(v any) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case string:
+		return b == "true"
+	default:
+		return false
+	}
 }
@@ -0,0 +1,283 @@
+// Package authz はワークスペース/チャンネル/ファイルの権限判定を一箇所にまとめたもの。
+// middleware・wsroute・handlers はここを通して判定し、SQL を個別に書かない。
+package authz
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/model"
+)
+
+// Role は workspace_members.role の値
+type Role string
+
+const (
+	RoleNone               Role = "" // 非メンバー
+	RoleOwner              Role = "owner"
+	RoleAdmin              Role = "admin"
+	RoleMember             Role = "member"
+	RoleMultiChannelGuest  Role = "multi_channel_guest"
+	RoleSingleChannelGuest Role = "single_channel_guest"
+)
+
+// ChannelRole は channel_members.role の値
+const (
+	ChannelRoleOwner  = "owner"
+	ChannelRoleMember = "member"
+)
+
+// ParseRole は文字列を Role に変換する。未知の値は ok=false
+func ParseRole(s string) (Role, bool) {
+	switch r := Role(s); r {
+	case RoleOwner, RoleAdmin, RoleMember, RoleMultiChannelGuest, RoleSingleChannelGuest:
+		return r, true
+	default:
+		return RoleNone, false
+	}
+}
+
+func (r Role) rank() int {
+	switch r {
+	case RoleOwner:
+		return 4
+	case RoleAdmin:
+		return 3
+	case RoleMember:
+		return 2
+	case RoleMultiChannelGuest, RoleSingleChannelGuest:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// AtLeast は r が min 以上の権限を持つか（guest 同士は同格）
+func (r Role) AtLeast(min Role) bool { return r.rank() >= min.rank() && r != RoleNone }
+
+// IsGuest はゲスト（明示的に追加されたチャンネルしか見えない）か
+func (r Role) IsGuest() bool {
+	return r == RoleMultiChannelGuest || r == RoleSingleChannelGuest
+}
+
+// IsMember はワークスペースに何らかの役割で所属しているか
+func (r Role) IsMember() bool { return r != RoleNone }
+
+// WorkspaceRole は user の workspace における役割を返す。
+// 非メンバー、または論理削除済みのワークスペースは RoleNone
+func WorkspaceRole(db *gorm.DB, userID, wsID uuid.UUID) (Role, error) {
+	return workspaceRole(db, userID, wsID, false)
+}
+
+// WorkspaceRoleIncludingDeleted は論理削除済みのワークスペースも対象にする（restore 用）
+func WorkspaceRoleIncludingDeleted(db *gorm.DB, userID, wsID uuid.UUID) (Role, error) {
+	return workspaceRole(db, userID, wsID, true)
+}
+
+func workspaceRole(db *gorm.DB, userID, wsID uuid.UUID, includeDeleted bool) (Role, error) {
+	q := db.Table("workspace_members wm").
+		Select("wm.role").
+		Joins("JOIN workspaces w ON w.id = wm.workspace_id").
+		Where("wm.user_id = ? AND wm.workspace_id = ?", userID, wsID)
+	if !includeDeleted {
+		q = q.Where("w.deleted_at IS NULL")
+	}
+	var role string
+	if err := q.Limit(1).Scan(&role).Error; err != nil {
+		return RoleNone, err
+	}
+	r, _ := ParseRole(role)
+	return r, nil
+}
+
+// ChannelAccess はチャンネルに対する user の権限の判定結果
+type ChannelAccess struct {
+	Exists        bool
+	ChannelID     uuid.UUID
+	WorkspaceID   uuid.UUID
+	IsPrivate     bool
+	WorkspaceRole Role
+	ChannelRole   string // channel_members.role（非メンバーは ""）
+	CanRead       bool
+	CanWrite      bool
+}
+
+// IsChannelMember は channel_members に行があるか
+func (a ChannelAccess) IsChannelMember() bool { return a.ChannelRole != "" }
+
+// Channel はチャンネルの読み書き可否をまとめて判定する。
+// 論理削除済みワークスペースのチャンネルは存在しない扱い（Exists=false）。
+//   - 非WSメンバー: 不可
+//   - ゲスト: public/private を問わず、channel_members に居るチャンネルのみ読み書き可
+//   - それ以外: 読み取りは public→WSメンバーならOK / private→channel member 必須、
+//     書き込みは public/private ともに channel member 必須
+func Channel(db *gorm.DB, userID, channelID uuid.UUID) (ChannelAccess, error) {
+	var row struct {
+		ID            uuid.UUID
+		WorkspaceID   uuid.UUID
+		IsPrivate     bool
+		WorkspaceRole *string
+		ChannelRole   *string
+	}
+	if err := db.Raw(`
+		SELECT c.id, c.workspace_id, c.is_private,
+		       wm.role AS workspace_role,
+		       cm.role AS channel_role
+		FROM channels c
+		JOIN workspaces w ON w.id = c.workspace_id AND w.deleted_at IS NULL
+		LEFT JOIN workspace_members wm ON wm.workspace_id = c.workspace_id AND wm.user_id = ?
+		LEFT JOIN channel_members   cm ON cm.channel_id   = c.id           AND cm.user_id = ?
+		WHERE c.id = ?
+		LIMIT 1`, userID, userID, channelID).Scan(&row).Error; err != nil {
+		return ChannelAccess{}, err
+	}
+	if row.ID == uuid.Nil {
+		return ChannelAccess{}, nil
+	}
+
+	a := ChannelAccess{
+		Exists:      true,
+		ChannelID:   row.ID,
+		WorkspaceID: row.WorkspaceID,
+		IsPrivate:   row.IsPrivate,
+	}
+	if row.WorkspaceRole != nil {
+		a.WorkspaceRole, _ = ParseRole(*row.WorkspaceRole)
+	}
+	if row.ChannelRole != nil {
+		a.ChannelRole = *row.ChannelRole
+	}
+
+	if !a.WorkspaceRole.IsMember() {
+		return a, nil
+	}
+	isChMember := a.IsChannelMember()
+	switch {
+	case a.WorkspaceRole.IsGuest():
+		a.CanRead = isChMember
+	case a.IsPrivate:
+		a.CanRead = isChMember
+	default:
+		a.CanRead = true
+	}
+	a.CanWrite = isChMember
+	return a, nil
+}
+
+// CanReadChannel は Channel の CanRead だけを返すショートカット
+func CanReadChannel(db *gorm.DB, userID, channelID uuid.UUID) (bool, error) {
+	a, err := Channel(db, userID, channelID)
+	if err != nil {
+		return false, err
+	}
+	return a.CanRead, nil
+}
+
+// CanJoin は自己参加できるか（public かつゲスト以外）
+func (a ChannelAccess) CanJoin() bool {
+	return a.Exists && !a.IsPrivate && a.WorkspaceRole.IsMember() && !a.WorkspaceRole.IsGuest()
+}
+
+// ReadableChannelsCond は一覧を userID が読めるチャンネルに絞る SQL 条件（col はチャンネル ID の列）。
+// Channel の CanRead と同じ規則で、role はそのワークスペースでの役割（メンバーであることは呼び出し側で確認済み）
+func ReadableChannelsCond(col string, userID uuid.UUID, role Role) (string, []any) {
+	member := `EXISTS (SELECT 1 FROM channel_members rcm WHERE rcm.channel_id = ` + col + ` AND rcm.user_id = ?)`
+	if role.IsGuest() {
+		return member, []any{userID}
+	}
+	return `(` + member + ` OR EXISTS (SELECT 1 FROM channels rc WHERE rc.id = ` + col + ` AND NOT rc.is_private))`, []any{userID}
+}
+
+// ChannelReaders は userIDs のうち channelID を読める人を 1 回のクエリで返す（Channel の CanRead と同じ規則）
+func ChannelReaders(db *gorm.DB, channelID uuid.UUID, userIDs []uuid.UUID) ([]uuid.UUID, error) {
+	if len(userIDs) == 0 {
+		return nil, nil
+	}
+	var ids []uuid.UUID
+	err := db.Raw(`
+		SELECT wm.user_id
+		FROM channels c
+		JOIN workspaces w ON w.id = c.workspace_id AND w.deleted_at IS NULL
+		JOIN workspace_members wm ON wm.workspace_id = c.workspace_id AND wm.user_id IN ?
+		LEFT JOIN channel_members cm ON cm.channel_id = c.id AND cm.user_id = wm.user_id
+		WHERE c.id = ?
+		  AND (cm.user_id IS NOT NULL OR (NOT c.is_private AND wm.role NOT IN ?))`,
+		userIDs, channelID, []string{string(RoleMultiChannelGuest), string(RoleSingleChannelGuest)}).Scan(&ids).Error
+	return ids, err
+}
+
+// CanReadFile はファイルの閲覧可否。メッセージ添付はチャンネルの読み取り権限に、アバターは持ち主とワークスペースを共有しているかに従う
+func CanReadFile(db *gorm.DB, userID uuid.UUID, f *model.File) (bool, error) {
+	switch f.Purpose {
+	case "avatar":
+		// 持ち主（とアップロードした人）か、持ち主と同じワークスペースに居る人
+		owner := f.UploaderID
+		if f.OwnerUserID != nil {
+			owner = *f.OwnerUserID
+		}
+		if userID == owner || userID == f.UploaderID {
+			return true, nil
+		}
+		return SharesWorkspace(db, userID, owner)
+	case "message_attachment":
+		if f.ChannelID == nil {
+			return false, nil
+		}
+		return CanReadChannel(db, userID, *f.ChannelID)
+	default:
+		return false, nil
+	}
+}
+
+// SharesWorkspace は a と b が同じ（削除されていない）ワークスペースに居るか
+func SharesWorkspace(db *gorm.DB, a, b uuid.UUID) (bool, error) {
+	var n int64
+	err := db.Table("workspace_members x").
+		Joins("JOIN workspace_members y ON y.workspace_id = x.workspace_id").
+		Joins("JOIN workspaces w ON w.id = x.workspace_id AND w.deleted_at IS NULL").
+		Where("x.user_id = ? AND y.user_id = ?", a, b).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// CanManageUser は actor が target の所属するいずれかのワークスペースの admin 以上か（代理でのアバター設定など）
+func CanManageUser(db *gorm.DB, actor, target uuid.UUID) (bool, error) {
+	var n int64
+	err := db.Table("workspace_members x").
+		Joins("JOIN workspace_members y ON y.workspace_id = x.workspace_id").
+		Joins("JOIN workspaces w ON w.id = x.workspace_id AND w.deleted_at IS NULL").
+		Where("x.user_id = ? AND x.role IN ? AND y.user_id = ?", actor, []Role{RoleOwner, RoleAdmin}, target).
+		Count(&n).Error
+	return n > 0, err
+}
+
+// ErrSingleChannelGuestLimit は single_channel_guest を2つ目のチャンネルへ追加しようとした
+var ErrSingleChannelGuestLimit = errors.New("single-channel guest already belongs to a channel")
+
+// CheckChannelInvite は target を channelID へ追加してよいかを判定する。
+// target が WS 非メンバーなら ok=false、single_channel_guest が別チャンネル所属済みなら
+// ErrSingleChannelGuestLimit を返す。
+func CheckChannelInvite(db *gorm.DB, targetID, channelID uuid.UUID) (bool, error) {
+	a, err := Channel(db, targetID, channelID)
+	if err != nil {
+		return false, err
+	}
+	if !a.Exists || !a.WorkspaceRole.IsMember() {
+		return false, nil
+	}
+	if a.WorkspaceRole == RoleSingleChannelGuest && !a.IsChannelMember() {
+		var n int64
+		if err := db.Table("channel_members cm").
+			Joins("JOIN channels c ON c.id = cm.channel_id").
+			Where("cm.user_id = ? AND c.workspace_id = ?", targetID, a.WorkspaceID).
+			Count(&n).Error; err != nil {
+			return false, err
+		}
+		if n > 0 {
+			return false, ErrSingleChannelGuestLimit
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,39 @@
+package authz
+
+import "slices"
+
+// スコープは API トークン（PAT / bot）に付与する権限。
+// 対話ログイン（JWT）は ScopeAll を持ち、役割（Role）による判定だけを受ける
+const (
+	ScopeAll = "*"
+
+	ScopeChatWrite       = "chat:write"       // メッセージ投稿
+	ScopeChannelsRead    = "channels:read"    // チャンネル一覧・メンバーシップ
+	ScopeChannelsHistory = "channels:history" // メッセージ閲覧
+	ScopeChannelsWrite   = "channels:write"   // チャンネル作成・参加・招待
+	ScopeUsersRead       = "users:read"
+	ScopeUsersWrite      = "users:write" // 自分のプロフィール・アバター
+	ScopeFilesRead       = "files:read"
+	ScopeFilesWrite      = "files:write"
+	ScopeUserGroupsRead  = "usergroups:read"
+	ScopeUserGroupsWrite = "usergroups:write"
+	ScopeWorkspacesRead  = "workspaces:read"
+	ScopeAdmin           = "admin" // ワークスペース管理（実際に許されるかは Role 次第）
+)
+
+// AllScopes はトークンに付与できるスコープの一覧
+var AllScopes = []string{
+	ScopeChatWrite, ScopeChannelsRead, ScopeChannelsHistory, ScopeChannelsWrite,
+	ScopeUsersRead, ScopeUsersWrite, ScopeFilesRead, ScopeFilesWrite,
+	ScopeUserGroupsRead, ScopeUserGroupsWrite, ScopeWorkspacesRead, ScopeAdmin,
+}
+
+// ValidScope は付与可能なスコープか
+func ValidScope(s string) bool {
+	return slices.Contains(AllScopes, s)
+}
+
+// HasScope は granted が want を含むか（ScopeAll は全て含む）
+func HasScope(granted []string, want string) bool {
+	return slices.Contains(granted, ScopeAll) || slices.Contains(granted, want)
+}
@@ -0,0 +1,14 @@
+-- +goose Up
+-- ワークスペースごとの自動参加可能なメールドメイン
+CREATE TABLE IF NOT EXISTS workspace_allowed_domains (
+  workspace_id uuid NOT NULL,
+  domain       text NOT NULL,
+  created_at   timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (workspace_id, domain),
+  CONSTRAINT fk_wad_ws FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+  CONSTRAINT chk_wad_domain_lower CHECK (domain = lower(domain))
+);
+CREATE INDEX IF NOT EXISTS idx_wad_domain ON workspace_allowed_domains (domain);
+
+-- +goose Down
+DROP TABLE IF EXISTS workspace_allowed_domains;
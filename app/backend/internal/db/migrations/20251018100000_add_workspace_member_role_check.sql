@@ -0,0 +1,18 @@
+-- +goose Up
+-- 役割: owner / admin / member / multi_channel_guest / single_channel_guest
+UPDATE workspace_members SET role = 'member'
+WHERE role NOT IN ('owner', 'admin', 'member', 'multi_channel_guest', 'single_channel_guest');
+
+ALTER TABLE workspace_members
+  ADD CONSTRAINT chk_wm_role
+  CHECK (role IN ('owner', 'admin', 'member', 'multi_channel_guest', 'single_channel_guest'));
+
+UPDATE channel_members SET role = 'member' WHERE role NOT IN ('owner', 'member');
+
+ALTER TABLE channel_members
+  ADD CONSTRAINT chk_cm_role
+  CHECK (role IN ('owner', 'member'));
+
+-- +goose Down
+ALTER TABLE channel_members DROP CONSTRAINT IF EXISTS chk_cm_role;
+ALTER TABLE workspace_members DROP CONSTRAINT IF EXISTS chk_wm_role;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- 論理削除（猶予期間後に purge ジョブが DELETE → ON DELETE CASCADE で実データ削除）
+ALTER TABLE workspaces
+  ADD COLUMN IF NOT EXISTS deleted_at  timestamptz NULL,
+  ADD COLUMN IF NOT EXISTS purge_after timestamptz NULL;
+
+CREATE INDEX IF NOT EXISTS idx_workspaces_purge_after
+  ON workspaces (purge_after) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_workspaces_purge_after;
+ALTER TABLE workspaces
+  DROP COLUMN IF EXISTS purge_after,
+  DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- メンバーディレクトリの前方一致検索用（lower(...) LIKE 'q%'）
+CREATE INDEX IF NOT EXISTS idx_users_display_name_prefix
+  ON users (lower(display_name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_users_email_prefix
+  ON users (lower(email) text_pattern_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_users_email_prefix;
+DROP INDEX IF EXISTS idx_users_display_name_prefix;
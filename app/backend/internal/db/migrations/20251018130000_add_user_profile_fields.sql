@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE users
+  ADD COLUMN IF NOT EXISTS title             varchar(255) NULL,
+  ADD COLUMN IF NOT EXISTS phone             varchar(64)  NULL,
+  ADD COLUMN IF NOT EXISTS timezone          varchar(64)  NULL, -- IANA 名（例: Asia/Tokyo）
+  ADD COLUMN IF NOT EXISTS pronouns          varchar(64)  NULL,
+  ADD COLUMN IF NOT EXISTS status_emoji      varchar(64)  NULL,
+  ADD COLUMN IF NOT EXISTS status_text       varchar(100) NULL,
+  ADD COLUMN IF NOT EXISTS status_expires_at timestamptz  NULL;
+
+-- 期限切れステータスの掃除ジョブ用
+CREATE INDEX IF NOT EXISTS idx_users_status_expires_at
+  ON users (status_expires_at) WHERE status_expires_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_users_status_expires_at;
+ALTER TABLE users
+  DROP COLUMN IF EXISTS status_expires_at,
+  DROP COLUMN IF EXISTS status_text,
+  DROP COLUMN IF EXISTS status_emoji,
+  DROP COLUMN IF EXISTS pronouns,
+  DROP COLUMN IF EXISTS timezone,
+  DROP COLUMN IF EXISTS phone,
+  DROP COLUMN IF EXISTS title;
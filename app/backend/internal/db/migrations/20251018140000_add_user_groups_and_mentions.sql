@@ -0,0 +1,52 @@
+-- +goose Up
+-- ユーザーグループ（@backend-team のようなハンドル）
+CREATE TABLE IF NOT EXISTS user_groups (
+  id           uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  workspace_id uuid NOT NULL,
+  handle       varchar(80)  NOT NULL,
+  name         varchar(255) NOT NULL,
+  description  text,
+  created_by   uuid,
+  created_at   timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT fk_ug_ws   FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+  CONSTRAINT fk_ug_user FOREIGN KEY (created_by)   REFERENCES users(id)      ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_user_groups_ws_handle ON user_groups (workspace_id, lower(handle));
+
+CREATE TABLE IF NOT EXISTS user_group_members (
+  group_id   uuid NOT NULL,
+  user_id    uuid NOT NULL,
+  created_at timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (group_id, user_id),
+  CONSTRAINT fk_ugm_group FOREIGN KEY (group_id) REFERENCES user_groups(id) ON DELETE CASCADE,
+  CONSTRAINT fk_ugm_user  FOREIGN KEY (user_id)  REFERENCES users(id)       ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_ugm_user ON user_group_members (user_id);
+
+-- グループに追加されたメンバーが自動で参加するチャンネル
+CREATE TABLE IF NOT EXISTS user_group_channels (
+  group_id   uuid NOT NULL,
+  channel_id uuid NOT NULL,
+  PRIMARY KEY (group_id, channel_id),
+  CONSTRAINT fk_ugc_group FOREIGN KEY (group_id)   REFERENCES user_groups(id) ON DELETE CASCADE,
+  CONSTRAINT fk_ugc_ch    FOREIGN KEY (channel_id) REFERENCES channels(id)    ON DELETE CASCADE
+);
+
+-- メンション通知（グループメンションは展開して1ユーザー1行）
+CREATE TABLE IF NOT EXISTS message_mentions (
+  message_id   uuid NOT NULL,
+  user_id      uuid NOT NULL,
+  via_group_id uuid NULL,
+  created_at   timestamptz NOT NULL DEFAULT now(),
+  PRIMARY KEY (message_id, user_id),
+  CONSTRAINT fk_mm_msg   FOREIGN KEY (message_id)   REFERENCES messages(id)    ON DELETE CASCADE,
+  CONSTRAINT fk_mm_user  FOREIGN KEY (user_id)      REFERENCES users(id)       ON DELETE CASCADE,
+  CONSTRAINT fk_mm_group FOREIGN KEY (via_group_id) REFERENCES user_groups(id) ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_mm_user_created ON message_mentions (user_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS message_mentions;
+DROP TABLE IF EXISTS user_group_channels;
+DROP TABLE IF EXISTS user_group_members;
+DROP TABLE IF EXISTS user_groups;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- IdP ごとのアカウント。ユーザーは (issuer, subject) で特定する（sub は IdP 間で衝突しうるため）
+CREATE TABLE IF NOT EXISTS user_identities (
+  id           uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id      uuid NOT NULL,
+  issuer       varchar(512) NOT NULL,
+  subject      varchar(255) NOT NULL,
+  email        varchar(320),
+  created_at   timestamptz NOT NULL DEFAULT now(),
+  last_used_at timestamptz,
+  CONSTRAINT fk_uid_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_user_identities_iss_sub ON user_identities (issuer, subject);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user ON user_identities (user_id);
+
+-- 既存ユーザー（users.external_id = sub）は issuer が分からないため、
+-- AUTH_LEGACY_ISSUER からの初回ログイン時にアプリ側で user_identities へ移す
+
+-- +goose Down
+DROP TABLE IF EXISTS user_identities;
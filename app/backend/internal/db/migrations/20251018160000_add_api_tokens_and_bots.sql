@@ -0,0 +1,42 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_bot boolean NOT NULL DEFAULT false;
+
+-- bot はワークスペースごと。実体は users の 1 行（is_bot=true）で、workspace_members にも入る
+CREATE TABLE IF NOT EXISTS bots (
+  user_id        uuid PRIMARY KEY,
+  workspace_id   uuid NOT NULL,
+  name           varchar(80) NOT NULL,
+  created_by     uuid,
+  created_at     timestamptz NOT NULL DEFAULT now(),
+  deactivated_at timestamptz,
+  CONSTRAINT fk_bots_user FOREIGN KEY (user_id)      REFERENCES users(id)      ON DELETE CASCADE,
+  CONSTRAINT fk_bots_ws   FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+  CONSTRAINT fk_bots_by   FOREIGN KEY (created_by)   REFERENCES users(id)      ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_bots_ws_name ON bots (workspace_id, lower(name));
+
+-- PAT（kind=personal）と bot トークン（kind=bot）。平文は保存せず SHA-256 のみ
+CREATE TABLE IF NOT EXISTS api_tokens (
+  id           uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  user_id      uuid NOT NULL,
+  kind         varchar(16) NOT NULL,
+  name         varchar(80) NOT NULL,
+  token_hash   char(64) NOT NULL,
+  token_prefix varchar(16) NOT NULL,
+  scopes       text NOT NULL DEFAULT '',
+  expires_at   timestamptz,
+  revoked_at   timestamptz,
+  last_used_at timestamptz,
+  created_by   uuid,
+  created_at   timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT fk_tok_user FOREIGN KEY (user_id)    REFERENCES users(id) ON DELETE CASCADE,
+  CONSTRAINT fk_tok_by   FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL,
+  CONSTRAINT api_tokens_kind_check CHECK (kind IN ('personal', 'bot'))
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_api_tokens_hash ON api_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user ON api_tokens (user_id);
+
+-- +goose Down
+DROP TABLE IF EXISTS api_tokens;
+DROP TABLE IF EXISTS bots;
+ALTER TABLE users DROP COLUMN IF EXISTS is_bot;
@@ -0,0 +1,36 @@
+-- +goose Up
+-- チャンネル単位の incoming webhook。URL に含める秘密トークンは SHA-256 のみ保存
+CREATE TABLE IF NOT EXISTS incoming_webhooks (
+  id           uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  workspace_id uuid NOT NULL,
+  channel_id   uuid NOT NULL,
+  bot_user_id  uuid NOT NULL,
+  name         varchar(80) NOT NULL,
+  token_hash   char(64) NOT NULL,
+  token_prefix varchar(16) NOT NULL,
+  created_by   uuid,
+  created_at   timestamptz NOT NULL DEFAULT now(),
+  last_used_at timestamptz,
+  CONSTRAINT fk_iwh_ws  FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+  CONSTRAINT fk_iwh_ch  FOREIGN KEY (channel_id)   REFERENCES channels(id)   ON DELETE CASCADE,
+  CONSTRAINT fk_iwh_bot FOREIGN KEY (bot_user_id)  REFERENCES users(id)      ON DELETE CASCADE,
+  CONSTRAINT fk_iwh_by  FOREIGN KEY (created_by)   REFERENCES users(id)      ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_incoming_webhooks_hash ON incoming_webhooks (token_hash);
+CREATE INDEX IF NOT EXISTS idx_incoming_webhooks_channel ON incoming_webhooks (channel_id);
+
+-- webhook 経由の投稿（表示名・アイコンの上書き）
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS webhook_id uuid,
+  ADD COLUMN IF NOT EXISTS username   varchar(80),
+  ADD COLUMN IF NOT EXISTS icon_url   text;
+ALTER TABLE messages
+  ADD CONSTRAINT fk_messages_webhook FOREIGN KEY (webhook_id) REFERENCES incoming_webhooks(id) ON DELETE SET NULL;
+
+-- +goose Down
+ALTER TABLE messages DROP CONSTRAINT IF EXISTS fk_messages_webhook;
+ALTER TABLE messages
+  DROP COLUMN IF EXISTS icon_url,
+  DROP COLUMN IF EXISTS username,
+  DROP COLUMN IF EXISTS webhook_id;
+DROP TABLE IF EXISTS incoming_webhooks;
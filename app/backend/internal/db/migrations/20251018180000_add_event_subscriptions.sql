@@ -0,0 +1,43 @@
+-- +goose Up
+-- 外部サービスへのイベント配信先（ワークスペース単位）
+CREATE TABLE IF NOT EXISTS event_subscriptions (
+  id                   uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  workspace_id         uuid NOT NULL,
+  name                 varchar(80) NOT NULL,
+  url                  text NOT NULL,
+  event_types          text NOT NULL,            -- 空白区切り
+  signing_secret       varchar(128) NOT NULL,    -- 署名に使うので平文で持つ
+  verified_at          timestamptz,
+  disabled_at          timestamptz,
+  disabled_reason      text,
+  consecutive_failures integer NOT NULL DEFAULT 0,
+  created_by           uuid,
+  created_at           timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT fk_evs_ws FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+  CONSTRAINT fk_evs_by FOREIGN KEY (created_by)   REFERENCES users(id)      ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_event_subscriptions_ws ON event_subscriptions (workspace_id);
+
+-- 配信 outbox。イベント発生時に書き、ワーカーが next_attempt_at を見て送る（再起動しても失われない）
+CREATE TABLE IF NOT EXISTS event_deliveries (
+  id               uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  subscription_id  uuid NOT NULL,
+  event_id         uuid NOT NULL,
+  event_type       varchar(64) NOT NULL,
+  payload          jsonb NOT NULL,
+  status           varchar(16) NOT NULL DEFAULT 'pending',
+  attempts         integer NOT NULL DEFAULT 0,
+  next_attempt_at  timestamptz NOT NULL DEFAULT now(),
+  last_status_code integer,
+  last_error       text,
+  created_at       timestamptz NOT NULL DEFAULT now(),
+  delivered_at     timestamptz,
+  CONSTRAINT fk_evd_sub FOREIGN KEY (subscription_id) REFERENCES event_subscriptions(id) ON DELETE CASCADE,
+  CONSTRAINT event_deliveries_status_check CHECK (status IN ('pending', 'delivered', 'failed'))
+);
+CREATE INDEX IF NOT EXISTS idx_event_deliveries_due ON event_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_event_deliveries_sub ON event_deliveries (subscription_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS event_deliveries;
+DROP TABLE IF EXISTS event_subscriptions;
@@ -0,0 +1,49 @@
+-- +goose Up
+-- チャンネルのトピック（/topic）
+ALTER TABLE channels ADD COLUMN IF NOT EXISTS topic varchar(250);
+
+-- メッセージの種別（NULL は通常投稿。/me は me_message）
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS subtype varchar(32);
+
+-- ワークスペース独自のスラッシュコマンド。呼び出すと url へ署名付きで POST する
+CREATE TABLE IF NOT EXISTS slash_commands (
+  id             uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  workspace_id   uuid NOT NULL,
+  command        varchar(32) NOT NULL,     -- 先頭の / を除いた小文字
+  url            text NOT NULL,
+  description    varchar(255),
+  usage_hint     varchar(255),
+  signing_secret varchar(128) NOT NULL,
+  bot_user_id    uuid NOT NULL,            -- in_channel の応答を投稿する bot
+  created_by     uuid,
+  created_at     timestamptz NOT NULL DEFAULT now(),
+  CONSTRAINT fk_slc_ws  FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+  CONSTRAINT fk_slc_bot FOREIGN KEY (bot_user_id)  REFERENCES users(id)      ON DELETE CASCADE,
+  CONSTRAINT fk_slc_by  FOREIGN KEY (created_by)   REFERENCES users(id)      ON DELETE SET NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS uq_slash_commands_ws_command ON slash_commands (workspace_id, command);
+
+-- /remind。remind_at を過ぎたらジョブが本人のルームへ通知する
+CREATE TABLE IF NOT EXISTS reminders (
+  id           uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  workspace_id uuid NOT NULL,
+  user_id      uuid NOT NULL,              -- 通知先
+  channel_id   uuid,                       -- 設定したチャンネル
+  text         text NOT NULL,
+  remind_at    timestamptz NOT NULL,
+  created_by   uuid,
+  created_at   timestamptz NOT NULL DEFAULT now(),
+  delivered_at timestamptz,
+  CONSTRAINT fk_rem_ws   FOREIGN KEY (workspace_id) REFERENCES workspaces(id) ON DELETE CASCADE,
+  CONSTRAINT fk_rem_user FOREIGN KEY (user_id)      REFERENCES users(id)      ON DELETE CASCADE,
+  CONSTRAINT fk_rem_ch   FOREIGN KEY (channel_id)   REFERENCES channels(id)   ON DELETE SET NULL,
+  CONSTRAINT fk_rem_by   FOREIGN KEY (created_by)   REFERENCES users(id)      ON DELETE SET NULL
+);
+CREATE INDEX IF NOT EXISTS idx_reminders_due ON reminders (remind_at) WHERE delivered_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_reminders_user ON reminders (user_id, remind_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS reminders;
+DROP TABLE IF EXISTS slash_commands;
+ALTER TABLE messages DROP COLUMN IF EXISTS subtype;
+ALTER TABLE channels DROP COLUMN IF EXISTS topic;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- rich: 本文（mrkdwn）を解析した AST。blocks: bot が送る Block Kit 風の構造（検証済み）
+ALTER TABLE messages
+  ADD COLUMN IF NOT EXISTS rich   jsonb,
+  ADD COLUMN IF NOT EXISTS blocks jsonb;
+
+-- +goose Down
+ALTER TABLE messages
+  DROP COLUMN IF EXISTS blocks,
+  DROP COLUMN IF EXISTS rich;
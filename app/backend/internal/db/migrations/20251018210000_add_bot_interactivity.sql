@@ -0,0 +1,10 @@
+-- +goose Up
+-- interaction_url: ボタン・セレクトが押されたときに署名付きで POST する先。signing_secret はその署名鍵
+ALTER TABLE bots
+  ADD COLUMN IF NOT EXISTS interaction_url text,
+  ADD COLUMN IF NOT EXISTS signing_secret  varchar(128);
+
+-- +goose Down
+ALTER TABLE bots
+  DROP COLUMN IF EXISTS signing_secret,
+  DROP COLUMN IF EXISTS interaction_url;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- 署名 URL を発行したがまだ /files/complete されていないアップロード。
+-- complete はここにある storage_key だけを受け付け、期限切れはジョブがオブジェクトごと消す
+CREATE TABLE IF NOT EXISTS pending_uploads (
+  id            uuid PRIMARY KEY,
+  uploader_id   uuid NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  purpose       text NOT NULL,
+  workspace_id  uuid REFERENCES workspaces(id) ON DELETE CASCADE,
+  channel_id    uuid REFERENCES channels(id) ON DELETE CASCADE,
+  storage_key   text NOT NULL UNIQUE,
+  filename      text NOT NULL,
+  content_type  text,
+  size_bytes    bigint,
+  created_at    timestamptz NOT NULL DEFAULT now(),
+  expires_at    timestamptz NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idx_pending_uploads_expires ON pending_uploads(expires_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS pending_uploads;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- storage_used_bytes: 登録済みの添付ファイルの合計（complete で加算）。storage_quota_bytes: NULL は既定（設定値）
+ALTER TABLE workspaces
+  ADD COLUMN IF NOT EXISTS storage_used_bytes  bigint NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS storage_quota_bytes bigint;
+
+UPDATE workspaces w SET storage_used_bytes = COALESCE((
+  SELECT SUM(f.size_bytes) FROM files f
+  WHERE f.workspace_id = w.id AND f.deleted_at IS NULL), 0);
+
+-- +goose Down
+ALTER TABLE workspaces
+  DROP COLUMN IF EXISTS storage_quota_bytes,
+  DROP COLUMN IF EXISTS storage_used_bytes;
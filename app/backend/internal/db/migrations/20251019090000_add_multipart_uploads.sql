@@ -0,0 +1,10 @@
+-- +goose Up
+-- マルチパートアップロードは upload_id（S3 の UploadId）と part_size を持つ
+ALTER TABLE pending_uploads
+  ADD COLUMN IF NOT EXISTS upload_id text,
+  ADD COLUMN IF NOT EXISTS part_size bigint;
+
+-- +goose Down
+ALTER TABLE pending_uploads
+  DROP COLUMN IF EXISTS part_size,
+  DROP COLUMN IF EXISTS upload_id;
@@ -0,0 +1,25 @@
+-- +goose Up
+-- 画像の後処理（メタデータ除去・サムネイル）。image_status: pending / processing / done / skipped / failed（画像以外は NULL）
+ALTER TABLE files
+  ADD COLUMN IF NOT EXISTS width             integer,
+  ADD COLUMN IF NOT EXISTS height            integer,
+  ADD COLUMN IF NOT EXISTS thumbnails        jsonb,
+  ADD COLUMN IF NOT EXISTS image_status      text,
+  ADD COLUMN IF NOT EXISTS image_attempts    integer NOT NULL DEFAULT 0,
+  ADD COLUMN IF NOT EXISTS image_lease_until timestamptz;
+
+CREATE INDEX IF NOT EXISTS idx_files_image_queue ON files(created_at)
+  WHERE image_status IN ('pending', 'processing');
+
+-- 既存の画像も処理する
+UPDATE files SET image_status = 'pending' WHERE is_image AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_files_image_queue;
+ALTER TABLE files
+  DROP COLUMN IF EXISTS image_lease_until,
+  DROP COLUMN IF EXISTS image_attempts,
+  DROP COLUMN IF EXISTS image_status,
+  DROP COLUMN IF EXISTS thumbnails,
+  DROP COLUMN IF EXISTS height,
+  DROP COLUMN IF EXISTS width;
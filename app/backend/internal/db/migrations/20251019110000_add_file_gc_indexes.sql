@@ -0,0 +1,10 @@
+-- +goose Up
+-- ファイルの GC（jobs.CollectOrphanFiles / PurgeDeletedFiles）用
+-- 添付されているかは file_id から引く（主キーは message_id が先頭なので使えない）
+CREATE INDEX IF NOT EXISTS idx_message_attachments_file ON message_attachments(file_id);
+-- 論理削除済みで purge を待つもの
+CREATE INDEX IF NOT EXISTS idx_files_deleted ON files(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_files_deleted;
+DROP INDEX IF EXISTS idx_message_attachments_file;
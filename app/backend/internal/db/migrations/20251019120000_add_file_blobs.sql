@@ -0,0 +1,23 @@
+-- +goose Up
+-- file_blobs: ワークスペース内で同じ内容（SHA-256）のファイルが共有するオブジェクト。
+-- ref_count は参照している files の行数（論理削除済みも含む）。0 になったら purge でオブジェクトごと消す
+CREATE TABLE IF NOT EXISTS file_blobs (
+  id            uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+  workspace_id  uuid NOT NULL REFERENCES workspaces(id) ON UPDATE CASCADE ON DELETE CASCADE,
+  sha256_hex    text NOT NULL,
+  storage_key   text NOT NULL UNIQUE,
+  size_bytes    bigint NOT NULL,
+  ref_count     integer NOT NULL DEFAULT 0,
+  created_at    timestamptz NOT NULL DEFAULT now(),
+  UNIQUE (workspace_id, sha256_hex)
+);
+
+-- 既存のファイルは blob_id なし（これまでどおり 1 ファイル 1 オブジェクト）
+ALTER TABLE files
+  ADD COLUMN IF NOT EXISTS blob_id uuid REFERENCES file_blobs(id) ON UPDATE CASCADE ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_files_blob ON files(blob_id) WHERE blob_id IS NOT NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_files_blob;
+ALTER TABLE files DROP COLUMN IF EXISTS blob_id;
+DROP TABLE IF EXISTS file_blobs;
@@ -0,0 +1,21 @@
+-- +goose Up
+-- files のウイルススキャン状態: pending_scan → clean / infected。
+-- 既存のファイルはスキャン前の仕組みでそのまま配っていたので clean とし、以降の行の既定を pending_scan にする
+ALTER TABLE files
+  ADD COLUMN IF NOT EXISTS scan_status text NOT NULL DEFAULT 'clean',
+  ADD COLUMN IF NOT EXISTS scan_signature text,
+  ADD COLUMN IF NOT EXISTS scanned_at timestamptz,
+  ADD COLUMN IF NOT EXISTS scan_lease_until timestamptz;
+ALTER TABLE files ALTER COLUMN scan_status SET DEFAULT 'pending_scan';
+
+-- jobs.ScanFiles の取り出し用
+CREATE INDEX IF NOT EXISTS idx_files_scan_pending ON files(created_at)
+  WHERE scan_status = 'pending_scan' AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_files_scan_pending;
+ALTER TABLE files
+  DROP COLUMN IF EXISTS scan_lease_until,
+  DROP COLUMN IF EXISTS scanned_at,
+  DROP COLUMN IF EXISTS scan_signature,
+  DROP COLUMN IF EXISTS scan_status;
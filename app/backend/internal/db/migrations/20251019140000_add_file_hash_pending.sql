@@ -0,0 +1,15 @@
+-- +goose Up
+-- complete で同期に SHA-256 を計算しない大きいファイルは hash_pending にして jobs.HashFiles が後で計算する
+ALTER TABLE files
+  ADD COLUMN IF NOT EXISTS hash_pending boolean NOT NULL DEFAULT false,
+  ADD COLUMN IF NOT EXISTS hash_lease_until timestamptz;
+
+-- jobs.HashFiles の取り出し用
+CREATE INDEX IF NOT EXISTS idx_files_hash_pending ON files(created_at)
+  WHERE hash_pending AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_files_hash_pending;
+ALTER TABLE files
+  DROP COLUMN IF EXISTS hash_lease_until,
+  DROP COLUMN IF EXISTS hash_pending;
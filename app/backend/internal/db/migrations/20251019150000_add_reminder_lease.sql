@@ -0,0 +1,9 @@
+-- +goose Up
+-- jobs.DeliverReminders は接続中の本人へ送れたときだけ delivered_at を入れる。
+-- 送れなかったものは lease が切れてから（再接続を待って）送り直す
+ALTER TABLE reminders
+  ADD COLUMN IF NOT EXISTS lease_until timestamptz;
+
+-- +goose Down
+ALTER TABLE reminders
+  DROP COLUMN IF EXISTS lease_until;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- jobs.ScanFiles の試行回数。上限まで判定できなかったファイルは scan_failed にして諦める
+ALTER TABLE files
+  ADD COLUMN IF NOT EXISTS scan_attempts integer NOT NULL DEFAULT 0;
+
+-- +goose Down
+ALTER TABLE files
+  DROP COLUMN IF EXISTS scan_attempts;
@@ -0,0 +1,261 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/model"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+const (
+	// MaxAttempts 回失敗した配信は failed にする（30s, 1m, 2m, ... でおよそ 1 時間）
+	MaxAttempts = 8
+	// DisableAfter 回連続で失敗した購読は自動で無効化する
+	DisableAfter = 25
+
+	baseBackoff = 30 * time.Second
+	maxBackoff  = time.Hour
+	// 取り出した行は lease の間ほかのワーカーから見えない（送信中に落ちたらその後に再送される）
+	lease     = 2 * time.Minute
+	batchSize = 50
+	workers   = 4
+)
+
+// NewHTTPClient は外部 URL（イベント配信・スラッシュコマンド・bot の interaction）へ送るクライアント。
+// リダイレクトは追わない（登録 URL 以外へ送らないため）。allowPrivate でなければ内部向けのアドレスへは接続しない
+func NewHTTPClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer.Control = guardPublic
+		// プロキシ経由だと接続先がプロキシになり判定できないので使わない
+		tr.Proxy = nil
+	}
+	tr.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: tr,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Deliverer は outbox から期限の来た配信を取り出して送る
+type Deliverer struct {
+	db     *gorm.DB
+	client *http.Client
+}
+
+func NewDeliverer(db *gorm.DB, client *http.Client) *Deliverer {
+	return &Deliverer{db: db, client: client}
+}
+
+// Backoff は attempts 回目の失敗後、次に送るまでの待ち時間（±10% の揺らぎ付き）
+func Backoff(attempts int) time.Duration {
+	d := baseBackoff
+	for i := 1; i < attempts && d < maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, maxBackoff)
+	jitter := time.Duration(rand.Int64N(int64(d)/5)) - d/10
+	return d + jitter
+}
+
+// Run は jobs.Every に渡す。期限の来た配信を batchSize 件まで送る
+func (d *Deliverer) Run(ctx context.Context) error {
+	var rows []model.EventDelivery
+	// 取り出しと同時に next_attempt_at を lease 分進め、並行ワーカーと二重送信しないようにする
+	if err := d.db.WithContext(ctx).Raw(`
+		UPDATE event_deliveries SET next_attempt_at = now() + ?::interval
+		WHERE id IN (
+			SELECT id FROM event_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED)
+		RETURNING *`, fmt.Sprintf("%d seconds", int(lease.Seconds())), batchSize).
+		Scan(&rows).Error; err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	subIDs := make([]uuid.UUID, 0, len(rows))
+	for _, r := range rows {
+		subIDs = append(subIDs, r.SubscriptionID)
+	}
+	var subs []model.EventSubscription
+	if err := d.db.WithContext(ctx).Where("id IN ?", subIDs).Find(&subs).Error; err != nil {
+		return err
+	}
+	byID := make(map[uuid.UUID]*model.EventSubscription, len(subs))
+	for i := range subs {
+		byID[subs[i].ID] = &subs[i]
+	}
+
+	queue := make(chan model.EventDelivery)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range queue {
+				d.deliver(ctx, byID[r.SubscriptionID], r)
+			}
+		}()
+	}
+	for _, r := range rows {
+		queue <- r
+	}
+	close(queue)
+	wg.Wait()
+	return nil
+}
+
+func (d *Deliverer) deliver(ctx context.Context, sub *model.EventSubscription, r model.EventDelivery) {
+	if sub == nil || sub.DisabledAt != nil {
+		if err := d.db.Model(&model.EventDelivery{}).Where("id = ?", r.ID).
+			Updates(map[string]any{"status": StatusFailed, "last_error": "subscription disabled"}).Error; err != nil {
+			log.Printf("[events] mark failed delivery=%s: %v", r.ID, err)
+		}
+		return
+	}
+
+	code, err := d.send(ctx, sub, r)
+	now := time.Now()
+	if err == nil {
+		// 書けなかったときは lease が切れた後に再送される（受け手は event_id で重複を除く）
+		if err := d.db.Model(&model.EventDelivery{}).Where("id = ?", r.ID).Updates(map[string]any{
+			"status":           StatusDelivered,
+			"attempts":         r.Attempts + 1,
+			"last_status_code": code,
+			"last_error":       nil,
+			"delivered_at":     now,
+		}).Error; err != nil {
+			log.Printf("[events] mark delivered delivery=%s: %v", r.ID, err)
+		}
+		if err := d.db.Model(&model.EventSubscription{}).
+			Where("id = ? AND consecutive_failures <> 0", sub.ID).
+			Update("consecutive_failures", 0).Error; err != nil {
+			log.Printf("[events] reset failures sub=%s: %v", sub.ID, err)
+		}
+		return
+	}
+	if ctx.Err() != nil {
+		return // 停止中。lease が切れたら再送される
+	}
+
+	attempts := r.Attempts + 1
+	upd := map[string]any{"attempts": attempts, "last_error": truncate(err.Error(), 500)}
+	if code != 0 {
+		upd["last_status_code"] = code
+	}
+	if attempts >= MaxAttempts {
+		upd["status"] = StatusFailed
+	} else {
+		upd["next_attempt_at"] = now.Add(Backoff(attempts))
+	}
+	if err := d.db.Model(&model.EventDelivery{}).Where("id = ?", r.ID).Updates(upd).Error; err != nil {
+		log.Printf("[events] schedule retry delivery=%s: %v", r.ID, err)
+	}
+
+	var failures int
+	if err := d.db.Raw(`
+		UPDATE event_subscriptions SET consecutive_failures = consecutive_failures + 1
+		WHERE id = ? RETURNING consecutive_failures`, sub.ID).Scan(&failures).Error; err != nil {
+		log.Printf("[events] count failure sub=%s: %v", sub.ID, err)
+		return
+	}
+	if failures >= DisableAfter {
+		if err := Disable(d.db, sub.ID, fmt.Sprintf("%d consecutive delivery failures", failures)); err != nil {
+			log.Printf("[events] disable sub=%s: %v", sub.ID, err)
+			return
+		}
+		log.Printf("[events] subscription %s disabled after %d consecutive failures", sub.ID, failures)
+	}
+}
+
+// Disable は購読を無効化し、未送信の配信を failed にする
+func Disable(db *gorm.DB, subID uuid.UUID, reason string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.EventSubscription{}).
+			Where("id = ? AND disabled_at IS NULL", subID).
+			Updates(map[string]any{"disabled_at": time.Now(), "disabled_reason": reason})
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return tx.Model(&model.EventDelivery{}).
+			Where("subscription_id = ? AND status = ?", subID, StatusPending).
+			Updates(map[string]any{"status": StatusFailed, "last_error": "subscription disabled"}).Error
+	})
+}
+
+// send は 1 件 POST する。2xx 以外はエラー（ステータスコードも返す）
+func (d *Deliverer) send(ctx context.Context, sub *model.EventSubscription, r model.EventDelivery) (int, error) {
+	resp, err := PostSigned(ctx, d.client, sub.URL, sub.SigningSecret, r.Payload, map[string]string{
+		HeaderEventID:  r.EventID.String(),
+		HeaderRetryNum: strconv.Itoa(r.Attempts),
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// PostSigned は署名ヘッダ付きで body を POST する（イベント配信・スラッシュコマンド転送で共通）
+func PostSigned(ctx context.Context, client *http.Client, url, secret string, body []byte, extra map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	ts := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "myslack-events/1")
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(secret, ts, body))
+	for k, v := range extra {
+		req.Header.Set(k, v)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		var ue interface{ Timeout() bool }
+		if errors.As(err, &ue) && ue.Timeout() {
+			return nil, errors.New("request timed out")
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n]
+}
@@ -0,0 +1,37 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"syscall"
+)
+
+// ErrPrivateAddress は外部 URL の名前解決結果が内部向けのアドレスだった
+var ErrPrivateAddress = errors.New("destination address is not allowed")
+
+// sharedAddressSpace は CGNAT（RFC 6598）。net.IP.IsPrivate には含まれない
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// guardPublic は net.Dialer.Control に渡す。名前解決した後の接続先で判定するので、
+// 外部のホスト名が 127.0.0.1 や 169.254.169.254（クラウドのメタデータ）を指していても弾ける
+func guardPublic(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, address)
+	}
+	if !publicAddr(ap.Addr().Unmap()) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, ap.Addr())
+	}
+	return nil
+}
+
+// publicAddr はインターネット上のユニキャストアドレスか（ループバック・RFC 1918 / ULA・リンクローカル・CGNAT などは false）
+func publicAddr(a netip.Addr) bool {
+	return a.IsValid() &&
+		a.IsGlobalUnicast() &&
+		!a.IsPrivate() &&
+		!a.IsLoopback() &&
+		!a.IsLinkLocalUnicast() &&
+		!sharedAddressSpace.Contains(a)
+}
@@ -0,0 +1,173 @@
+// Package events は外部サービスへのイベント配信（event subscriptions）。
+// イベントの元になった書き込みと同じ tx で Batch / Enqueue が event_deliveries（outbox）へ書く。
+// Deliverer が定期ジョブで outbox を読み、署名付き JSON を POST する（失敗時は指数バックオフで再送）。
+package events
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/model"
+	"slackgo/internal/ws"
+)
+
+// 配信できるイベント種別（hub の "type" と同じ）
+const (
+	TypeMessageCreated      = "message_created"
+	TypeMessageUpdated      = "message_updated"
+	TypeMessageDeleted      = "message_deleted"
+	TypeMemberJoinedChannel = "member_joined_channel"
+	TypeMemberLeftChannel   = "member_left_channel"
+	TypeChannelTopicChanged = "channel_topic_changed"
+	TypeChannelCreated      = "channel_created"
+	TypeUserUpdated         = "user_updated"
+)
+
+var Types = []string{
+	TypeMessageCreated, TypeMessageUpdated, TypeMessageDeleted,
+	TypeMemberJoinedChannel, TypeMemberLeftChannel, TypeChannelCreated, TypeChannelTopicChanged, TypeUserUpdated,
+}
+
+func ValidType(s string) bool { return slices.Contains(Types, s) }
+
+// Envelope は配信する JSON の外側
+type Envelope struct {
+	Type        string          `json:"type"` // "event_callback"
+	EventID     uuid.UUID       `json:"event_id"`
+	EventTime   int64           `json:"event_time"`
+	WorkspaceID uuid.UUID       `json:"workspace_id"`
+	Event       json.RawMessage `json:"event"`
+}
+
+// Batch は 1 つの書き込みで出るイベント。Add で書き込みと同じ tx の中で outbox に積み、
+// コミットした後に Broadcast で WebSocket へ流す（ロールバックした書き込みのイベントはどこにも出ない）
+type Batch struct {
+	items []batchItem
+}
+
+type batchItem struct {
+	room    string
+	payload []byte
+}
+
+// Add は ev を room 宛てのイベントとして tx で outbox に積み、Broadcast 用に覚えておく
+func (b *Batch) Add(tx *gorm.DB, room string, ev any) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	if err := Enqueue(tx, room, payload); err != nil {
+		return err
+	}
+	b.items = append(b.items, batchItem{room: room, payload: payload})
+	return nil
+}
+
+// AddWithOutbound は Add と同じだが、outbox（外部の購読先）へは ev の代わりに outbound を積む。
+// ワークスペースの中には見せても外へは出さない項目（連絡先など）を落とすときに使う
+func (b *Batch) AddWithOutbound(tx *gorm.DB, room string, ev, outbound any) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	out, err := json.Marshal(outbound)
+	if err != nil {
+		return err
+	}
+	if err := Enqueue(tx, room, out); err != nil {
+		return err
+	}
+	b.items = append(b.items, batchItem{room: room, payload: payload})
+	return nil
+}
+
+// Broadcast は積んだイベントを hub へ流す。tx のコミット後に呼ぶ
+func (b *Batch) Broadcast(hub *ws.Hub) {
+	for _, it := range b.items {
+		hub.Broadcast(it.room, it.payload)
+	}
+}
+
+// Enqueue は room 宛てのイベントを購読しているワークスペースの outbox に積む。
+// 元の書き込みと同じ tx で呼ぶこと（コミットされた書き込みのイベントだけが、取りこぼしなく配信される）
+func Enqueue(tx *gorm.DB, room string, payload []byte) error {
+	// 個人宛ルーム（mention 等）はワークスペース全体の購読者へは流さない
+	if strings.HasPrefix(room, "user:") {
+		return nil
+	}
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(payload, &head); err != nil || !ValidType(head.Type) {
+		return nil
+	}
+	wsID, ok, err := workspaceOf(tx, room)
+	if err != nil || !ok {
+		return err
+	}
+	return record(tx, wsID, head.Type, payload)
+}
+
+// workspaceOf はルーム名からワークスペースを求める。プライベートチャンネルのイベントは配信しない
+func workspaceOf(db *gorm.DB, room string) (uuid.UUID, bool, error) {
+	if id, found := strings.CutPrefix(room, "ws:"); found {
+		wsID, err := uuid.Parse(id)
+		return wsID, err == nil, nil
+	}
+	chID, err := uuid.Parse(room)
+	if err != nil {
+		return uuid.Nil, false, nil
+	}
+	var ch model.Channel
+	if err := db.Select("workspace_id", "is_private").First(&ch, "id = ?", chID).Error; err != nil {
+		return uuid.Nil, false, err
+	}
+	if ch.IsPrivate {
+		return uuid.Nil, false, nil
+	}
+	return ch.WorkspaceID, true, nil
+}
+
+// record は wsID の有効な購読のうち typ を購読しているものへ配信行を作る
+func record(db *gorm.DB, wsID uuid.UUID, typ string, event json.RawMessage) error {
+	var subIDs []uuid.UUID
+	if err := db.Model(&model.EventSubscription{}).
+		Where("workspace_id = ? AND disabled_at IS NULL AND verified_at IS NOT NULL", wsID).
+		Where("(' ' || event_types || ' ') LIKE ?", "% "+typ+" %").
+		Pluck("id", &subIDs).Error; err != nil {
+		return err
+	}
+	if len(subIDs) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	env := Envelope{
+		Type:        "event_callback",
+		EventID:     uuid.New(),
+		EventTime:   now.Unix(),
+		WorkspaceID: wsID,
+		Event:       event,
+	}
+	body, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	rows := make([]model.EventDelivery, 0, len(subIDs))
+	for _, id := range subIDs {
+		rows = append(rows, model.EventDelivery{
+			SubscriptionID: id,
+			EventID:        env.EventID,
+			EventType:      typ,
+			Payload:        body,
+			Status:         StatusPending,
+			NextAttemptAt:  now,
+		})
+	}
+	return db.Create(&rows).Error
+}
@@ -0,0 +1,41 @@
+package events
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// 配信リクエストのヘッダ
+const (
+	HeaderSignature = "X-Myslack-Signature"         // v0=<hex(HMAC-SHA256(secret, "v0:<ts>:<body>"))>
+	HeaderTimestamp = "X-Myslack-Request-Timestamp" // UNIX 秒
+	HeaderEventID   = "X-Myslack-Event-Id"
+	HeaderRetryNum  = "X-Myslack-Retry-Num" // 再送なら 1 以上
+)
+
+// MaxClockSkew を超えて古い（新しい）タイムスタンプは受信側で拒否すべき（リプレイ対策）
+const MaxClockSkew = 5 * time.Minute
+
+// Sign は署名ヘッダの値を返す
+func Sign(secret string, ts int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + strconv.FormatInt(ts, 10) + ":"))
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify は受信側での検証（テスト用スタンドインや利用者向けの参考実装）
+func Verify(secret, tsHeader, sigHeader string, body []byte, now time.Time) bool {
+	ts, err := strconv.ParseInt(tsHeader, 10, 64)
+	if err != nil {
+		return false
+	}
+	d := now.Sub(time.Unix(ts, 0))
+	if d > MaxClockSkew || d < -MaxClockSkew {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, ts, body)), []byte(sigHeader))
+}
@@ -0,0 +1,61 @@
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Sink は配信先のスタンドイン（cmd/eventsink や httptest から使う）。
+// 署名を検証し、url_verification には challenge を返し、event_callback を OnEvent に渡す
+type Sink struct {
+	Secret string
+	// OnEvent が error を返すと 500 を返す（再送の確認用）
+	OnEvent func(env Envelope, retryNum string) error
+}
+
+func (s *Sink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "read failed", http.StatusBadRequest)
+		return
+	}
+	if !Verify(s.Secret, r.Header.Get(HeaderTimestamp), r.Header.Get(HeaderSignature), body, time.Now()) {
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	var head struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+	}
+	if err := json.Unmarshal(body, &head); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	switch head.Type {
+	case "url_verification":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"challenge": head.Challenge})
+	case "event_callback":
+		var env Envelope
+		if err := json.Unmarshal(body, &env); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if s.OnEvent != nil {
+			if err := s.OnEvent(env, r.Header.Get(HeaderRetryNum)); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unknown type", http.StatusBadRequest)
+	}
+}
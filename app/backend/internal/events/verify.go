@@ -0,0 +1,56 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrVerificationFailed は URL 検証のハンドシェイクに失敗した
+var ErrVerificationFailed = errors.New("url verification failed")
+
+// URLVerification は登録時に送る検証リクエスト。受信側は challenge をそのまま返す
+type URLVerification struct {
+	Type      string `json:"type"` // "url_verification"
+	Challenge string `json:"challenge"`
+}
+
+// VerifyURL は url に署名付きの url_verification を送り、challenge が返ってくるか確かめる。
+// 応答は {"challenge": "..."} の JSON でも challenge だけのテキストでもよい
+func VerifyURL(ctx context.Context, client *http.Client, url, secret string) error {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	challenge := hex.EncodeToString(buf)
+	body, _ := json.Marshal(URLVerification{Type: "url_verification", Challenge: challenge})
+
+	resp, err := PostSigned(ctx, client, url, secret, body, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: endpoint returned %d", ErrVerificationFailed, resp.StatusCode)
+	}
+	got, err := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerificationFailed, err)
+	}
+	var out struct {
+		Challenge string `json:"challenge"`
+	}
+	if json.Unmarshal(got, &out) != nil {
+		out.Challenge = strings.TrimSpace(string(got))
+	}
+	if out.Challenge != challenge {
+		return fmt.Errorf("%w: challenge mismatch", ErrVerificationFailed)
+	}
+	return nil
+}
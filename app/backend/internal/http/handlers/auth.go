@@ -1,21 +1,27 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"slackgo/internal/auth"
+	"slackgo/internal/identity"
 	"slackgo/internal/model"
 )
 
 type AuthHandler struct {
-	db *gorm.DB
+	db       *gorm.DB
+	ids      *identity.Resolver
+	verifier auth.Verifier
 }
 
-func NewAuthHandler(db *gorm.DB) *AuthHandler {
-	return &AuthHandler{db: db}
+func NewAuthHandler(db *gorm.DB, ids *identity.Resolver, verifier auth.Verifier) *AuthHandler {
+	return &AuthHandler{db: db, ids: ids, verifier: verifier}
 }
 
 // Me godoc
@@ -58,3 +64,88 @@ func (h *AuthHandler) Bootstrap(c *gin.Context) {
 	log.Printf("[bootstrap] uid=%s body=%+v", uid, body)
 	c.Status(http.StatusNoContent)
 }
+
+// --- アカウント連携（複数 IdP） ---
+
+type LinkIdentityIn struct {
+	// 連携したい IdP で取得したアクセストークン（所有の証明）
+	Token string `json:"token" binding:"required"`
+}
+
+// ListIdentities godoc
+// @Summary  List identity provider accounts linked to me
+// @Tags     auth
+// @Produce  json
+// @Success  200 {array} model.UserIdentity
+// @Security Bearer
+// @Router   /auth/identities [get]
+func (h *AuthHandler) ListIdentities(c *gin.Context) {
+	rows, err := h.ids.List(uuid.MustParse(c.GetString("user_id")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+// LinkIdentity godoc
+// @Summary  Link another identity provider account to me (sign in with either afterwards)
+// @Tags     auth
+// @Accept   json
+// @Produce  json
+// @Param    body body LinkIdentityIn true "token issued by the other IdP"
+// @Success  200 {object} model.UserIdentity
+// @Failure  401 {object} map[string]string
+// @Failure  409 {object} map[string]string
+// @Security Bearer
+// @Router   /auth/identities [post]
+func (h *AuthHandler) LinkIdentity(c *gin.Context) {
+	var in LinkIdentityIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	claims, err := h.verifier.Verify(in.Token)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"detail": "invalid token"})
+		return
+	}
+	ident, err := h.ids.Link(uuid.MustParse(c.GetString("user_id")), claims)
+	if errors.Is(err, identity.ErrLinkedElsewhere) {
+		c.JSON(http.StatusConflict, gin.H{"detail": err.Error(), "code": "identity_linked_elsewhere"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "link failed"})
+		return
+	}
+	c.JSON(http.StatusOK, ident)
+}
+
+// UnlinkIdentity godoc
+// @Summary  Unlink an identity provider account (the last one cannot be removed)
+// @Tags     auth
+// @Param    identity_id path string true "Identity ID (UUID)"
+// @Success  204
+// @Failure  404 {object} map[string]string
+// @Failure  409 {object} map[string]string
+// @Security Bearer
+// @Router   /auth/identities/{identity_id} [delete]
+func (h *AuthHandler) UnlinkIdentity(c *gin.Context) {
+	identID, err := uuid.Parse(c.Param("identity_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid identity_id"})
+		return
+	}
+	err = h.ids.Unlink(uuid.MustParse(c.GetString("user_id")), identID)
+	switch {
+	case errors.Is(err, identity.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"detail": err.Error()})
+	case errors.Is(err, identity.ErrLastIdentity):
+		c.JSON(http.StatusConflict, gin.H{"detail": err.Error(), "code": "last_identity"})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "unlink failed"})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/config"
+	"slackgo/internal/imaging"
+	"slackgo/internal/model"
+	"slackgo/internal/storage"
+)
+
+// --- アバター画像の URL ---
+// 一覧の行ごとにストレージの署名 URL を作らず、API が HMAC で署名した /avatars/<file_id>?exp=&sig= を返す。
+// exp を ttl の区切りに揃えるので同じ時間帯なら同じ URL になり、ブラウザや CDN のキャッシュが効く。
+// URL を渡すのは持ち主とワークスペースを共有している人にだけ（GET /users/:id・メンバー一覧・自分・読めるチャンネルのメッセージの投稿者）
+
+type AvatarURLs struct {
+	secret  []byte
+	baseURL string
+	ttl     time.Duration
+}
+
+// NewAvatarURLs は専用の鍵（AVATAR_URL_SECRET）で作る。/avatars は認証なしなので、鍵が漏れると誰のアバターでも読める
+func NewAvatarURLs(secret, baseURL string, ttl time.Duration) (*AvatarURLs, error) {
+	if len(secret) < config.MinSecretBytes {
+		return nil, fmt.Errorf("AVATAR_URL_SECRET of at least %d bytes is required", config.MinSecretBytes)
+	}
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	return &AvatarURLs{secret: []byte(secret), baseURL: baseURL, ttl: ttl}, nil
+}
+
+func (a *AvatarURLs) mac(fileID string, exp int64) string {
+	m := hmac.New(sha256.New, a.secret)
+	fmt.Fprintf(m, "avatar\n%s\n%d", fileID, exp)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// URL は少なくとも ttl の間使える URL。サムネイルは &size=64 などを付ける（署名には含めない）
+func (a *AvatarURLs) URL(fileID uuid.UUID) string {
+	exp := time.Now().Truncate(a.ttl).Add(2 * a.ttl).Unix()
+	return fmt.Sprintf("%s/avatars/%s?exp=%d&sig=%s", a.baseURL, fileID, exp, a.mac(fileID.String(), exp))
+}
+
+// URLOf は fileID（未設定なら nil）の URL。一覧の行ごとに呼んでもストレージや DB には行かない
+func (a *AvatarURLs) URLOf(fileID *uuid.UUID) *string {
+	if a == nil || fileID == nil {
+		return nil
+	}
+	link := a.URL(*fileID)
+	return &link
+}
+
+// verify は署名と期限を確かめて期限を返す
+func (a *AvatarURLs) verify(fileID, exp, sig string) (time.Time, bool) {
+	n, err := strconv.ParseInt(exp, 10, 64)
+	if err != nil || !hmac.Equal([]byte(sig), []byte(a.mac(fileID, n))) {
+		return time.Time{}, false
+	}
+	t := time.Unix(n, 0)
+	return t, time.Now().Before(t)
+}
+
+type AvatarsHandler struct {
+	db    *gorm.DB
+	store storage.Store
+	urls  *AvatarURLs
+}
+
+func NewAvatarsHandler(db *gorm.DB, store storage.Store, urls *AvatarURLs) *AvatarsHandler {
+	return &AvatarsHandler{db: db, store: store, urls: urls}
+}
+
+// Get godoc
+// @Summary  Serve an avatar image from a signed avatar_url (no Authorization header; cacheable until exp)
+// @Tags     users
+// @Param    file_id path  string true  "File ID (UUID)"
+// @Param    exp     query int    true  "from avatar_url"
+// @Param    sig     query string true  "from avatar_url"
+// @Param    size    query int    false "thumbnail size (64, 360, 720)"
+// @Success  200
+// @Failure  403 {object} map[string]string
+// @Failure  404 {object} map[string]string
+// @Failure  409 {object} map[string]string
+// @Router   /avatars/{file_id} [get]
+func (h *AvatarsHandler) Get(c *gin.Context) {
+	// 失敗はキャッシュさせない（スキャン待ちなどは後で見えるようになる）
+	fail := func(status int, body gin.H) {
+		c.Header("Cache-Control", "no-store")
+		c.JSON(status, body)
+	}
+	fileID := c.Param("file_id")
+	exp, ok := h.urls.verify(fileID, c.Query("exp"), c.Query("sig"))
+	if !ok {
+		fail(http.StatusForbidden, gin.H{"detail": "invalid or expired avatar url", "code": "bad_signature"})
+		return
+	}
+	var f model.File
+	err := h.db.First(&f, "id = ? AND purpose = ?", fileID, "avatar").Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		fail(http.StatusNotFound, gin.H{"detail": "avatar not found"})
+		return
+	}
+	if err != nil {
+		fail(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return
+	}
+	switch {
+	case f.ScanStatus == model.ScanInfected:
+		fail(http.StatusForbidden, gin.H{"detail": "file is infected", "code": "file_infected"})
+		return
+	case f.ScanStatus == model.ScanSkipped:
+		// アバターは小さいので、調べていないものは出さない
+		fail(http.StatusForbidden, gin.H{"detail": "file is too large to be scanned", "code": "file_unscanned"})
+		return
+	case f.ScanStatus == model.ScanFailed:
+		fail(http.StatusForbidden, gin.H{"detail": "file could not be scanned", "code": "file_scan_failed"})
+		return
+	case f.ScanStatus != model.ScanClean:
+		fail(http.StatusConflict, gin.H{"detail": "file is still being scanned", "code": "scan_pending"})
+		return
+	case f.ImageStatus != nil && (*f.ImageStatus == model.ImagePending || *f.ImageStatus == model.ImageProcessing):
+		// メタデータを消す前の元画像を長くキャッシュさせない
+		fail(http.StatusConflict, gin.H{"detail": "image is still being processed", "code": "image_processing"})
+		return
+	}
+
+	key, ct, length := f.StorageKey, derefContentType(&f), derefInt64(f.SizeBytes)
+	if v := c.Query("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || !slices.Contains(imaging.Sizes, size) {
+			fail(http.StatusBadRequest, gin.H{"detail": "size must be one of the thumbnail sizes", "sizes": imaging.Sizes})
+			return
+		}
+		if t := f.Thumbnail(size); t != nil {
+			key, ct, length = t.StorageKey, t.ContentType, -1
+		}
+	}
+	r, err := h.store.Reader(c, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		fail(http.StatusNotFound, gin.H{"detail": "avatar not found"})
+		return
+	}
+	if err != nil {
+		fail(http.StatusBadGateway, gin.H{"detail": "storage read failed"})
+		return
+	}
+	defer r.Close()
+	if length == 0 {
+		length = -1
+	}
+	// URL ごとに中身は変わらない（アバターを変えると別の file_id になる）ので期限まで共有キャッシュしてよい
+	maxAge := int(time.Until(exp).Seconds())
+	c.DataFromReader(http.StatusOK, length, ct, r, map[string]string{
+		"Cache-Control":          fmt.Sprintf("public, max-age=%d, immutable", maxAge),
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+func derefContentType(f *model.File) string {
+	if f.ContentType == nil || *f.ContentType == "" {
+		return "application/octet-stream"
+	}
+	return *f.ContentType
+}
@@ -11,15 +11,24 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 
+	"slackgo/internal/authz"
+	"slackgo/internal/events"
 	"slackgo/internal/model"
+	"slackgo/internal/ws"
 )
 
 type ChannelsHandler struct {
-	db *gorm.DB
+	db  *gorm.DB
+	hub *ws.Hub
 }
 
-func NewChannelsHandler(db *gorm.DB) *ChannelsHandler {
-	return &ChannelsHandler{db: db}
+func NewChannelsHandler(db *gorm.DB, hub *ws.Hub) *ChannelsHandler {
+	return &ChannelsHandler{db: db, hub: hub}
+}
+
+// memberEvent は member_joined_channel / member_left_channel をチャンネルのルーム宛てに tx で積む
+func memberEvent(tx *gorm.DB, evs *events.Batch, typ string, chID, userID uuid.UUID) error {
+	return evs.Add(tx, chID.String(), map[string]any{"type": typ, "channel_id": chID, "user_id": userID})
 }
 
 type CreateChannelIn struct {
@@ -66,6 +75,11 @@ func (h *ChannelsHandler) Create(c *gin.Context) {
 		return
 	}
 
+	if role, _ := authz.ParseRole(c.GetString("workspace_role")); role.IsGuest() {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "guests cannot create channels"})
+		return
+	}
+
 	var in CreateChannelIn
 	if err := c.ShouldBindJSON(&in); err != nil {
 		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
@@ -78,6 +92,7 @@ func (h *ChannelsHandler) Create(c *gin.Context) {
 	}
 
 	var ch model.Channel
+	var evs events.Batch
 	txErr := h.db.Transaction(func(tx *gorm.DB) error {
 		// 1) channels へ INSERT
 		ch = model.Channel{
@@ -99,7 +114,12 @@ func (h *ChannelsHandler) Create(c *gin.Context) {
 		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&cm).Error; err != nil {
 			return err
 		}
-		return nil
+
+		// 3) プライベートチャンネルの存在はワークスペース全体に知らせない
+		if ch.IsPrivate {
+			return nil
+		}
+		return evs.Add(tx, ws.WorkspaceRoom(wsID.String()), map[string]any{"type": "channel_created", "channel": ch})
 	})
 
 	if txErr != nil {
@@ -118,6 +138,7 @@ func (h *ChannelsHandler) Create(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{"id": ch.ID.String()})
+	evs.Broadcast(h.hub)
 }
 
 type MemberCandidateRow struct {
@@ -207,13 +228,30 @@ type AddMemberIn struct {
 	Role string `json:"role" binding:"omitempty,oneof=owner member" example:"member"`
 }
 
-// 既存: AddMember（WSメンバーであることのチェックを入れていない場合は下のように強化）
+// AddMember godoc
+// @Summary  Add member to channel
+// @Tags     channels
+// @Accept   json
+// @Produce  json
+// @Param    channel_id path string true "Channel ID (UUID)"
+// @Param    body       body AddMemberIn true "member payload"
+// @Success  200 {object} map[string]bool "ok: true"
+// @Failure  403 {object} map[string]string
+// @Failure  409 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /channels/{channel_id}/members [post]
 func (h *ChannelsHandler) AddMember(c *gin.Context) {
-	chID := c.Param("channel_id")
-	if chID == "" {
+	chID, err := uuid.Parse(c.Param("channel_id"))
+	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"detail": "channel_id required"})
 		return
 	}
+	// ゲストは他人を招待できない
+	if role, _ := authz.ParseRole(c.GetString("workspace_role")); role.IsGuest() {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "guests cannot invite"})
+		return
+	}
 
 	var in AddMemberIn
 	if err := c.ShouldBindJSON(&in); err != nil {
@@ -222,19 +260,52 @@ func (h *ChannelsHandler) AddMember(c *gin.Context) {
 	}
 	role := in.Role
 	if role == "" {
-		role = "member"
+		role = authz.ChannelRoleMember
 	}
+	target := uuid.MustParse(in.UserID)
 
+	var evs events.Batch
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		added, err := addChannelMember(tx, chID, target, role)
+		if err != nil || !added {
+			return err
+		}
+		return memberEvent(tx, &evs, events.TypeMemberJoinedChannel, chID, target)
+	})
+	switch {
+	case errors.Is(err, authz.ErrSingleChannelGuestLimit):
+		c.JSON(http.StatusConflict, gin.H{"detail": err.Error(), "code": "single_channel_guest_limit"})
+	case errors.Is(err, errNotWorkspaceMember):
+		c.JSON(http.StatusForbidden, gin.H{"detail": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "add member failed"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+		evs.Broadcast(h.hub)
+	}
+}
+
+var errNotWorkspaceMember = errors.New("user is not a workspace member")
+
+// addChannelMember は target をチャンネルへ追加する（既に居れば何もしない）。
+// 対象が同じWSのメンバーであること、single_channel_guest は1チャンネルまでを確認する。
+// AddMember / ユーザーグループのデフォルトチャンネル等、招待系はすべてここを通す。
+// added は新たに追加されたか（既に居た場合 false）
+func addChannelMember(db *gorm.DB, chID, target uuid.UUID, role string) (added bool, err error) {
+	ok, err := authz.CheckChannelInvite(db, target, chID)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, errNotWorkspaceMember
+	}
 	rec := model.ChannelMember{
-		UserID:    uuid.MustParse(in.UserID),
-		ChannelID: uuid.MustParse(chID),
+		UserID:    target,
+		ChannelID: chID,
 		Role:      role,
 	}
-	if err := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rec).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"detail": "add member failed"})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"ok": true})
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rec)
+	return res.RowsAffected > 0, res.Error
 }
 
 func (h *ChannelsHandler) JoinSelf(c *gin.Context) {
@@ -246,40 +317,57 @@ func (h *ChannelsHandler) JoinSelf(c *gin.Context) {
 		return
 	}
 
+	uID, err1 := uuid.Parse(uid)
+	chUUID, err2 := uuid.Parse(chID)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "bad params"})
+		return
+	}
+
 	// チャンネルの存在＆WS一致＆公開かどうか確認
-	var ch struct {
-		ID          uuid.UUID
-		WorkspaceID uuid.UUID
-		IsPrivate   bool
+	a, err := authz.Channel(h.db, uID, chUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return
 	}
-	if err := h.db.
-		Table("channels").
-		Select("id, workspace_id, is_private").
-		Where("id = ?", chID).
-		Take(&ch).Error; err != nil {
+	if !a.Exists {
 		c.JSON(http.StatusNotFound, gin.H{"detail": "channel not found"})
 		return
 	}
-	if ch.WorkspaceID.String() != wsID {
+	if a.WorkspaceID.String() != wsID {
 		c.JSON(http.StatusForbidden, gin.H{"detail": "forbidden"})
 		return
 	}
-	if ch.IsPrivate {
+	if a.IsPrivate {
 		// 自己参加はNG。招待API(オーナー権限)でのみ追加させる
 		c.JSON(http.StatusForbidden, gin.H{"detail": "cannot self-join private channel"})
 		return
 	}
+	if !a.CanJoin() {
+		// ゲストは招待されたチャンネルのみ
+		c.JSON(http.StatusForbidden, gin.H{"detail": "guests cannot self-join channels"})
+		return
+	}
 
 	rec := model.ChannelMember{
-		UserID:    uuid.MustParse(uid),
-		ChannelID: uuid.MustParse(chID),
-		Role:      "member",
-	}
-	if err := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rec).Error; err != nil {
+		UserID:    uID,
+		ChannelID: chUUID,
+		Role:      authz.ChannelRoleMember,
+	}
+	var evs events.Batch
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rec)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return memberEvent(tx, &evs, events.TypeMemberJoinedChannel, chUUID, uID)
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"detail": "join failed"})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"ok": true})
+	evs.Broadcast(h.hub)
 }
 
 // ListByWorkspace godoc
@@ -300,31 +388,147 @@ func (h *ChannelsHandler) ListByWorkspace(c *gin.Context) {
 		return
 	}
 
-	// パブリック or 自分がメンバーのプライベート
+	// パブリック or 自分がメンバーのプライベート（ゲストは自分がメンバーのチャンネルのみ）
+	role, _ := authz.ParseRole(c.GetString("workspace_role"))
 	type row struct {
 		ID        uuid.UUID `json:"id"`
 		Name      string    `json:"name"`
 		IsPrivate bool      `json:"is_private"`
+		Topic     *string   `json:"topic,omitempty"`
 	}
 	var rows []row
-	if err := h.db.
+	q := h.db.
 		Table("channels c").
-		Select("c.id, c.name, c.is_private").
-		Where("c.workspace_id = ?", wsID).
-		Where(`
+		Select("c.id, c.name, c.is_private, c.topic").
+		Where("c.workspace_id = ?", wsID)
+	if role.IsGuest() {
+		q = q.Where(`EXISTS (
+			SELECT 1 FROM channel_members cm
+			WHERE cm.channel_id = c.id AND cm.user_id = ?
+            )`, uid)
+	} else {
+		q = q.Where(`
             c.is_private = false
             OR EXISTS (
 			SELECT 1 FROM channel_members cm
 			WHERE cm.channel_id = c.id AND cm.user_id = ?
-            )`, uid).
-		Order("c.name ASC").
-		Find(&rows).Error; err != nil {
+            )`, uid)
+	}
+	if err := q.Order("c.name ASC").Find(&rows).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
 		return
 	}
 	c.JSON(http.StatusOK, rows)
 }
 
+type SetTopicIn struct {
+	// 空文字でトピックを消す
+	Topic string `json:"topic" binding:"max=250" example:"Release planning"`
+}
+
+// SetTopic godoc
+// @Summary  Set channel topic (channel member)
+// @Tags     channels
+// @Accept   json
+// @Produce  json
+// @Param    channel_id path string true "Channel ID (UUID)"
+// @Param    body       body SetTopicIn true "topic"
+// @Success  200 {object} map[string]any
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /channels/{channel_id}/topic [put]
+func (h *ChannelsHandler) SetTopic(c *gin.Context) {
+	chID, err := uuid.Parse(c.Param("channel_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid channel_id"})
+		return
+	}
+	var in SetTopicIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	topic, err := h.setTopic(chID, uuid.MustParse(c.GetString("user_id")), in.Topic)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "set topic failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true, "topic": topic})
+}
+
+// setTopic はトピックを更新して channel_topic_changed を流す（REST と /topic で共通）
+func (h *ChannelsHandler) setTopic(chID, by uuid.UUID, topic string) (*string, error) {
+	trimmed := strings.TrimSpace(topic)
+	t := emptyToNil(&trimmed)
+	var evs events.Batch
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Channel{}).Where("id = ?", chID).Update("topic", t).Error; err != nil {
+			return err
+		}
+		ev := map[string]any{"type": "channel_topic_changed", "channel_id": chID, "topic": t, "user_id": by}
+		return evs.Add(tx, chID.String(), ev)
+	}); err != nil {
+		return nil, err
+	}
+	evs.Broadcast(h.hub)
+	return t, nil
+}
+
+// Leave godoc
+// @Summary  Leave channel
+// @Tags     channels
+// @Produce  json
+// @Param    channel_id path string true "Channel ID (UUID)"
+// @Success  200 {object} map[string]bool "ok: true"
+// @Security Bearer
+// @Router   /channels/{channel_id}/leave [post]
+func (h *ChannelsHandler) Leave(c *gin.Context) {
+	chID, err := uuid.Parse(c.Param("channel_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid channel_id"})
+		return
+	}
+	if _, err := h.leave(chID, uuid.MustParse(c.GetString("user_id"))); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "leave failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// leave は uid をチャンネルから外す（REST と /leave で共通）。removed は実際に外れたか
+func (h *ChannelsHandler) leave(chID, uid uuid.UUID) (removed bool, err error) {
+	var evs events.Batch
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Delete(&model.ChannelMember{}, "channel_id = ? AND user_id = ?", chID, uid)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		removed = true
+		return memberEvent(tx, &evs, events.TypeMemberLeftChannel, chID, uid)
+	})
+	if err != nil {
+		return false, err
+	}
+	evs.Broadcast(h.hub)
+	return removed, nil
+}
+
+// invite は target をチャンネルへ追加し、追加されたら member_joined_channel を流す（REST と /invite で共通）
+func (h *ChannelsHandler) invite(chID, target uuid.UUID) (added bool, err error) {
+	var evs events.Batch
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if added, err = addChannelMember(tx, chID, target, authz.ChannelRoleMember); err != nil || !added {
+			return err
+		}
+		return memberEvent(tx, &evs, events.TypeMemberJoinedChannel, chID, target)
+	})
+	if err != nil {
+		return false, err
+	}
+	evs.Broadcast(h.hub)
+	return added, nil
+}
+
 func (h *ChannelsHandler) IsMember(c *gin.Context) {
 	uidStr := c.GetString("user_id")
 	wsID := c.Param("ws_id") // WS付きルート互換
@@ -339,68 +543,41 @@ func (h *ChannelsHandler) IsMember(c *gin.Context) {
 		return
 	}
 
-	// チャンネル情報
-	var ch struct {
-		ID          uuid.UUID
-		WorkspaceID uuid.UUID
-		IsPrivate   bool
-		CreatedBy   *uuid.UUID
-	}
-	if err := h.db.
-		Table("channels").
-		Select("id, workspace_id, is_private, created_by").
-		Where("id = ?", chID).
-		Take(&ch).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"detail": "channel not found"})
+	chUUID, err := uuid.Parse(chID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "bad params"})
 		return
 	}
 
-	// WS付きルートでWS不一致は403
-	if wsID != "" && ch.WorkspaceID.String() != wsID {
-		c.JSON(http.StatusForbidden, gin.H{"detail": "forbidden"})
+	// チャンネル情報 + 権限
+	a, err := authz.Channel(h.db, uID, chUUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
 		return
 	}
-
-	// 作成者＝メンバー扱い
-	isOwner := ch.CreatedBy != nil && *ch.CreatedBy == uID
-
-	// channel_members
-	var chCnt int64
-	if err := h.db.Table("channel_members").
-		Where("channel_id = ? AND user_id = ?", ch.ID, uID).
-		Count(&chCnt).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+	if !a.Exists {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "channel not found"})
 		return
 	}
-	isChMember := chCnt > 0
 
-	// workspace_members
-	var wsCnt int64
-	if err := h.db.Table("workspace_members").
-		Where("workspace_id = ? AND user_id = ?", ch.WorkspaceID, uID).
-		Count(&wsCnt).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+	// WS付きルートでWS不一致は403
+	if wsID != "" && a.WorkspaceID.String() != wsID {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "forbidden"})
 		return
 	}
-	isWsMember := wsCnt > 0
 
-	// 読み取り/書き込み/メンバー判定
-	canRead := (!ch.IsPrivate && isWsMember) || (ch.IsPrivate && (isOwner || isChMember))
-	canPost := isOwner || isChMember
-	isMember := isOwner || isChMember
 	role := "none"
-	if isOwner {
-		role = "owner"
-	} else if isChMember {
-		role = "member"
+	if a.IsChannelMember() {
+		role = a.ChannelRole
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"is_member":  isMember,
-		"can_read":   canRead,
-		"can_post":   canPost,
-		"role":       role,
-		"is_private": ch.IsPrivate,
+		"is_member":      a.IsChannelMember(),
+		"can_read":       a.CanRead,
+		"can_post":       a.CanWrite,
+		"role":           role,
+		"workspace_role": a.WorkspaceRole,
+		"is_private":     a.IsPrivate,
 	})
 }
 
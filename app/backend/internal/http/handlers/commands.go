@@ -0,0 +1,789 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+
+	"slackgo/internal/authz"
+	"slackgo/internal/events"
+	"slackgo/internal/http/middleware"
+	"slackgo/internal/model"
+	"slackgo/internal/richtext"
+	"slackgo/internal/ws"
+)
+
+// --- スラッシュコマンド ---
+// 先頭が / の投稿は本文として保存せず、組み込みコマンドかワークスペース独自のコマンドへ回す。
+// 独自コマンドは登録 URL へ署名付きで POST し、応答を ephemeral（本人だけ）か in_channel で返す
+
+type CommandsHandler struct {
+	db     *gorm.DB
+	hub    *ws.Hub
+	msgs   *MessagesHandler
+	ch     *ChannelsHandler
+	client *http.Client
+}
+
+// NewCommandsHandler は msgs に自身を登録する（以後 msgs.Create が / で始まる投稿を回してくる）
+func NewCommandsHandler(db *gorm.DB, hub *ws.Hub, msgs *MessagesHandler, ch *ChannelsHandler, client *http.Client) *CommandsHandler {
+	h := &CommandsHandler{db: db, hub: hub, msgs: msgs, ch: ch, client: client}
+	if msgs != nil {
+		msgs.commands = h
+	}
+	return h
+}
+
+const (
+	ResponseEphemeral = "ephemeral"
+	ResponseInChannel = "in_channel"
+
+	// 外部コマンドの応答待ち
+	commandTimeout = 5 * time.Second
+)
+
+// CommandOut はコマンド実行時の POST /channels/{id}/messages の応答
+type CommandOut struct {
+	Command      string  `json:"command" example:"/topic"`
+	ResponseType string  `json:"response_type" example:"ephemeral"` // ephemeral / in_channel
+	Text         string  `json:"text,omitempty"`
+	Message      *MsgOut `json:"message,omitempty"` // in_channel で投稿されたメッセージ
+
+	sender *uuid.UUID // ephemeral の送り主（独自コマンドの bot）
+}
+
+type CommandInfo struct {
+	ID          *uuid.UUID `json:"id,omitempty"` // 独自コマンドのみ
+	Command     string     `json:"command" example:"/deploy"`
+	Description *string    `json:"description,omitempty"`
+	UsageHint   *string    `json:"usage_hint,omitempty"`
+	Builtin     bool       `json:"builtin"`
+}
+
+type CreateCommandIn struct {
+	Command     string  `json:"command" binding:"required,max=33" example:"deploy"`
+	URL         string  `json:"url" binding:"required,url,max=2048" example:"https://example.com/myslack/deploy"`
+	Description *string `json:"description" binding:"omitempty,max=255"`
+	UsageHint   *string `json:"usage_hint" binding:"omitempty,max=255" example:"[service] [env]"`
+	// 省略するとサーバーで生成する
+	SigningSecret *string `json:"signing_secret" binding:"omitempty,min=16,max=128"`
+}
+
+type CreatedCommandOut struct {
+	model.SlashCommand
+	// SigningSecret は作成時だけ返す
+	SigningSecret string `json:"signing_secret"`
+}
+
+// CommandPayload は独自コマンドの URL へ POST する JSON
+type CommandPayload struct {
+	Type        string     `json:"type"` // "slash_command"
+	Command     string     `json:"command"`
+	Text        string     `json:"text"`
+	WorkspaceID uuid.UUID  `json:"workspace_id"`
+	ChannelID   uuid.UUID  `json:"channel_id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	ParentID    *uuid.UUID `json:"parent_id,omitempty"`
+	TriggerID   uuid.UUID  `json:"trigger_id"`
+}
+
+// commandReply は外部コマンドの応答（空ボディなら何も表示しない）
+type commandReply struct {
+	ResponseType string          `json:"response_type"`
+	Text         string          `json:"text"`
+	Blocks       json.RawMessage `json:"blocks"` // in_channel のみ
+}
+
+var commandNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// parseCommand は "/name args" を分解する。"//" で始まる・名前として不正なものはコマンドではない
+func parseCommand(text string) (name, args string, ok bool) {
+	if !strings.HasPrefix(text, "/") || strings.HasPrefix(text, "//") {
+		return "", "", false
+	}
+	body := text[1:]
+	head, rest := body, ""
+	if i := strings.IndexFunc(body, unicode.IsSpace); i >= 0 {
+		head, rest = body[:i], body[i:]
+	}
+	name = strings.ToLower(head)
+	if !commandNameRe.MatchString(name) {
+		return "", "", false
+	}
+	return name, strings.TrimSpace(rest), true
+}
+
+// commandError はステータス付きで返すコマンドのエラー（使い方の誤り・権限不足など）
+type commandError struct {
+	status int
+	detail string
+	code   string
+}
+
+func (e *commandError) Error() string { return e.detail }
+
+func usageErr(format string, a ...any) error {
+	return &commandError{status: http.StatusUnprocessableEntity, detail: fmt.Sprintf(format, a...), code: "command_usage"}
+}
+
+type commandCtx struct {
+	c           *gin.Context
+	Name        string
+	Args        string
+	UserID      uuid.UUID
+	ChannelID   uuid.UUID
+	ChannelName string
+	WorkspaceID uuid.UUID
+	Role        authz.Role
+	ParentID    *string
+}
+
+func (cc *commandCtx) requireScope(scope string) error {
+	if !middleware.HasScope(cc.c, scope) {
+		return &commandError{status: http.StatusForbidden, detail: "missing scope: " + scope, code: "missing_scope"}
+	}
+	return nil
+}
+
+func ephemeral(format string, a ...any) CommandOut {
+	return CommandOut{ResponseType: ResponseEphemeral, Text: fmt.Sprintf(format, a...)}
+}
+
+// builtinCommands は組み込みコマンド（独自コマンドで同じ名前は登録できない）
+var builtinCommands = []CommandInfo{
+	{Builtin: true, Command: "/topic", UsageHint: strPtr("[text]"), Description: strPtr("Set or show the channel topic")},
+	{Builtin: true, Command: "/invite", UsageHint: strPtr("<@user_id> | email | @name | @group ..."), Description: strPtr("Invite people to this channel")},
+	{Builtin: true, Command: "/leave", Description: strPtr("Leave this channel")},
+	{Builtin: true, Command: "/remind", UsageHint: strPtr("me|<@user_id> in 10m|2h|1d|at 9:30 <text>, or list"), Description: strPtr("Set a reminder")},
+	{Builtin: true, Command: "/me", UsageHint: strPtr("<text>"), Description: strPtr("Post an action message")},
+	{Builtin: true, Command: "/shrug", UsageHint: strPtr("[text]"), Description: strPtr(`Append ¯\_(ツ)_/¯ to your message`)},
+}
+
+func isBuiltinCommand(name string) bool {
+	for _, b := range builtinCommands {
+		if b.Command == "/"+name {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *CommandsHandler) builtin(name string) (func(*commandCtx) (CommandOut, error), bool) {
+	switch name {
+	case "topic":
+		return h.cmdTopic, true
+	case "invite":
+		return h.cmdInvite, true
+	case "leave":
+		return h.cmdLeave, true
+	case "remind":
+		return h.cmdRemind, true
+	case "me":
+		return h.cmdMe, true
+	case "shrug":
+		return h.cmdShrug, true
+	}
+	return nil, false
+}
+
+// run は messages.Create から呼ばれる。チャンネルへの書き込み権限は middleware で確認済み
+func (h *CommandsHandler) run(c *gin.Context, name, args string, parentID *string) {
+	chID, err := uuid.Parse(c.Param("channel_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid channel_id"})
+		return
+	}
+	var ch model.Channel
+	if err := h.db.Select("id", "workspace_id", "name").First(&ch, "id = ?", chID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "channel not found"})
+		return
+	}
+	role, _ := authz.ParseRole(c.GetString("workspace_role"))
+	cc := &commandCtx{
+		c:           c,
+		Name:        name,
+		Args:        args,
+		UserID:      uuid.MustParse(c.GetString("user_id")),
+		ChannelID:   chID,
+		ChannelName: ch.Name,
+		WorkspaceID: ch.WorkspaceID,
+		Role:        role,
+		ParentID:    parentID,
+	}
+
+	var out CommandOut
+	if fn, ok := h.builtin(name); ok {
+		out, err = fn(cc)
+	} else {
+		out, err = h.runCustom(cc)
+	}
+	if err != nil {
+		var ce *commandError
+		if errors.As(err, &ce) {
+			c.JSON(ce.status, gin.H{"detail": ce.detail, "code": ce.code})
+			return
+		}
+		respondPostErr(c, err)
+		return
+	}
+	out.Command = "/" + name
+	if out.ResponseType == ResponseEphemeral && out.Text != "" {
+		e := EphemeralOut{ChannelID: cc.ChannelID, UserID: cc.UserID, SenderID: out.sender, Command: out.Command, Text: out.Text}
+		if parentID != nil {
+			if pid, err := uuid.Parse(*parentID); err == nil {
+				e.ParentID = &pid
+			}
+		}
+		sendEphemeral(h.hub, e)
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// ---- 組み込みコマンド ----
+
+func (h *CommandsHandler) cmdTopic(cc *commandCtx) (CommandOut, error) {
+	if cc.Args == "" {
+		var ch model.Channel
+		if err := h.db.Select("topic").First(&ch, "id = ?", cc.ChannelID).Error; err != nil {
+			return CommandOut{}, err
+		}
+		if ch.Topic == nil {
+			return ephemeral("This channel has no topic."), nil
+		}
+		return ephemeral("Topic: %s", *ch.Topic), nil
+	}
+	if err := cc.requireScope(authz.ScopeChannelsWrite); err != nil {
+		return CommandOut{}, err
+	}
+	if len([]rune(cc.Args)) > 250 {
+		return CommandOut{}, usageErr("topic must be at most 250 characters")
+	}
+	if _, err := h.ch.setTopic(cc.ChannelID, cc.UserID, cc.Args); err != nil {
+		return CommandOut{}, err
+	}
+	return ephemeral("Topic set to: %s", cc.Args), nil
+}
+
+func (h *CommandsHandler) cmdInvite(cc *commandCtx) (CommandOut, error) {
+	if err := cc.requireScope(authz.ScopeChannelsWrite); err != nil {
+		return CommandOut{}, err
+	}
+	if cc.Role.IsGuest() {
+		return CommandOut{}, &commandError{status: http.StatusForbidden, detail: "guests cannot invite"}
+	}
+	if cc.Args == "" {
+		return CommandOut{}, usageErr("usage: /invite <@user_id> | email | @name | @group ...")
+	}
+	targets, unknown, err := h.resolveInviteTargets(cc.WorkspaceID, strings.Fields(cc.Args))
+	if err != nil {
+		return CommandOut{}, err
+	}
+
+	var added, already int
+	failed := append([]string{}, unknown...)
+	for _, t := range targets {
+		ok, err := h.ch.invite(cc.ChannelID, t.id)
+		switch {
+		case errors.Is(err, authz.ErrSingleChannelGuestLimit), errors.Is(err, errNotWorkspaceMember):
+			failed = append(failed, t.label)
+		case err != nil:
+			return CommandOut{}, err
+		case ok:
+			added++
+		default:
+			already++
+		}
+	}
+
+	parts := []string{fmt.Sprintf("Invited %d to #%s.", added, cc.ChannelName)}
+	if already > 0 {
+		parts = append(parts, fmt.Sprintf("%d already in the channel.", already))
+	}
+	if len(failed) > 0 {
+		parts = append(parts, "Could not invite: "+strings.Join(failed, ", "))
+	}
+	return ephemeral("%s", strings.Join(parts, " ")), nil
+}
+
+type inviteTarget struct {
+	id    uuid.UUID
+	label string
+}
+
+// resolveInviteTargets は <@user_id> / email / @group / @display_name をユーザーへ解決する。
+// ワークスペース外の人は addChannelMember で弾かれる
+func (h *CommandsHandler) resolveInviteTargets(wsID uuid.UUID, tokens []string) ([]inviteTarget, []string, error) {
+	var out []inviteTarget
+	var unknown []string
+	seen := map[uuid.UUID]bool{}
+	add := func(id uuid.UUID, label string) {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, inviteTarget{id: id, label: label})
+		}
+	}
+	members := h.db.Table("workspace_members wm").
+		Joins("JOIN users u ON u.id = wm.user_id").
+		Where("wm.workspace_id = ?", wsID)
+
+	for _, tok := range tokens {
+		tok = strings.TrimRight(tok, ",")
+		if m := userMentionRe.FindStringSubmatch(tok); m != nil && m[0] == tok {
+			id, err := uuid.Parse(m[1])
+			if err != nil {
+				unknown = append(unknown, tok)
+				continue
+			}
+			add(id, tok)
+			continue
+		}
+
+		var ids []uuid.UUID
+		switch {
+		case strings.HasPrefix(tok, "@"):
+			handle := strings.ToLower(tok[1:])
+			// ユーザーグループを優先し、無ければ表示名（一意に決まる場合のみ）
+			if err := h.db.Table("user_group_members gm").
+				Joins("JOIN user_groups g ON g.id = gm.group_id").
+				Where("g.workspace_id = ? AND lower(g.handle) = ?", wsID, handle).
+				Pluck("gm.user_id", &ids).Error; err != nil {
+				return nil, nil, err
+			}
+			if len(ids) == 0 {
+				if err := members.Session(&gorm.Session{}).
+					Where("lower(u.display_name) = ?", handle).
+					Limit(2).Pluck("u.id", &ids).Error; err != nil {
+					return nil, nil, err
+				}
+				if len(ids) != 1 {
+					ids = nil
+				}
+			}
+		case strings.Contains(tok, "@"):
+			if err := members.Session(&gorm.Session{}).
+				Where("lower(u.email) = ?", strings.ToLower(tok)).
+				Pluck("u.id", &ids).Error; err != nil {
+				return nil, nil, err
+			}
+		}
+		if len(ids) == 0 {
+			unknown = append(unknown, tok)
+			continue
+		}
+		for _, id := range ids {
+			add(id, tok)
+		}
+	}
+	return out, unknown, nil
+}
+
+func (h *CommandsHandler) cmdLeave(cc *commandCtx) (CommandOut, error) {
+	if err := cc.requireScope(authz.ScopeChannelsWrite); err != nil {
+		return CommandOut{}, err
+	}
+	if _, err := h.ch.leave(cc.ChannelID, cc.UserID); err != nil {
+		return CommandOut{}, err
+	}
+	return ephemeral("You left #%s.", cc.ChannelName), nil
+}
+
+var (
+	remindInRe = regexp.MustCompile(`^(?i)in\s+(\d{1,4})\s*(m|mins?|minutes?|h|hours?|d|days?)\s+(.+)$`)
+	remindAtRe = regexp.MustCompile(`^(?i)at\s+(\d{1,2}):(\d{2})\s+(.+)$`)
+)
+
+const maxReminderAhead = 365 * 24 * time.Hour
+
+// cmdRemind: /remind me in 10m text, /remind <@user_id> at 9:30 text, /remind list
+func (h *CommandsHandler) cmdRemind(cc *commandCtx) (CommandOut, error) {
+	const usage = "usage: /remind me|<@user_id> in 10m|2h|1d <text>, /remind me at 9:30 <text>, or /remind list"
+	who, rest, _ := strings.Cut(cc.Args, " ")
+	rest = strings.TrimSpace(rest)
+
+	if strings.EqualFold(who, "list") {
+		return h.listReminders(cc)
+	}
+
+	target := cc.UserID
+	switch {
+	case strings.EqualFold(who, "me"):
+	case userMentionRe.MatchString(who):
+		id, err := uuid.Parse(userMentionRe.FindStringSubmatch(who)[1])
+		if err != nil {
+			return CommandOut{}, usageErr(usage)
+		}
+		if id != cc.UserID {
+			if cc.Role.IsGuest() {
+				return CommandOut{}, &commandError{status: http.StatusForbidden, detail: "guests cannot set reminders for others"}
+			}
+			role, err := authz.WorkspaceRole(h.db, id, cc.WorkspaceID)
+			if err != nil {
+				return CommandOut{}, err
+			}
+			if !role.IsMember() {
+				return CommandOut{}, usageErr("%s is not a member of this workspace", who)
+			}
+		}
+		target = id
+	default:
+		return CommandOut{}, usageErr(usage)
+	}
+
+	at, text, err := h.parseRemindWhen(cc.UserID, rest, time.Now())
+	if err != nil {
+		return CommandOut{}, usageErr("%s", err.Error()+"; "+usage)
+	}
+	rem := model.Reminder{
+		WorkspaceID: cc.WorkspaceID,
+		UserID:      target,
+		ChannelID:   &cc.ChannelID,
+		Text:        text,
+		RemindAt:    at,
+		CreatedBy:   &cc.UserID,
+	}
+	if target != cc.UserID {
+		// 相手が読めないチャンネル（非参加のプライベート等）は通知に載せない
+		ok, err := authz.CanReadChannel(h.db, target, cc.ChannelID)
+		if err != nil {
+			return CommandOut{}, err
+		}
+		if !ok {
+			rem.ChannelID = nil
+		}
+	}
+	if err := h.db.Create(&rem).Error; err != nil {
+		return CommandOut{}, err
+	}
+	whom := "you"
+	if target != cc.UserID {
+		whom = who
+	}
+	return ephemeral("I will remind %s at %s: %s", whom, at.Format(time.RFC3339), text), nil
+}
+
+// parseRemindWhen は "in 10m text" / "at 9:30 text" を解釈する。at は呼び出した人のタイムゾーン
+func (h *CommandsHandler) parseRemindWhen(userID uuid.UUID, s string, now time.Time) (time.Time, string, error) {
+	if m := remindInRe.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		unit := time.Minute
+		switch strings.ToLower(m[2])[0] {
+		case 'h':
+			unit = time.Hour
+		case 'd':
+			unit = 24 * time.Hour
+		}
+		d := time.Duration(n) * unit
+		if d <= 0 || d > maxReminderAhead {
+			return time.Time{}, "", errors.New("time must be within a year")
+		}
+		return now.Add(d), strings.TrimSpace(m[3]), nil
+	}
+	if m := remindAtRe.FindStringSubmatch(s); m != nil {
+		hh, _ := strconv.Atoi(m[1])
+		mm, _ := strconv.Atoi(m[2])
+		if hh > 23 || mm > 59 {
+			return time.Time{}, "", errors.New("invalid time of day")
+		}
+		loc := time.UTC
+		var tz *string
+		if err := h.db.Table("users").Select("timezone").Where("id = ?", userID).Row().Scan(&tz); err == nil && tz != nil {
+			if l, err := time.LoadLocation(*tz); err == nil {
+				loc = l
+			}
+		}
+		local := now.In(loc)
+		at := time.Date(local.Year(), local.Month(), local.Day(), hh, mm, 0, 0, loc)
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, strings.TrimSpace(m[3]), nil
+	}
+	return time.Time{}, "", errors.New("could not understand when")
+}
+
+func (h *CommandsHandler) listReminders(cc *commandCtx) (CommandOut, error) {
+	var rows []model.Reminder
+	if err := h.db.Where("user_id = ? AND workspace_id = ? AND delivered_at IS NULL", cc.UserID, cc.WorkspaceID).
+		Order("remind_at ASC").Limit(20).Find(&rows).Error; err != nil {
+		return CommandOut{}, err
+	}
+	if len(rows) == 0 {
+		return ephemeral("You have no upcoming reminders."), nil
+	}
+	lines := []string{"Upcoming reminders:"}
+	for _, r := range rows {
+		lines = append(lines, fmt.Sprintf("• %s %s", r.RemindAt.Format(time.RFC3339), r.Text))
+	}
+	return ephemeral("%s", strings.Join(lines, "\n")), nil
+}
+
+func (h *CommandsHandler) cmdMe(cc *commandCtx) (CommandOut, error) {
+	if cc.Args == "" {
+		return CommandOut{}, usageErr("usage: /me <text>")
+	}
+	return h.postInChannel(cc, cc.UserID, cc.Args, strPtr("me_message"))
+}
+
+func (h *CommandsHandler) cmdShrug(cc *commandCtx) (CommandOut, error) {
+	text := `¯\_(ツ)_/¯`
+	if cc.Args != "" {
+		text = cc.Args + " " + text
+	}
+	return h.postInChannel(cc, cc.UserID, text, nil)
+}
+
+func (h *CommandsHandler) postInChannel(cc *commandCtx, userID uuid.UUID, text string, subtype *string) (CommandOut, error) {
+	msg, err := h.msgs.post(postParams{
+		ChannelID: cc.ChannelID,
+		UserID:    userID,
+		Text:      text,
+		ParentID:  cc.ParentID,
+		Subtype:   subtype,
+	})
+	if err != nil {
+		return CommandOut{}, err
+	}
+	return CommandOut{ResponseType: ResponseInChannel, Message: &msg}, nil
+}
+
+// ---- 独自コマンド ----
+
+func (h *CommandsHandler) runCustom(cc *commandCtx) (CommandOut, error) {
+	var cmd model.SlashCommand
+	if err := h.db.First(&cmd, "workspace_id = ? AND command = ?", cc.WorkspaceID, cc.Name).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return CommandOut{}, &commandError{status: http.StatusNotFound, detail: "unknown command: /" + cc.Name, code: "unknown_command"}
+		}
+		return CommandOut{}, err
+	}
+
+	payload := CommandPayload{
+		Type:        "slash_command",
+		Command:     "/" + cmd.Command,
+		Text:        cc.Args,
+		WorkspaceID: cc.WorkspaceID,
+		ChannelID:   cc.ChannelID,
+		UserID:      cc.UserID,
+		TriggerID:   uuid.New(),
+	}
+	if cc.ParentID != nil {
+		if pid, err := uuid.Parse(*cc.ParentID); err == nil {
+			payload.ParentID = &pid
+		}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return CommandOut{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(cc.c.Request.Context(), commandTimeout)
+	defer cancel()
+	failed := &commandError{status: http.StatusBadGateway, detail: "/" + cmd.Command + " did not respond", code: "command_failed"}
+	resp, err := events.PostSigned(ctx, h.client, cmd.URL, cmd.SigningSecret, body, nil)
+	if err != nil {
+		return CommandOut{}, failed
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		failed.detail = fmt.Sprintf("/%s failed with status %d", cmd.Command, resp.StatusCode)
+		return CommandOut{}, failed
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return CommandOut{}, failed
+	}
+
+	var reply commandReply
+	if len(strings.TrimSpace(string(raw))) > 0 {
+		if json.Unmarshal(raw, &reply) != nil {
+			reply.Text = string(raw) // JSON でなければ本文をそのまま ephemeral で出す
+		}
+	}
+	if reply.Text == "" {
+		return CommandOut{ResponseType: ResponseEphemeral}, nil // 受け付けのみ
+	}
+	if reply.ResponseType != ResponseInChannel {
+		out := ephemeral("%s", reply.Text)
+		out.sender = &cmd.BotUserID
+		return out, nil
+	}
+
+	var blocks []richtext.Block
+	if hasBlocks(reply.Blocks) {
+		if blocks, err = richtext.ParseBlocks(reply.Blocks); err != nil {
+			failed.detail = "/" + cmd.Command + " returned invalid blocks: " + err.Error()
+			return CommandOut{}, failed
+		}
+	}
+
+	// in_channel はコマンドの bot として投稿する（未参加なら入れる）
+	if _, err := h.ch.invite(cc.ChannelID, cmd.BotUserID); err != nil {
+		return CommandOut{}, err
+	}
+	msg, err := h.msgs.post(postParams{
+		ChannelID: cc.ChannelID,
+		UserID:    cmd.BotUserID,
+		Text:      reply.Text,
+		ParentID:  cc.ParentID,
+		Blocks:    blocks,
+	})
+	if err != nil {
+		return CommandOut{}, err
+	}
+	return CommandOut{ResponseType: ResponseInChannel, Message: &msg}, nil
+}
+
+// List godoc
+// @Summary  List slash commands available in the workspace (built-in and custom)
+// @Tags     commands
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Success  200 {array} handlers.CommandInfo
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/commands [get]
+func (h *CommandsHandler) List(c *gin.Context) {
+	var rows []model.SlashCommand
+	if err := h.db.Where("workspace_id = ?", c.Param("ws_id")).Order("command ASC").Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
+		return
+	}
+	out := append([]CommandInfo{}, builtinCommands...)
+	for _, r := range rows {
+		out = append(out, CommandInfo{
+			ID:          &r.ID,
+			Command:     "/" + r.Command,
+			Description: r.Description,
+			UsageHint:   r.UsageHint,
+		})
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// Create godoc
+// @Summary  Register custom slash command (admin). The signing secret is shown only once
+// @Tags     commands
+// @Accept   json
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Param    body  body CreateCommandIn true "command"
+// @Success  200 {object} handlers.CreatedCommandOut
+// @Failure  409 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/commands [post]
+func (h *CommandsHandler) Create(c *gin.Context) {
+	wsID, err := uuid.Parse(c.Param("ws_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid ws_id"})
+		return
+	}
+	var in CreateCommandIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	name := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(in.Command), "/"))
+	if !commandNameRe.MatchString(name) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "command must be 1-32 chars of a-z, 0-9, _ and -"})
+		return
+	}
+	if isBuiltinCommand(name) {
+		c.JSON(http.StatusConflict, gin.H{"detail": "/" + name + " is a built-in command", "code": "command_conflict"})
+		return
+	}
+	if err := validateEventURL(in.URL); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	secret := ""
+	if in.SigningSecret != nil {
+		secret = *in.SigningSecret
+	} else if secret, err = newSigningSecret(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "create command failed"})
+		return
+	}
+
+	creator := uuid.MustParse(c.GetString("user_id"))
+	cmd := model.SlashCommand{
+		ID:            uuid.New(),
+		WorkspaceID:   wsID,
+		Command:       name,
+		URL:           in.URL,
+		Description:   emptyToNil(in.Description),
+		UsageHint:     emptyToNil(in.UsageHint),
+		SigningSecret: secret,
+		CreatedBy:     &creator,
+	}
+	// in_channel の応答を投稿する bot（名前はコマンド ID から決める）
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		bot, err := createBot(tx, wsID, "cmd-"+cmd.ID.String()[:8], strPtr("/"+name), creator)
+		if err != nil {
+			return err
+		}
+		cmd.BotUserID = bot.UserID
+		return tx.Create(&cmd).Error
+	})
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			c.JSON(http.StatusConflict, gin.H{"detail": "/" + name + " already exists", "code": "command_conflict"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "create command failed"})
+		return
+	}
+	c.JSON(http.StatusOK, CreatedCommandOut{SlashCommand: cmd, SigningSecret: secret})
+}
+
+// Delete godoc
+// @Summary  Delete custom slash command (admin). Its bot is deactivated
+// @Tags     commands
+// @Param    ws_id      path string true "Workspace ID (UUID)"
+// @Param    command_id path string true "Command ID (UUID)"
+// @Success  204
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/commands/{command_id} [delete]
+func (h *CommandsHandler) Delete(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("command_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid command_id"})
+		return
+	}
+	var cmd model.SlashCommand
+	if err := h.db.First(&cmd, "id = ? AND workspace_id = ?", id, c.Param("ws_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "command not found"})
+		return
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.SlashCommand{}, "id = ?", cmd.ID).Error; err != nil {
+			return err
+		}
+		var bot model.Bot
+		if err := tx.First(&bot, "user_id = ?", cmd.BotUserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		return deactivateBot(tx, &bot)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "delete failed"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
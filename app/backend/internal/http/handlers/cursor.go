@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// カーソルページング用の不透明トークン。
+// 並び順のキー（例: ソートキー, id）を JSON 配列にして base64url で包む。
+
+func encodeCursor(keys ...string) string {
+	b, _ := json.Marshal(keys)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeCursor は encodeCursor の逆。要素数が n と違えば ok=false
+func decodeCursor(s string, n int) ([]string, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, false
+	}
+	var keys []string
+	if err := json.Unmarshal(b, &keys); err != nil || len(keys) != n {
+		return nil, false
+	}
+	return keys, true
+}
+
+// likePrefix は LIKE 用に q をエスケープして前方一致パターンにする
+func likePrefix(q string) string {
+	r := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return r.Replace(strings.ToLower(q)) + "%"
+}
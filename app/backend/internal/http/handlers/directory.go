@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"slackgo/internal/authz"
+)
+
+// --- ワークスペースのメンバー一覧（ディレクトリ） ---
+
+type DirectoryMemberRow struct {
+	UserID       uuid.UUID  `json:"user_id"`
+	Email        *string    `json:"email,omitempty"`
+	DisplayName  *string    `json:"display_name,omitempty"`
+	Role         string     `json:"role"`
+	JoinedAt     time.Time  `json:"joined_at"`
+	AvatarFileID *uuid.UUID `json:"avatar_file_id,omitempty"`
+	AvatarURL    *string    `json:"avatar_url,omitempty"`
+}
+
+type DirectoryPage struct {
+	Members    []DirectoryMemberRow `json:"members"`
+	NextCursor *string              `json:"next_cursor,omitempty"`
+}
+
+// 並び順: 表示名（なければemail）の小文字 → user_id
+const directorySortKey = "lower(coalesce(u.display_name, u.email, ''))"
+
+// ListWorkspaceMembers godoc
+// @Summary  List workspace members (directory) with cursor pagination
+// @Tags     workspaces
+// @Produce  json
+// @Param    ws_id  path  string true  "Workspace ID (UUID)"
+// @Param    q      query string false "prefix of display_name or email"
+// @Param    role   query string false "owner|admin|member|multi_channel_guest|single_channel_guest|guest"
+// @Param    limit  query int    false "limit (max 100, default 50)"
+// @Param    cursor query string false "next_cursor from the previous page"
+// @Success  200 {object} handlers.DirectoryPage
+// @Failure  400 {object} map[string]string
+// @Failure  403 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/members [get]
+func (h *UsersHandler) ListWorkspaceMembers(c *gin.Context) {
+	uid := c.GetString("user_id")
+	wsID, err := uuid.Parse(c.Param("ws_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid ws_id"})
+		return
+	}
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		if n, err := parsePositiveInt(v, 1, 100); err == nil {
+			limit = n
+		}
+	}
+
+	q := h.db.Table("workspace_members wm").
+		Select(`u.id AS user_id, u.email, u.display_name, u.avatar_file_id,
+			wm.role, wm.created_at AS joined_at, `+directorySortKey+` AS sort_key`).
+		Joins("JOIN users u ON u.id = wm.user_id").
+		Where("wm.workspace_id = ?", wsID)
+
+	switch role := c.Query("role"); role {
+	case "":
+	case "guest":
+		q = q.Where("wm.role IN ?", []string{string(authz.RoleMultiChannelGuest), string(authz.RoleSingleChannelGuest)})
+	default:
+		if _, ok := authz.ParseRole(role); !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid role"})
+			return
+		}
+		q = q.Where("wm.role = ?", role)
+	}
+
+	if s := strings.TrimSpace(c.Query("q")); s != "" {
+		like := likePrefix(s)
+		q = q.Where(`(lower(u.display_name) LIKE ? ESCAPE '\' OR lower(u.email) LIKE ? ESCAPE '\')`, like, like)
+	}
+
+	// ゲストには同じチャンネルに居る相手（と自分）だけ見せる
+	if me, _ := authz.ParseRole(c.GetString("workspace_role")); me.IsGuest() {
+		q = q.Where(`(u.id = ? OR EXISTS (
+			SELECT 1 FROM channel_members a
+			JOIN channel_members b ON b.channel_id = a.channel_id
+			JOIN channels ch ON ch.id = a.channel_id
+			WHERE a.user_id = u.id AND b.user_id = ? AND ch.workspace_id = ?
+		))`, uid, uid, wsID)
+	}
+
+	if cur := c.Query("cursor"); cur != "" {
+		keys, ok := decodeCursor(cur, 2)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid cursor"})
+			return
+		}
+		q = q.Where("("+directorySortKey+", u.id) > (?, ?)", keys[0], keys[1])
+	}
+
+	type row struct {
+		DirectoryMemberRow
+		SortKey string
+	}
+	var rows []row
+	if err := q.Order("sort_key ASC, u.id ASC").Limit(limit + 1).Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
+		return
+	}
+
+	page := DirectoryPage{Members: make([]DirectoryMemberRow, 0, len(rows))}
+	if len(rows) > limit {
+		last := rows[limit-1]
+		next := encodeCursor(last.SortKey, last.UserID.String())
+		page.NextCursor = &next
+		rows = rows[:limit]
+	}
+	for _, r := range rows {
+		m := r.DirectoryMemberRow
+		m.AvatarURL = h.avatarURL(m.AvatarFileID)
+		page.Members = append(page.Members, m)
+	}
+	c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/authz"
+	"slackgo/internal/http/middleware"
+	"slackgo/internal/ws"
+)
+
+// --- ephemeral メッセージ（1 人にだけ見える。messages には保存しない） ---
+// 対象ユーザーがそのチャンネルを開いている WS 接続にだけ届く。接続が無ければ捨てられる
+
+type EphemeralHandler struct {
+	db  *gorm.DB
+	hub *ws.Hub
+}
+
+func NewEphemeralHandler(db *gorm.DB, hub *ws.Hub) *EphemeralHandler {
+	return &EphemeralHandler{db: db, hub: hub}
+}
+
+// EphemeralOut は WS の ephemeral_message イベントの中身
+type EphemeralOut struct {
+	ID        uuid.UUID  `json:"id"` // クライアントで消すとき用（保存はしない）
+	ChannelID uuid.UUID  `json:"channel_id"`
+	UserID    uuid.UUID  `json:"user_id"`             // 表示する相手
+	SenderID  *uuid.UUID `json:"sender_id,omitempty"` // bot など。システム通知は nil
+	Command   string     `json:"command,omitempty"`   // スラッシュコマンドの応答なら "/topic" など
+	ParentID  *uuid.UUID `json:"parent_id,omitempty"` // スレッド内に出す場合
+	Text      string     `json:"text"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type PostEphemeralIn struct {
+	UserID   string  `json:"user_id" binding:"required,uuid"`
+	Text     string  `json:"text" binding:"required,min=1,max=40000" example:"Only you can see this"`
+	ParentID *string `json:"parent_id" binding:"omitempty,uuid"`
+}
+
+// sendEphemeral は e を対象ユーザーのそのチャンネルの接続へ送る。届いた接続数を返す
+func sendEphemeral(hub *ws.Hub, e EphemeralOut) int {
+	if e.ID == uuid.Nil {
+		e.ID = uuid.New()
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	b, err := json.Marshal(map[string]any{"type": "ephemeral_message", "message": e})
+	if err != nil {
+		return 0
+	}
+	return hub.BroadcastToUser(e.ChannelID.String(), e.UserID.String(), b)
+}
+
+// Post godoc
+// @Summary  Send an ephemeral message to one user in the channel (bot tokens only). Not stored
+// @Tags     messages
+// @Accept   json
+// @Produce  json
+// @Param    channel_id path string true "Channel ID (UUID)"
+// @Param    body       body PostEphemeralIn true "message"
+// @Success  200 {object} map[string]any "ok, message_id, delivered (number of connections)"
+// @Failure  403 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /channels/{channel_id}/ephemeral [post]
+func (h *EphemeralHandler) Post(c *gin.Context) {
+	if c.GetString("auth_kind") != middleware.AuthKindBot {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "bot token required", "code": "bot_token_required"})
+		return
+	}
+	chID, err := uuid.Parse(c.Param("channel_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid channel_id"})
+		return
+	}
+	var in PostEphemeralIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	target := uuid.MustParse(in.UserID)
+
+	// チャンネルを読めない相手には送らない（プライベートの非メンバー等）
+	ok, err := authz.CanReadChannel(h.db, target, chID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "user cannot see this channel", "code": "user_not_in_channel"})
+		return
+	}
+
+	sender := uuid.MustParse(c.GetString("user_id"))
+	e := EphemeralOut{
+		ID:        uuid.New(),
+		ChannelID: chID,
+		UserID:    target,
+		SenderID:  &sender,
+		Text:      in.Text,
+	}
+	if in.ParentID != nil {
+		pid := uuid.MustParse(*in.ParentID)
+		e.ParentID = &pid
+	}
+	n := sendEphemeral(h.hub, e)
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message_id": e.ID, "delivered": n})
+}
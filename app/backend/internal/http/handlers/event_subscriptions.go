@@ -0,0 +1,378 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/events"
+	"slackgo/internal/model"
+)
+
+// --- イベント購読（外部 URL への署名付き配信。管理は admin のみ） ---
+
+type EventSubscriptionsHandler struct {
+	db     *gorm.DB
+	client *http.Client
+}
+
+func NewEventSubscriptionsHandler(db *gorm.DB, client *http.Client) *EventSubscriptionsHandler {
+	return &EventSubscriptionsHandler{db: db, client: client}
+}
+
+type CreateEventSubscriptionIn struct {
+	Name       string   `json:"name" binding:"required,max=80" example:"ci-notifier"`
+	URL        string   `json:"url" binding:"required,url,max=2048" example:"https://example.com/myslack/events"`
+	EventTypes []string `json:"event_types" binding:"required,min=1" example:"message_created"`
+	// 省略するとサーバーで生成する。受信側で URL 検証の署名を確かめたい場合は先に決めて渡す
+	SigningSecret *string `json:"signing_secret" binding:"omitempty,min=16,max=128"`
+}
+
+type UpdateEventSubscriptionIn struct {
+	Name       *string  `json:"name" binding:"omitempty,max=80"`
+	URL        *string  `json:"url" binding:"omitempty,url,max=2048"`
+	EventTypes []string `json:"event_types" binding:"omitempty,min=1"`
+}
+
+type EventSubscriptionSecretOut struct {
+	model.EventSubscription
+	// SigningSecret は作成時とローテーション時だけ返す
+	SigningSecret string `json:"signing_secret"`
+}
+
+// validateEventURL は http(s) の絶対 URL だけ許す
+func validateEventURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http(s) URL")
+	}
+	return nil
+}
+
+// normalizeEventTypes は重複を除いて空白区切りにする
+func normalizeEventTypes(in []string) (string, error) {
+	out := []string{}
+	for _, t := range in {
+		t = strings.TrimSpace(t)
+		if !events.ValidType(t) {
+			return "", errors.New("unknown event type: " + t)
+		}
+		if !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+	return strings.Join(out, " "), nil
+}
+
+func newSigningSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// verify は URL 検証を行い、成功なら verified_at を更新する
+func (h *EventSubscriptionsHandler) verify(ctx context.Context, sub *model.EventSubscription) error {
+	ctx, cancel := context.WithTimeout(ctx, 15*time.Second)
+	defer cancel()
+	if err := events.VerifyURL(ctx, h.client, sub.URL, sub.SigningSecret); err != nil {
+		return err
+	}
+	now := time.Now()
+	sub.VerifiedAt = &now
+	return nil
+}
+
+func (h *EventSubscriptionsHandler) load(c *gin.Context) (*model.EventSubscription, bool) {
+	id, err := uuid.Parse(c.Param("subscription_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid subscription_id"})
+		return nil, false
+	}
+	var sub model.EventSubscription
+	if err := h.db.First(&sub, "id = ? AND workspace_id = ?", id, c.Param("ws_id")).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"detail": "subscription not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return nil, false
+	}
+	return &sub, true
+}
+
+// List godoc
+// @Summary  List event subscriptions of the workspace (admin)
+// @Tags     events
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Success  200 {array} model.EventSubscription
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/event-subscriptions [get]
+func (h *EventSubscriptionsHandler) List(c *gin.Context) {
+	rows := []model.EventSubscription{}
+	if err := h.db.Where("workspace_id = ?", c.Param("ws_id")).
+		Order("created_at ASC").Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+// Create godoc
+// @Summary  Create event subscription (admin). The URL must answer the url_verification challenge
+// @Tags     events
+// @Accept   json
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Param    body  body CreateEventSubscriptionIn true "subscription"
+// @Success  200 {object} handlers.EventSubscriptionSecretOut
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/event-subscriptions [post]
+func (h *EventSubscriptionsHandler) Create(c *gin.Context) {
+	wsID, err := uuid.Parse(c.Param("ws_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid ws_id"})
+		return
+	}
+	var in CreateEventSubscriptionIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "name must not be empty"})
+		return
+	}
+	if err := validateEventURL(in.URL); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	types, err := normalizeEventTypes(in.EventTypes)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	secret := ""
+	if in.SigningSecret != nil {
+		secret = *in.SigningSecret
+	} else if secret, err = newSigningSecret(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "create failed"})
+		return
+	}
+
+	creator := uuid.MustParse(c.GetString("user_id"))
+	sub := model.EventSubscription{
+		WorkspaceID:   wsID,
+		Name:          name,
+		URL:           in.URL,
+		EventTypes:    types,
+		SigningSecret: secret,
+		CreatedBy:     &creator,
+	}
+	if err := h.verify(c.Request.Context(), &sub); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error(), "code": "url_verification_failed"})
+		return
+	}
+	if err := h.db.Create(&sub).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "create failed"})
+		return
+	}
+	c.JSON(http.StatusOK, EventSubscriptionSecretOut{EventSubscription: sub, SigningSecret: secret})
+}
+
+// Update godoc
+// @Summary  Update event subscription (admin). Changing the URL re-runs url_verification
+// @Tags     events
+// @Accept   json
+// @Produce  json
+// @Param    ws_id           path string true "Workspace ID (UUID)"
+// @Param    subscription_id path string true "Subscription ID (UUID)"
+// @Param    body            body UpdateEventSubscriptionIn true "fields to update"
+// @Success  200 {object} model.EventSubscription
+// @Failure  404 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/event-subscriptions/{subscription_id} [patch]
+func (h *EventSubscriptionsHandler) Update(c *gin.Context) {
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+	var in UpdateEventSubscriptionIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	upd := map[string]any{}
+	if in.Name != nil {
+		name := strings.TrimSpace(*in.Name)
+		if name == "" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "name must not be empty"})
+			return
+		}
+		upd["name"] = name
+	}
+	if in.EventTypes != nil {
+		types, err := normalizeEventTypes(in.EventTypes)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+			return
+		}
+		upd["event_types"] = types
+	}
+	if in.URL != nil && *in.URL != sub.URL {
+		if err := validateEventURL(*in.URL); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+			return
+		}
+		sub.URL = *in.URL
+		if err := h.verify(c.Request.Context(), sub); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error(), "code": "url_verification_failed"})
+			return
+		}
+		upd["url"] = sub.URL
+		upd["verified_at"] = sub.VerifiedAt
+	}
+	if len(upd) > 0 {
+		if err := h.db.Model(sub).Updates(upd).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"detail": "update failed"})
+			return
+		}
+	}
+	h.db.First(sub, "id = ?", sub.ID)
+	c.JSON(http.StatusOK, sub)
+}
+
+// Delete godoc
+// @Summary  Delete event subscription (admin). Pending deliveries are dropped
+// @Tags     events
+// @Param    ws_id           path string true "Workspace ID (UUID)"
+// @Param    subscription_id path string true "Subscription ID (UUID)"
+// @Success  204
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/event-subscriptions/{subscription_id} [delete]
+func (h *EventSubscriptionsHandler) Delete(c *gin.Context) {
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+	if err := h.db.Delete(&model.EventSubscription{}, "id = ?", sub.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "delete failed"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// RotateSecret godoc
+// @Summary  Rotate signing secret (admin). The new secret is shown only once
+// @Tags     events
+// @Produce  json
+// @Param    ws_id           path string true "Workspace ID (UUID)"
+// @Param    subscription_id path string true "Subscription ID (UUID)"
+// @Success  200 {object} handlers.EventSubscriptionSecretOut
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/event-subscriptions/{subscription_id}/rotate-secret [post]
+func (h *EventSubscriptionsHandler) RotateSecret(c *gin.Context) {
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+	secret, err := newSigningSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "rotate failed"})
+		return
+	}
+	if err := h.db.Model(sub).Update("signing_secret", secret).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "rotate failed"})
+		return
+	}
+	c.JSON(http.StatusOK, EventSubscriptionSecretOut{EventSubscription: *sub, SigningSecret: secret})
+}
+
+// Enable godoc
+// @Summary  Re-enable a disabled subscription (admin). Runs url_verification again
+// @Tags     events
+// @Produce  json
+// @Param    ws_id           path string true "Workspace ID (UUID)"
+// @Param    subscription_id path string true "Subscription ID (UUID)"
+// @Success  200 {object} model.EventSubscription
+// @Failure  404 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/event-subscriptions/{subscription_id}/enable [post]
+func (h *EventSubscriptionsHandler) Enable(c *gin.Context) {
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+	if err := h.verify(c.Request.Context(), sub); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error(), "code": "url_verification_failed"})
+		return
+	}
+	if err := h.db.Model(sub).Updates(map[string]any{
+		"verified_at":          sub.VerifiedAt,
+		"disabled_at":          nil,
+		"disabled_reason":      nil,
+		"consecutive_failures": 0,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "enable failed"})
+		return
+	}
+	h.db.First(sub, "id = ?", sub.ID)
+	c.JSON(http.StatusOK, sub)
+}
+
+// ListDeliveries godoc
+// @Summary  List recent deliveries of the subscription (admin, newest first)
+// @Tags     events
+// @Produce  json
+// @Param    ws_id           path  string true  "Workspace ID (UUID)"
+// @Param    subscription_id path  string true  "Subscription ID (UUID)"
+// @Param    status          query string false "pending / delivered / failed"
+// @Param    limit           query int    false "max rows (default 50, max 200)"
+// @Success  200 {array} model.EventDelivery
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/event-subscriptions/{subscription_id}/deliveries [get]
+func (h *EventSubscriptionsHandler) ListDeliveries(c *gin.Context) {
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+	limit := 50
+	if v, err := strconv.Atoi(c.Query("limit")); err == nil && v > 0 {
+		limit = min(v, 200)
+	}
+	q := h.db.Where("subscription_id = ?", sub.ID)
+	switch st := c.Query("status"); st {
+	case "":
+	case events.StatusPending, events.StatusDelivered, events.StatusFailed:
+		q = q.Where("status = ?", st)
+	default:
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "invalid status"})
+		return
+	}
+	rows := []model.EventDelivery{}
+	if err := q.Order("created_at DESC").Limit(limit).Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
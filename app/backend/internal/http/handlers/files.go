@@ -1,31 +1,39 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-	"net/url"
 	"path"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
+	"slackgo/internal/authz"
+	"slackgo/internal/imaging"
 	"slackgo/internal/model"
 	"slackgo/internal/storage"
+	"slackgo/internal/ws"
 )
 
 type FilesHandler struct {
-	db *gorm.DB
-	s3 *storage.S3Deps
+	db     *gorm.DB
+	store  storage.Store
+	hub    *ws.Hub
+	policy storage.UploadPolicy
 }
 
-func NewFilesHandler(db *gorm.DB, s3deps *storage.S3Deps) *FilesHandler {
-	return &FilesHandler{db: db, s3: s3deps}
+func NewFilesHandler(db *gorm.DB, store storage.Store, hub *ws.Hub, policy storage.UploadPolicy) *FilesHandler {
+	return &FilesHandler{db: db, store: store, hub: hub, policy: policy}
 }
 
 // ========= 署名URL用のキー生成 =========
@@ -36,47 +44,109 @@ func (h *FilesHandler) safeName(filename string) string {
 
 // メッセージ添付（WS/CH配下）
 func (h *FilesHandler) keyForMessage(wsID, chID, fileID, filename string) string {
-	return path.Join(h.s3.Prefix, "ws", wsID, "ch", chID, fmt.Sprintf("%s_%s", fileID, h.safeName(filename)))
+	return path.Join(h.store.KeyPrefix(), "ws", wsID, "ch", chID, fmt.Sprintf("%s_%s", fileID, h.safeName(filename)))
 }
 
 // アバター（user配下）
 func (h *FilesHandler) keyForAvatar(userID, fileID, filename string) string {
-	return path.Join(h.s3.Prefix, "avatars", userID, fmt.Sprintf("%s_%s", fileID, h.safeName(filename)))
+	return path.Join(h.store.KeyPrefix(), "avatars", userID, fmt.Sprintf("%s_%s", fileID, h.safeName(filename)))
 }
 
-// ========= サイン発行（メッセージ添付） =========
-// POST /workspaces/:ws_id/channels/:channel_id/files/sign-upload
-func (h *FilesHandler) SignUploadMessage(c *gin.Context) {
-	uid := c.GetString("user_id")
-	if uid == "" {
-		c.AbortWithStatus(http.StatusUnauthorized)
-		return
+// pendingUploadGrace は署名 URL の期限が切れてから complete を待つ時間
+const pendingUploadGrace = time.Hour
+
+// maxSinglePutBytes は 1 回の PUT で送れる上限（S3 の制限）。これより大きいものはマルチパートで
+const maxSinglePutBytes = 5 << 30
+
+// respondPolicyErr は storage.UploadPolicy の違反を 413 / 415 / 422 で返す
+func (h *FilesHandler) respondPolicyErr(c *gin.Context, purpose string, err error) {
+	l := h.policy.Limits[purpose]
+	switch {
+	case errors.Is(err, storage.ErrTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"detail": err.Error(), "code": "file_too_large", "max_bytes": l.MaxBytes})
+	case errors.Is(err, storage.ErrUnsupportedType):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"detail": err.Error(), "code": "unsupported_media_type", "allowed_types": l.AllowedTypes})
+	case errors.Is(err, storage.ErrSizeRequired):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error(), "code": "size_required"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
 	}
-	wsID := c.Param("ws_id")
-	chID := c.Param("channel_id")
+}
 
-	var body struct {
-		Filename    string `json:"filename"`
-		ContentType string `json:"content_type"`
-		SizeBytes   int64  `json:"size_bytes"`
+// errQuotaExceeded はワークスペースの容量超過（used / quota は応答に載せる）
+type errQuotaExceeded struct{ used, quota int64 }
+
+func (e *errQuotaExceeded) Error() string { return "workspace storage quota exceeded" }
+
+// reserveQuota は使用量 + 未完了のアップロード + size が上限に収まるか確かめる。
+// 同時に署名されても超えないよう、ワークスペース行をロックした tx の中で呼ぶ
+func (h *FilesHandler) reserveQuota(tx *gorm.DB, wsID uuid.UUID, size int64) error {
+	var ws model.Workspace
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&ws, "id = ?", wsID).Error; err != nil {
+		return err
 	}
-	if err := c.BindJSON(&body); err != nil || strings.TrimSpace(body.Filename) == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"detail": "bad body"})
-		return
+	quota := h.policy.WorkspaceQuota
+	if ws.StorageQuotaBytes != nil {
+		quota = *ws.StorageQuotaBytes
+	}
+	if quota <= 0 {
+		return nil
 	}
+	var pending int64
+	if err := tx.Model(&model.PendingUpload{}).
+		Where("workspace_id = ? AND expires_at > now()", wsID).
+		Select("COALESCE(SUM(size_bytes), 0)").Scan(&pending).Error; err != nil {
+		return err
+	}
+	if ws.StorageUsedBytes+pending+size > quota {
+		return &errQuotaExceeded{used: ws.StorageUsedBytes + pending, quota: quota}
+	}
+	return nil
+}
 
-	fileID := uuid.New().String()
-	key := h.keyForMessage(wsID, chID, fileID, body.Filename)
+// reserve は容量を確かめて pending_uploads に記録する。失敗時は応答して false
+func (h *FilesHandler) reserve(c *gin.Context, p *model.PendingUpload) bool {
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if p.WorkspaceID != nil {
+			if err := h.reserveQuota(tx, *p.WorkspaceID, *p.SizeBytes); err != nil {
+				return err
+			}
+		}
+		return tx.Create(p).Error
+	})
+	var qe *errQuotaExceeded
+	if errors.As(err, &qe) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"detail": qe.Error(), "code": "quota_exceeded", "used_bytes": qe.used, "quota_bytes": qe.quota,
+		})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "db insert failed"})
+		return false
+	}
+	return true
+}
+
+// signUpload は制限を確かめて PUT の署名 URL を発行し、complete で照合するため pending_uploads に記録する。
+// Content-Type と Content-Length は署名に含めるので、申告と違う内容は S3 が受け付けない
+func (h *FilesHandler) signUpload(c *gin.Context, p model.PendingUpload) {
+	if err := h.policy.Check(p.Purpose, derefInt64(p.SizeBytes), derefStr(p.ContentType)); err != nil {
+		h.respondPolicyErr(c, p.Purpose, err)
+		return
+	}
+	if derefInt64(p.SizeBytes) > maxSinglePutBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"detail": "file is too large for a single upload; use multipart", "code": "use_multipart", "max_bytes": maxSinglePutBytes,
+		})
+		return
+	}
+	p.ExpiresAt = time.Now().Add(h.store.Expiry() + pendingUploadGrace)
+	if !h.reserve(c, &p) {
+		return
+	}
 
-	presigned, err := h.s3.Presign.PresignPutObject(
-		c,
-		&s3.PutObjectInput{
-			Bucket:      aws.String(h.s3.Bucket),
-			Key:         aws.String(key),
-			ContentType: aws.String(body.ContentType),
-		},
-		func(o *s3.PresignOptions) { o.Expires = h.s3.Expire },
-	)
+	signed, err := h.store.SignUpload(c, p.StorageKey, derefStr(p.ContentType), *p.SizeBytes)
 	if err != nil {
 		c.Error(err)
 		c.JSON(http.StatusInternalServerError, gin.H{"detail": "presign failed"})
@@ -84,12 +154,78 @@ func (h *FilesHandler) SignUploadMessage(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"upload_url":  presigned.URL,
-		"storage_key": key,
-		"file_id":     fileID,
+		"upload_url":     signed.URL,
+		"upload_headers": signed.Headers, // PUT にそのまま付ける
+		"storage_key":    p.StorageKey,
+		"file_id":        p.ID,
+		"expires_at":     p.ExpiresAt,
 	})
 }
 
+type signUploadIn struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	SizeBytes   int64  `json:"size_bytes"`
+}
+
+func (in *signUploadIn) pending(uploader uuid.UUID, purpose string) model.PendingUpload {
+	p := model.PendingUpload{
+		ID:         uuid.New(),
+		UploaderID: uploader,
+		Purpose:    purpose,
+		Filename:   in.Filename,
+	}
+	if in.ContentType != "" {
+		p.ContentType = &in.ContentType
+	}
+	if in.SizeBytes > 0 {
+		p.SizeBytes = &in.SizeBytes
+	}
+	return p
+}
+
+// ========= サイン発行（メッセージ添付） =========
+// POST /workspaces/:ws_id/channels/:channel_id/files/sign-upload
+func (h *FilesHandler) SignUploadMessage(c *gin.Context) {
+	p, ok := h.messagePending(c)
+	if !ok {
+		return
+	}
+	h.signUpload(c, p)
+}
+
+// messagePending は :ws_id / :channel_id への添付の pending を作る（未保存）。失敗時は応答して false
+func (h *FilesHandler) messagePending(c *gin.Context) (model.PendingUpload, bool) {
+	uid := c.GetString("user_id")
+	if uid == "" {
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return model.PendingUpload{}, false
+	}
+	wsID, err1 := uuid.Parse(c.Param("ws_id"))
+	chID, err2 := uuid.Parse(c.Param("channel_id"))
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid ws_id or channel_id"})
+		return model.PendingUpload{}, false
+	}
+	// チャンネルが本当にその WS のものか（キーの接頭辞を偽れないように）
+	var n int64
+	if err := h.db.Model(&model.Channel{}).Where("id = ? AND workspace_id = ?", chID, wsID).Count(&n).Error; err != nil || n == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "channel not found"})
+		return model.PendingUpload{}, false
+	}
+
+	var body signUploadIn
+	if err := c.BindJSON(&body); err != nil || strings.TrimSpace(body.Filename) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "bad body"})
+		return model.PendingUpload{}, false
+	}
+
+	p := body.pending(uuid.MustParse(uid), "message_attachment")
+	p.WorkspaceID, p.ChannelID = &wsID, &chID
+	p.StorageKey = h.keyForMessage(wsID.String(), chID.String(), p.ID.String(), body.Filename)
+	return p, true
+}
+
 // ========= サイン発行（アバター） =========
 // POST /users/me/avatar/sign-upload
 func (h *FilesHandler) SignUploadAvatar(c *gin.Context) {
@@ -99,43 +235,21 @@ func (h *FilesHandler) SignUploadAvatar(c *gin.Context) {
 		return
 	}
 
-	var body struct {
-		Filename    string `json:"filename"`
-		ContentType string `json:"content_type"`
-		SizeBytes   int64  `json:"size_bytes"`
-	}
+	var body signUploadIn
 	if err := c.BindJSON(&body); err != nil || strings.TrimSpace(body.Filename) == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"detail": "bad body"})
 		return
 	}
 
-	fileID := uuid.New().String()
-	key := h.keyForAvatar(uid, fileID, body.Filename)
-
-	presigned, err := h.s3.Presign.PresignPutObject(
-		c,
-		&s3.PutObjectInput{
-			Bucket:      aws.String(h.s3.Bucket),
-			Key:         aws.String(key),
-			ContentType: aws.String(body.ContentType),
-		},
-		func(o *s3.PresignOptions) { o.Expires = h.s3.Expire },
-	)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"detail": "presign failed"})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"upload_url":  presigned.URL,
-		"storage_key": key,
-		"file_id":     fileID,
-	})
+	p := body.pending(uuid.MustParse(uid), "avatar")
+	p.StorageKey = h.keyForAvatar(uid, p.ID.String(), body.Filename)
+	h.signUpload(c, p)
 }
 
 // ========= アップロード完了（どちらの用途も共通で登録） =========
 // POST /files/complete
-// 目的に応じて body.purpose を "message_attachment" or "avatar" で受ける
+// storage_key は自分が sign-upload で発行したものに限る。サイズ・ETag・Content-Type は
+// HEAD で取ったストレージ上の実際の値を保存する（クライアントの申告値は照合にだけ使う）
 func (h *FilesHandler) Complete(c *gin.Context) {
 	uid := c.GetString("user_id")
 	if uid == "" {
@@ -163,113 +277,262 @@ func (h *FilesHandler) Complete(c *gin.Context) {
 	}
 	if err := c.BindJSON(&body); err != nil ||
 		strings.TrimSpace(body.StorageKey) == "" ||
-		strings.TrimSpace(body.Filename) == "" ||
 		strings.TrimSpace(body.Purpose) == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"detail": "bad body"})
 		return
 	}
 
-	now := time.Now()
-	rec := model.File{
-		ID:          uuid.New(),
-		Purpose:     body.Purpose,
-		UploaderID:  uploaderID,
-		Filename:    body.Filename,
-		ContentType: strPtr(body.ContentType),
-		SizeBytes:   int64Ptr(body.SizeBytes),
-		ETag:        strPtr(body.ETag),
-		SHA256Hex:   body.SHA256Hex,
-		StorageKey:  body.StorageKey,
-		IsImage:     strings.HasPrefix(strings.ToLower(body.ContentType), "image/"),
-		CreatedAt:   now,
-	}
-
-	switch body.Purpose {
-	case "message_attachment":
-		// 必須: workspace_id, channel_id
-		if body.WorkspaceID == nil || body.ChannelID == nil {
-			c.JSON(http.StatusBadRequest, gin.H{"detail": "workspace_id and channel_id required for message_attachment"})
+	var p model.PendingUpload
+	if err := h.db.First(&p, "storage_key = ? AND uploader_id = ?", body.StorageKey, uploaderID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"detail": "no pending upload for this storage_key", "code": "upload_not_found"})
 			return
 		}
-		wsID, err1 := uuid.Parse(*body.WorkspaceID)
-		chID, err2 := uuid.Parse(*body.ChannelID)
-		if err1 != nil || err2 != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid workspace_id or channel_id"})
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return
+	}
+	if time.Now().After(p.ExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"detail": "upload expired; sign a new one", "code": "upload_expired"})
+		return
+	}
+	if p.UploadID != nil {
+		c.JSON(http.StatusConflict, gin.H{"detail": "multipart uploads are completed with /files/multipart/{file_id}/complete", "code": "use_multipart"})
+		return
+	}
+	// 申告された用途・宛先は署名時のものと一致しなければならない
+	if body.Purpose != p.Purpose ||
+		body.WorkspaceID != nil && (p.WorkspaceID == nil || *body.WorkspaceID != p.WorkspaceID.String()) ||
+		body.ChannelID != nil && (p.ChannelID == nil || *body.ChannelID != p.ChannelID.String()) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "purpose or destination does not match the signed upload", "code": "upload_mismatch"})
+		return
+	}
+
+	var owner *uuid.UUID
+	if p.Purpose == "avatar" && body.OwnerUserID != nil && strings.TrimSpace(*body.OwnerUserID) != "" {
+		oid, err := uuid.Parse(*body.OwnerUserID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid owner_user_id"})
 			return
 		}
-		rec.WorkspaceID = &wsID
-		rec.ChannelID = &chID
-
-	case "avatar":
-		// 省略時は自分
-		var owner uuid.UUID
-		if body.OwnerUserID != nil && strings.TrimSpace(*body.OwnerUserID) != "" {
-			oid, err := uuid.Parse(*body.OwnerUserID)
+		// 他人のアバターを代わりに上げられるのは、その人が居るワークスペースの admin 以上だけ
+		if oid != uploaderID {
+			ok, err := authz.CanManageUser(h.db, uploaderID, oid)
 			if err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid owner_user_id"})
+				c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+				return
+			}
+			if !ok {
+				c.JSON(http.StatusForbidden, gin.H{"detail": "only an admin can upload an avatar for another user", "code": "forbidden_owner"})
 				return
 			}
-			owner = oid
-		} else {
-			owner = uploaderID
 		}
-		rec.OwnerUserID = &owner
-
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"detail": "unknown purpose"})
-		return
+		owner = &oid
 	}
+	h.finish(c, &p, finishOpts{SizeBytes: body.SizeBytes, ETag: body.ETag, SHA256Hex: body.SHA256Hex, Owner: owner})
+}
 
-	if err := h.db.Create(&rec).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"detail": "db insert failed"})
-		return
-	}
-	c.JSON(http.StatusOK, rec)
+// finishOpts は complete 時のクライアントの申告（照合用）
+type finishOpts struct {
+	SizeBytes int64
+	ETag      string
+	SHA256Hex *string
+	Owner     *uuid.UUID // avatar の持ち主。nil なら本人
 }
 
-// ========= 権限チェック =========
+// finish はアップロード済みのオブジェクトを HEAD して照合し、files に登録する（pending は消す）。応答まで行い、登録できたかを返す
+func (h *FilesHandler) finish(c *gin.Context, p *model.PendingUpload, o finishOpts) bool {
+	obj, err := h.store.Head(c, p.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusConflict, gin.H{"detail": "object has not been uploaded", "code": "upload_missing"})
+		return false
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"detail": "storage lookup failed"})
+		return false
+	}
+	declared := o.SizeBytes
+	if declared == 0 && p.SizeBytes != nil {
+		declared = *p.SizeBytes
+	}
+	if declared > 0 && declared != obj.SizeBytes ||
+		o.ETag != "" && strings.Trim(o.ETag, `"`) != obj.ETag {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "uploaded object does not match size or etag", "code": "upload_mismatch"})
+		return false
+	}
 
-func (h *FilesHandler) canReadFile(requester uuid.UUID, f *model.File) (bool, error) {
-	switch f.Purpose {
-	case "avatar":
-		// ここは「アプリ内の認証済みユーザーなら誰でもOK」にする。
-		// もっと厳密にしたいなら、ワークスペース所属関係などをここで見てもよい。
-		return true, nil
-
-	case "message_attachment":
-		// チャンネル公開範囲に従う
-		if f.ChannelID == nil {
-			return false, nil
+	ct := obj.ContentType
+	if ct == "" && p.ContentType != nil {
+		ct = *p.ContentType
+	}
+	// 署名で縛っているが、念のため実物でも制限を確かめる（違反したものは消す）
+	if err := h.policy.Check(p.Purpose, obj.SizeBytes, ct); err != nil {
+		if derr := h.store.Delete(c, p.StorageKey); derr == nil {
+			h.db.Delete(&model.PendingUpload{}, "id = ?", p.ID)
 		}
-		var ch model.Channel
-		if err := h.db.Select("id, workspace_id, is_private").
-			First(&ch, "id = ?", *f.ChannelID).Error; err != nil {
-			return false, err
+		h.respondPolicyErr(c, p.Purpose, err)
+		return false
+	}
+	// 内容の SHA-256 はサーバーで計算する（申告があれば照合）。hashSyncMaxBytes より大きいものは
+	// jobs.HashFiles が後で計算する（申告は照合しない）。hashMaxBytes より大きいものは計算せず重複排除もしない
+	var sum *string
+	hashLater := obj.SizeBytes > hashSyncMaxBytes && obj.SizeBytes <= hashMaxBytes
+	if obj.SizeBytes <= hashSyncMaxBytes {
+		hex, err := storage.HashObject(c, h.store, p.StorageKey)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"detail": "storage read failed"})
+			return false
 		}
+		if o.SHA256Hex != nil && *o.SHA256Hex != "" && !strings.EqualFold(*o.SHA256Hex, hex) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "sha256_hex does not match the uploaded content", "code": "hash_mismatch"})
+			return false
+		}
+		sum = &hex
+	}
+	now := time.Now()
+	rec := model.File{
+		ID:          p.ID,
+		Purpose:     p.Purpose,
+		WorkspaceID: p.WorkspaceID,
+		ChannelID:   p.ChannelID,
+		UploaderID:  p.UploaderID,
+		Filename:    p.Filename,
+		ContentType: strPtr(ct),
+		SizeBytes:   int64Ptr(obj.SizeBytes),
+		ETag:        strPtr(obj.ETag),
+		SHA256Hex:   sum,
+		HashPending: hashLater,
+		StorageKey:  p.StorageKey,
+		IsImage:     strings.HasPrefix(strings.ToLower(ct), "image/"),
+		ScanStatus:  model.ScanPending, // 配れるのは jobs.ScanFiles が clean にしてから
+		CreatedAt:   now,
+	}
+	if rec.IsImage {
+		// メタデータ除去とサムネイルは jobs.ProcessImages が後で行う
+		rec.ImageStatus = strPtr(model.ImagePending)
+	}
+	if p.Purpose == "avatar" {
+		rec.OwnerUserID = &p.UploaderID
+		if o.Owner != nil {
+			rec.OwnerUserID = o.Owner
+		}
+	}
 
-		if ch.IsPrivate {
-			var n int64
-			if err := h.db.Model(&model.ChannelMember{}).
-				Where("channel_id = ? AND user_id = ?", ch.ID, requester).
-				Count(&n).Error; err != nil {
-				return false, err
+	deduped := false
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// 同時に complete されても 1 回だけ通す
+		res := tx.Delete(&model.PendingUpload{}, "id = ?", p.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		used := obj.SizeBytes
+		if rec.WorkspaceID != nil && sum != nil {
+			blob, err := refBlob(tx, *rec.WorkspaceID, *sum, rec.StorageKey, obj.SizeBytes)
+			if err != nil {
+				return err
+			}
+			rec.BlobID = &blob.ID
+			if blob.StorageKey != rec.StorageKey {
+				// 同じ内容が既にある: そのオブジェクトを参照し、使用量は増やさない
+				deduped, used = true, 0
+				rec.StorageKey, rec.SizeBytes = blob.StorageKey, int64Ptr(blob.SizeBytes)
+				if err := shareScan(tx, &rec); err != nil {
+					return err
+				}
+				if err := shareImage(tx, &rec); err != nil {
+					return err
+				}
 			}
-			return n > 0, nil
 		}
-		var n int64
-		if err := h.db.Model(&model.WorkspaceMember{}).
-			Where("workspace_id = ? AND user_id = ?", ch.WorkspaceID, requester).
-			Count(&n).Error; err != nil {
-			return false, err
+		if err := tx.Create(&rec).Error; err != nil {
+			return err
 		}
-		return n > 0, nil
-	default:
-		return false, nil
+		if rec.WorkspaceID == nil || used == 0 {
+			return nil
+		}
+		return tx.Model(&model.Workspace{}).Where("id = ?", *rec.WorkspaceID).
+			Update("storage_used_bytes", gorm.Expr("storage_used_bytes + ?", used)).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "no pending upload for this storage_key", "code": "upload_not_found"})
+		return false
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "db insert failed"})
+		return false
+	}
+	if deduped {
+		// 同じ内容のオブジェクトを参照したので、アップロードされた方は要らない
+		if err := h.store.Delete(c, p.StorageKey); err != nil {
+			log.Printf("[files] delete duplicate upload %s: %v", p.StorageKey, err)
+		}
+	}
+	c.JSON(http.StatusOK, rec)
+	return true
+}
+
+const (
+	// hashSyncMaxBytes までは complete の応答前に SHA-256 を計算する（読み直すので大きいものは応答が遅くなる）
+	hashSyncMaxBytes = 8 << 20
+	// hashMaxBytes までは jobs.HashFiles が後で計算する。それより大きいファイルは計算せず重複排除もしない
+	hashMaxBytes = 1 << 30
+)
+
+// refBlob はワークスペース内の同じ内容の blob の参照を 1 つ増やす。無ければ storageKey のオブジェクトで作る。
+// 返った blob の StorageKey が storageKey と違えば重複（既存のオブジェクトを使う）
+func refBlob(tx *gorm.DB, wsID uuid.UUID, sha256Hex, storageKey string, size int64) (*model.FileBlob, error) {
+	var b model.FileBlob
+	err := tx.Raw(`
+		INSERT INTO file_blobs (workspace_id, sha256_hex, storage_key, size_bytes, ref_count)
+		VALUES (?, ?, ?, ?, 1)
+		ON CONFLICT (workspace_id, sha256_hex) DO UPDATE SET ref_count = file_blobs.ref_count + 1
+		RETURNING *`, wsID, sha256Hex, storageKey, size).Scan(&b).Error
+	return &b, err
+}
+
+// shareImage は同じ blob の画像処理が済んでいれば、その大きさとサムネイルを使い回す
+func shareImage(tx *gorm.DB, rec *model.File) error {
+	if !rec.IsImage {
+		return nil
+	}
+	var done model.File
+	err := tx.Unscoped().Where("blob_id = ? AND image_status = ?", *rec.BlobID, model.ImageDone).Take(&done).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil // まだ: jobs.ProcessImages が同じキーで作る
+	}
+	if err != nil {
+		return err
+	}
+	rec.Width, rec.Height, rec.Thumbnails, rec.ImageStatus = done.Width, done.Height, done.Thumbnails, done.ImageStatus
+	return nil
+}
+
+// shareScan は同じ blob のスキャンが済んでいれば、その結果を使い回す（同じ内容なので）
+func shareScan(tx *gorm.DB, rec *model.File) error {
+	var done model.File
+	// scan_failed は実物や一時的なスキャナーの不調によるものなので使い回さない
+	err := tx.Unscoped().Where("blob_id = ? AND scan_status NOT IN ?", *rec.BlobID, []string{model.ScanPending, model.ScanFailed}).Take(&done).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil // まだ: jobs.ScanFiles が調べる
+	}
+	if err != nil {
+		return err
+	}
+	rec.ScanStatus, rec.ScanSignature, rec.ScannedAt = done.ScanStatus, done.ScanSignature, done.ScannedAt
+	return nil
+}
+
+// ========= 権限チェック =========
+
+func (h *FilesHandler) canReadFile(requester uuid.UUID, f *model.File) (bool, error) {
+	return authz.CanReadFile(h.db, requester, f)
 }
 
 // ========= ダウンロードURL（署名GET） =========
-// GET /files/:file_id/url?disposition=inline|attachment
+// GET /files/:file_id/url?disposition=inline|attachment&size=64|360|720
+// size を付けると画像のサムネイルの URL（まだ無ければ元画像）
 func (h *FilesHandler) GetDownloadURL(c *gin.Context) {
 	uidStr := c.GetString("user_id")
 	if uidStr == "" {
@@ -299,33 +562,152 @@ func (h *FilesHandler) GetDownloadURL(c *gin.Context) {
 		return
 	}
 
+	// ウイルススキャンが済んで clean なものだけ配る（大きすぎて調べていないものは SCAN_SERVE_UNSCANNED のときだけ）
+	switch f.ScanStatus {
+	case model.ScanClean:
+	case model.ScanSkipped:
+		if !h.policy.ServeUnscanned {
+			c.JSON(http.StatusForbidden, gin.H{"detail": "file is too large to be scanned", "code": "file_unscanned"})
+			return
+		}
+	case model.ScanInfected:
+		c.JSON(http.StatusForbidden, gin.H{"detail": "file is infected", "code": "file_infected"})
+		return
+	case model.ScanFailed:
+		c.JSON(http.StatusForbidden, gin.H{"detail": "file could not be scanned", "code": "file_scan_failed"})
+		return
+	default:
+		c.JSON(http.StatusConflict, gin.H{"detail": "file is still being scanned", "code": "scan_pending"})
+		return
+	}
+
+	var thumb *model.Thumbnail
+	if v := c.Query("size"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || !slices.Contains(imaging.Sizes, size) {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "size must be one of the thumbnail sizes", "sizes": imaging.Sizes})
+			return
+		}
+		thumb = f.Thumbnail(size)
+	}
+
 	disp := c.DefaultQuery("disposition", "attachment")
 	ct := "application/octet-stream"
 	if f.ContentType != nil && *f.ContentType != "" {
 		ct = *f.ContentType
 	}
+	key := f.StorageKey
+	if thumb != nil {
+		key, ct = thumb.StorageKey, thumb.ContentType
+	}
 
-	cd := fmt.Sprintf(`%s; filename="%s"`, disp, url.PathEscape(f.Filename))
-	presigned, err := h.s3.Presign.PresignGetObject(
-		c,
-		&s3.GetObjectInput{
-			Bucket:                     aws.String(h.s3.Bucket),
-			Key:                        aws.String(f.StorageKey),
-			ResponseContentDisposition: aws.String(cd),
-			ResponseContentType:        aws.String(ct),
-		},
-		func(o *s3.PresignOptions) { o.Expires = h.s3.Expire },
-	)
+	link, err := h.store.SignDownload(c, key, f.Filename, ct, disp)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"detail": "presign failed"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"url":        presigned.URL,
-		"expires_at": time.Now().Add(h.s3.Expire),
+	out := gin.H{
+		"url":        link,
+		"expires_at": time.Now().Add(h.store.Expiry()),
+	}
+	if thumb != nil {
+		out["size"], out["width"], out["height"] = thumb.Size, thumb.Width, thumb.Height
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// Delete godoc
+// @Summary  Delete a file (the uploader or an owner of its channel). The object is removed later by the purge job
+// @Tags     files
+// @Param    file_id path string true "File ID (UUID)"
+// @Success  204
+// @Failure  403 {object} map[string]string
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /files/{file_id} [delete]
+func (h *FilesHandler) Delete(c *gin.Context) {
+	uid := uuid.MustParse(c.GetString("user_id"))
+	var f model.File
+	err := h.db.First(&f, "id = ?", c.Param("file_id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "file not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return
+	}
+	if f.UploaderID != uid {
+		allowed := false
+		if f.ChannelID != nil {
+			a, err := authz.Channel(h.db, uid, *f.ChannelID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+				return
+			}
+			allowed = a.ChannelRole == authz.ChannelRoleOwner
+		}
+		if !allowed {
+			c.JSON(http.StatusForbidden, gin.H{"detail": "only the uploader or a channel owner can delete the file"})
+			return
+		}
+	}
+
+	// 行は論理削除だけ。オブジェクトとサムネイル・使用量は保持期間後に jobs.PurgeDeletedFiles が片付ける
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.File{}, "id = ?", f.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.User{}).Where("avatar_file_id = ?", f.ID).Update("avatar_file_id", nil).Error
 	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "delete failed"})
+		return
+	}
+	if f.ChannelID != nil {
+		ev := map[string]any{"type": "file_deleted", "channel_id": *f.ChannelID, "file_id": f.ID}
+		if b, err := json.Marshal(ev); err == nil {
+			h.hub.Broadcast(f.ChannelID.String(), b)
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// WorkspaceStorage godoc
+// @Summary  Show attachment storage usage and quota of the workspace (quota 0 means unlimited)
+// @Tags     files
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Success  200 {object} map[string]int64 "used_bytes, pending_bytes, quota_bytes"
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/storage [get]
+func (h *FilesHandler) WorkspaceStorage(c *gin.Context) {
+	var ws model.Workspace
+	if err := h.db.First(&ws, "id = ?", c.Param("ws_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "workspace not found"})
+		return
+	}
+	var pending int64
+	if err := h.db.Model(&model.PendingUpload{}).
+		Where("workspace_id = ? AND expires_at > now()", ws.ID).
+		Select("COALESCE(SUM(size_bytes), 0)").Scan(&pending).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "query failed"})
+		return
+	}
+	quota := h.policy.WorkspaceQuota
+	if ws.StorageQuotaBytes != nil {
+		quota = *ws.StorageQuotaBytes
+	}
+	c.JSON(http.StatusOK, gin.H{"used_bytes": ws.StorageUsedBytes, "pending_bytes": pending, "quota_bytes": quota})
 }
 
 func strPtr(s string) *string { return &s }
 func int64Ptr(n int64) *int64 { return &n }
+
+func derefInt64(n *int64) int64 {
+	if n == nil {
+		return 0
+	}
+	return *n
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/authz"
+	"slackgo/internal/model"
+)
+
+// --- 内容（SHA-256）での重複排除の事前確認 ---
+// アップロード前にハッシュを送り、同じ内容がワークスペースにあればアップロードせずにファイルを登録できる
+
+type PreflightIn struct {
+	Filename    string `json:"filename" binding:"required"`
+	ContentType string `json:"content_type" binding:"required"`
+	SizeBytes   int64  `json:"size_bytes" binding:"required,min=1"`
+	SHA256Hex   string `json:"sha256_hex" binding:"required"`
+}
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// errBlobGone は参照しようとした blob が purge 中だった
+var errBlobGone = errors.New("blob is being purged")
+
+// Preflight godoc
+// @Summary  Check whether identical content already exists in the workspace. If it does, the file is registered without uploading
+// @Tags     files
+// @Accept   json
+// @Produce  json
+// @Param    ws_id      path string      true "Workspace ID (UUID)"
+// @Param    channel_id path string      true "Channel ID (UUID)"
+// @Param    body       body PreflightIn true "file and its SHA-256"
+// @Success  200 {object} map[string]any "exists, and file (model.File) when it exists"
+// @Failure  413 {object} map[string]any
+// @Failure  415 {object} map[string]any
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/channels/{channel_id}/files/preflight [post]
+func (h *FilesHandler) Preflight(c *gin.Context) {
+	var in PreflightIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	sum := strings.ToLower(in.SHA256Hex)
+	if !sha256Pattern.MatchString(sum) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "sha256_hex must be 64 hex characters"})
+		return
+	}
+	wsID, err1 := uuid.Parse(c.Param("ws_id"))
+	chID, err2 := uuid.Parse(c.Param("channel_id"))
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid ws_id or channel_id"})
+		return
+	}
+	if err := h.policy.Check("message_attachment", in.SizeBytes, in.ContentType); err != nil {
+		h.respondPolicyErr(c, "message_attachment", err)
+		return
+	}
+	uid := uuid.MustParse(c.GetString("user_id"))
+
+	// ハッシュを知っているだけで読めないファイルを手に入れられないよう、
+	// 自分がアップロードしたか読めるチャンネルに共有されている内容だけを対象にする
+	role, _ := authz.ParseRole(c.GetString("workspace_role"))
+	cond, args := authz.ReadableChannelsCond("f.channel_id", uid, role)
+	var blob model.FileBlob
+	err := h.db.Raw(`
+		SELECT b.* FROM file_blobs b
+		WHERE b.workspace_id = ? AND b.sha256_hex = ? AND b.ref_count > 0
+		  AND EXISTS (SELECT 1 FROM files f WHERE f.blob_id = b.id AND f.deleted_at IS NULL AND f.scan_status <> ?
+		    AND (f.uploader_id = ? OR `+cond+`))`,
+		append([]any{wsID, sum, model.ScanInfected, uid}, args...)...).Take(&blob).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusOK, gin.H{"exists": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return
+	}
+
+	rec := model.File{
+		ID:          uuid.New(),
+		Purpose:     "message_attachment",
+		WorkspaceID: &wsID,
+		ChannelID:   &chID,
+		UploaderID:  uid,
+		Filename:    in.Filename,
+		ContentType: strPtr(in.ContentType),
+		SizeBytes:   int64Ptr(blob.SizeBytes),
+		SHA256Hex:   &sum,
+		StorageKey:  blob.StorageKey,
+		IsImage:     strings.HasPrefix(strings.ToLower(in.ContentType), "image/"),
+		BlobID:      &blob.ID,
+		ScanStatus:  model.ScanPending,
+		CreatedAt:   time.Now(),
+	}
+	if rec.IsImage {
+		rec.ImageStatus = strPtr(model.ImagePending)
+	}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		// purge と競合したら（参照が 0 になっていたら）無いものとして扱う
+		res := tx.Exec(`UPDATE file_blobs SET ref_count = ref_count + 1 WHERE id = ? AND ref_count > 0`, blob.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errBlobGone
+		}
+		if err := shareScan(tx, &rec); err != nil {
+			return err
+		}
+		if err := shareImage(tx, &rec); err != nil {
+			return err
+		}
+		return tx.Create(&rec).Error
+	})
+	if errors.Is(err, errBlobGone) {
+		c.JSON(http.StatusOK, gin.H{"exists": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "db insert failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"exists": true, "file": rec})
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/authz"
+	"slackgo/internal/model"
+)
+
+// --- ファイル一覧（チャンネル・ワークスペース） ---
+// メッセージに添付して共有されたファイルを新しい順に返す。未添付（アップロード途中・GC 待ち）は出さない
+
+// SharedMessage はファイルが共有されたメッセージ（複数なら最初のもの）
+type SharedMessage struct {
+	MessageID    uuid.UUID  `json:"message_id"`
+	ChannelID    uuid.UUID  `json:"channel_id"`
+	UserID       *uuid.UUID `json:"user_id,omitempty"`
+	ThreadRootID *uuid.UUID `json:"thread_root_id,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type FileListItem struct {
+	model.File
+	SharedIn *SharedMessage `json:"shared_in,omitempty"`
+}
+
+type FilesPage struct {
+	Files      []FileListItem `json:"files"`
+	NextCursor *string        `json:"next_cursor,omitempty"`
+}
+
+// snippetTypes は text/* 以外でスニペット（コード・設定ファイル）として扱う Content-Type
+var snippetTypes = []string{
+	"application/json", "application/xml", "application/javascript", "application/x-sh",
+	"application/x-yaml", "application/yaml", "application/sql", "application/toml",
+}
+
+// ListChannelFiles godoc
+// @Summary  List files shared in a channel (newest first)
+// @Tags     files
+// @Produce  json
+// @Param    channel_id  path  string true  "Channel ID (UUID)"
+// @Param    types       query string false "comma separated: images,pdfs,snippets"
+// @Param    uploader_id query string false "User ID (UUID)"
+// @Param    from        query string false "RFC3339 or YYYY-MM-DD (inclusive)"
+// @Param    to          query string false "RFC3339 or YYYY-MM-DD (inclusive)"
+// @Param    limit       query int    false "limit (max 100, default 50)"
+// @Param    cursor      query string false "next_cursor from the previous page"
+// @Success  200 {object} handlers.FilesPage
+// @Failure  400 {object} map[string]string
+// @Security Bearer
+// @Router   /channels/{channel_id}/files [get]
+func (h *FilesHandler) ListChannelFiles(c *gin.Context) {
+	chID, err := uuid.Parse(c.Param("channel_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid channel_id"})
+		return
+	}
+	// 読めることは RequireChannelReadable で確認済み（CanReadFile と同じ規則）
+	h.listFiles(c, h.db.Model(&model.File{}).Where("files.channel_id = ?", chID))
+}
+
+// ListWorkspaceFiles godoc
+// @Summary  List files shared in channels of the workspace that the caller can read (newest first)
+// @Tags     files
+// @Produce  json
+// @Param    ws_id       path  string true  "Workspace ID (UUID)"
+// @Param    types       query string false "comma separated: images,pdfs,snippets"
+// @Param    uploader_id query string false "User ID (UUID)"
+// @Param    from        query string false "RFC3339 or YYYY-MM-DD (inclusive)"
+// @Param    to          query string false "RFC3339 or YYYY-MM-DD (inclusive)"
+// @Param    limit       query int    false "limit (max 100, default 50)"
+// @Param    cursor      query string false "next_cursor from the previous page"
+// @Success  200 {object} handlers.FilesPage
+// @Failure  400 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/files [get]
+func (h *FilesHandler) ListWorkspaceFiles(c *gin.Context) {
+	wsID, err := uuid.Parse(c.Param("ws_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid ws_id"})
+		return
+	}
+	role, _ := authz.ParseRole(c.GetString("workspace_role"))
+	cond, args := authz.ReadableChannelsCond("files.channel_id", uuid.MustParse(c.GetString("user_id")), role)
+	h.listFiles(c, h.db.Model(&model.File{}).
+		Where("files.workspace_id = ? AND files.purpose = ?", wsID, "message_attachment").
+		Where(cond, args...))
+}
+
+// listFiles は共通のフィルタとカーソル（created_at, id の降順）をかけて返す
+func (h *FilesHandler) listFiles(c *gin.Context, q *gorm.DB) {
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		if n, err := parsePositiveInt(v, 1, 100); err == nil {
+			limit = n
+		}
+	}
+	q = q.Where("EXISTS (SELECT 1 FROM message_attachments ma WHERE ma.file_id = files.id)")
+
+	if v := c.Query("types"); v != "" {
+		var conds []string
+		var args []any
+		for _, t := range strings.Split(v, ",") {
+			switch strings.TrimSpace(t) {
+			case "images":
+				conds = append(conds, "files.is_image")
+			case "pdfs":
+				conds = append(conds, "files.content_type = ?")
+				args = append(args, "application/pdf")
+			case "snippets":
+				conds = append(conds, "(files.content_type LIKE 'text/%' OR files.content_type IN ?)")
+				args = append(args, snippetTypes)
+			default:
+				c.JSON(http.StatusBadRequest, gin.H{"detail": "types must be images, pdfs or snippets"})
+				return
+			}
+		}
+		q = q.Where("("+strings.Join(conds, " OR ")+")", args...)
+	}
+	if v := c.Query("uploader_id"); v != "" {
+		uploader, err := uuid.Parse(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid uploader_id"})
+			return
+		}
+		q = q.Where("files.uploader_id = ?", uploader)
+	}
+	if v := c.Query("from"); v != "" {
+		from, _, ok := parseDateParam(v)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "from must be RFC3339 or YYYY-MM-DD"})
+			return
+		}
+		q = q.Where("files.created_at >= ?", from)
+	}
+	if v := c.Query("to"); v != "" {
+		to, dateOnly, ok := parseDateParam(v)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "to must be RFC3339 or YYYY-MM-DD"})
+			return
+		}
+		if dateOnly {
+			q = q.Where("files.created_at < ?", to.AddDate(0, 0, 1)) // その日の終わりまで
+		} else {
+			q = q.Where("files.created_at <= ?", to)
+		}
+	}
+	if cur := c.Query("cursor"); cur != "" {
+		keys, ok := decodeCursor(cur, 2)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid cursor"})
+			return
+		}
+		at, err := time.Parse(time.RFC3339Nano, keys[0])
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid cursor"})
+			return
+		}
+		q = q.Where("(files.created_at, files.id) < (?, ?)", at, keys[1])
+	}
+
+	var files []model.File
+	if err := q.Order("files.created_at DESC, files.id DESC").Limit(limit + 1).Find(&files).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
+		return
+	}
+	page := FilesPage{Files: make([]FileListItem, 0, len(files))}
+	if len(files) > limit {
+		last := files[limit-1]
+		next := encodeCursor(last.CreatedAt.UTC().Format(time.RFC3339Nano), last.ID.String())
+		page.NextCursor = &next
+		files = files[:limit]
+	}
+
+	shared, err := h.sharedIn(files)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
+		return
+	}
+	for _, f := range files {
+		page.Files = append(page.Files, FileListItem{File: f, SharedIn: shared[f.ID]})
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// sharedIn はファイルごとに最初に共有されたメッセージ
+func (h *FilesHandler) sharedIn(files []model.File) (map[uuid.UUID]*SharedMessage, error) {
+	out := map[uuid.UUID]*SharedMessage{}
+	if len(files) == 0 {
+		return out, nil
+	}
+	ids := make([]uuid.UUID, 0, len(files))
+	for _, f := range files {
+		ids = append(ids, f.ID)
+	}
+	var rows []struct {
+		FileID uuid.UUID
+		SharedMessage
+	}
+	if err := h.db.Raw(`
+		SELECT DISTINCT ON (ma.file_id) ma.file_id, m.id AS message_id, m.channel_id, m.user_id, m.thread_root_id, m.created_at
+		FROM message_attachments ma
+		JOIN messages m ON m.id = ma.message_id
+		WHERE ma.file_id IN ?
+		ORDER BY ma.file_id, m.created_at`, ids).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		out[rows[i].FileID] = &rows[i].SharedMessage
+	}
+	return out, nil
+}
+
+// parseDateParam は RFC3339 か YYYY-MM-DD（UTC の 0 時）を受け付ける
+func parseDateParam(v string) (t time.Time, dateOnly bool, ok bool) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, false, true
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, true, true
+	}
+	return time.Time{}, false, false
+}
@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/model"
+	"slackgo/internal/storage"
+)
+
+// --- マルチパートアップロード（大きな添付ファイル用） ---
+// initiate → parts（署名 URL をまとめて発行）→ 各パートを PUT → complete（パートの ETag 一覧）。
+// 途中で切れたら GET parts で済んだパートを調べて続きから送れる。やめるときは DELETE
+
+// multipartTTL は initiate から complete までの猶予（大きいファイルは時間がかかる）
+const multipartTTL = 24 * time.Hour
+
+// maxPartsPerRequest は 1 回に署名するパートの数
+const maxPartsPerRequest = 100
+
+type MultipartOut struct {
+	FileID     uuid.UUID `json:"file_id"`
+	StorageKey string    `json:"storage_key"`
+	PartSize   int64     `json:"part_size"`
+	PartCount  int32     `json:"part_count"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type PresignPartsIn struct {
+	PartNumbers []int32 `json:"part_numbers" binding:"required,min=1,max=100"`
+}
+
+type CompleteMultipartIn struct {
+	Parts     []storage.Part `json:"parts" binding:"required,min=1"`
+	SHA256Hex *string        `json:"sha256_hex"`
+}
+
+func multipartOut(p *model.PendingUpload) MultipartOut {
+	return MultipartOut{
+		FileID:     p.ID,
+		StorageKey: p.StorageKey,
+		PartSize:   *p.PartSize,
+		PartCount:  storage.PartCount(*p.SizeBytes, *p.PartSize),
+		ExpiresAt:  p.ExpiresAt,
+	}
+}
+
+// InitiateMultipart godoc
+// @Summary  Start a multipart upload of a message attachment (for large files)
+// @Tags     files
+// @Accept   json
+// @Produce  json
+// @Param    ws_id      path string true "Workspace ID (UUID)"
+// @Param    channel_id path string true "Channel ID (UUID)"
+// @Param    body       body signUploadIn true "filename, content_type, size_bytes"
+// @Success  200 {object} handlers.MultipartOut
+// @Failure  413 {object} map[string]any
+// @Failure  415 {object} map[string]any
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/channels/{channel_id}/files/multipart [post]
+func (h *FilesHandler) InitiateMultipart(c *gin.Context) {
+	p, ok := h.messagePending(c)
+	if !ok {
+		return
+	}
+	if err := h.policy.Check(p.Purpose, derefInt64(p.SizeBytes), derefStr(p.ContentType)); err != nil {
+		h.respondPolicyErr(c, p.Purpose, err)
+		return
+	}
+	partSize := storage.PartSizeFor(*p.SizeBytes)
+	p.PartSize = &partSize
+	p.ExpiresAt = time.Now().Add(multipartTTL)
+
+	uploadID, err := h.store.CreateMultipart(c, p.StorageKey, derefStr(p.ContentType))
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"detail": "could not start multipart upload"})
+		return
+	}
+	p.UploadID = &uploadID
+	if !h.reserve(c, &p) {
+		_ = h.store.AbortMultipart(c, p.StorageKey, uploadID)
+		return
+	}
+	c.JSON(http.StatusOK, multipartOut(&p))
+}
+
+// loadMultipart は自分の進行中のマルチパートを返す。無ければ応答して nil
+func (h *FilesHandler) loadMultipart(c *gin.Context) *model.PendingUpload {
+	id, err := uuid.Parse(c.Param("file_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid file_id"})
+		return nil
+	}
+	var p model.PendingUpload
+	err = h.db.First(&p, "id = ? AND uploader_id = ? AND upload_id IS NOT NULL", id, c.GetString("user_id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "no multipart upload", "code": "upload_not_found"})
+		return nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return nil
+	}
+	if time.Now().After(p.ExpiresAt) {
+		c.JSON(http.StatusGone, gin.H{"detail": "upload expired; start a new one", "code": "upload_expired"})
+		return nil
+	}
+	return &p
+}
+
+// PresignParts godoc
+// @Summary  Sign upload URLs for parts (up to 100 per call). PUT each part with the returned headers
+// @Tags     files
+// @Accept   json
+// @Produce  json
+// @Param    file_id path string true "File ID (UUID) returned by initiate"
+// @Param    body    body PresignPartsIn true "part numbers (1-based)"
+// @Success  200 {object} map[string]any "parts: [{part_number, url, headers}]"
+// @Failure  404 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /files/multipart/{file_id}/parts [post]
+func (h *FilesHandler) PresignParts(c *gin.Context) {
+	var in PresignPartsIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	p := h.loadMultipart(c)
+	if p == nil {
+		return
+	}
+	count := storage.PartCount(*p.SizeBytes, *p.PartSize)
+	parts := make([]storage.PresignedPart, 0, len(in.PartNumbers))
+	for _, n := range in.PartNumbers {
+		if n < 1 || n > count {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "part_number out of range", "part_count": count})
+			return
+		}
+		pp, err := h.store.PresignPart(c, p.StorageKey, *p.UploadID, n, storage.PartLength(*p.SizeBytes, *p.PartSize, n))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"detail": "presign failed"})
+			return
+		}
+		parts = append(parts, pp)
+	}
+	c.JSON(http.StatusOK, gin.H{"parts": parts, "expires_at": time.Now().Add(h.store.Expiry())})
+}
+
+// ListParts godoc
+// @Summary  List parts already uploaded (to resume an interrupted upload)
+// @Tags     files
+// @Produce  json
+// @Param    file_id path string true "File ID (UUID)"
+// @Success  200 {object} map[string]any "upload (MultipartOut) and parts: [{part_number, etag, size_bytes}]"
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /files/multipart/{file_id}/parts [get]
+func (h *FilesHandler) ListParts(c *gin.Context) {
+	p := h.loadMultipart(c)
+	if p == nil {
+		return
+	}
+	parts, err := h.store.ListParts(c, p.StorageKey, *p.UploadID)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusGone, gin.H{"detail": "upload no longer exists in storage", "code": "upload_expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"detail": "storage lookup failed"})
+		return
+	}
+	if parts == nil {
+		parts = []storage.Part{}
+	}
+	c.JSON(http.StatusOK, gin.H{"upload": multipartOut(p), "parts": parts})
+}
+
+// CompleteMultipart godoc
+// @Summary  Finish a multipart upload with the ETag of every part and register the file
+// @Tags     files
+// @Accept   json
+// @Produce  json
+// @Param    file_id path string true "File ID (UUID)"
+// @Param    body    body CompleteMultipartIn true "parts"
+// @Success  200 {object} model.File
+// @Failure  404 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /files/multipart/{file_id}/complete [post]
+func (h *FilesHandler) CompleteMultipart(c *gin.Context) {
+	var in CompleteMultipartIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	p := h.loadMultipart(c)
+	if p == nil {
+		return
+	}
+	// 1..part_count が 1 つずつそろっていること
+	count := storage.PartCount(*p.SizeBytes, *p.PartSize)
+	seen := map[int32]bool{}
+	for _, pt := range in.Parts {
+		if pt.PartNumber < 1 || pt.PartNumber > count || seen[pt.PartNumber] || pt.ETag == "" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "invalid or duplicate part", "code": "upload_mismatch"})
+			return
+		}
+		seen[pt.PartNumber] = true
+	}
+	if int32(len(seen)) != count {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "all parts are required", "code": "upload_mismatch", "part_count": count})
+		return
+	}
+
+	err := h.store.CompleteMultipart(c, p.StorageKey, *p.UploadID, in.Parts)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusGone, gin.H{"detail": "upload no longer exists in storage", "code": "upload_expired"})
+		return
+	}
+	if err != nil {
+		// ETag 違い・未アップロードのパートなど
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "storage rejected the parts: " + err.Error(), "code": "upload_mismatch"})
+		return
+	}
+	if !h.finish(c, p, finishOpts{SHA256Hex: in.SHA256Hex}) {
+		h.discardCompleted(c, p)
+	}
+}
+
+// discardCompleted は組み立てまで済んだのに登録できなかったオブジェクトを消す。
+// pending が残っているときだけ（同時に complete した方が登録していれば pending は消えている）
+func (h *FilesHandler) discardCompleted(c *gin.Context, p *model.PendingUpload) {
+	res := h.db.Delete(&model.PendingUpload{}, "id = ?", p.ID)
+	if res.Error != nil {
+		log.Printf("[files] discard multipart %s: %v", p.ID, res.Error)
+		return
+	}
+	if res.RowsAffected == 0 {
+		return
+	}
+	if err := h.store.Delete(c, p.StorageKey); err != nil {
+		log.Printf("[files] discard multipart object %s: %v", p.StorageKey, err)
+	}
+}
+
+// AbortMultipart godoc
+// @Summary  Cancel a multipart upload and discard uploaded parts
+// @Tags     files
+// @Param    file_id path string true "File ID (UUID)"
+// @Success  204
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /files/multipart/{file_id} [delete]
+func (h *FilesHandler) AbortMultipart(c *gin.Context) {
+	p := h.loadMultipart(c)
+	if p == nil {
+		return
+	}
+	if err := h.store.AbortMultipart(c, p.StorageKey, *p.UploadID); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"detail": "abort failed"})
+		return
+	}
+	if err := h.db.Delete(&model.PendingUpload{}, "id = ?", p.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "abort failed"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/events"
+	"slackgo/internal/model"
+	"slackgo/internal/richtext"
+	"slackgo/internal/ws"
+)
+
+// --- インタラクティブ要素（ボタン・セレクト）の操作 ---
+// クライアントが押された action_id を送ると、メッセージを投稿した bot の interaction_url へ
+// 署名付きの block_actions を転送する。bot の応答で元メッセージの置き換え・削除や ephemeral 返信ができる
+
+type InteractionsHandler struct {
+	db     *gorm.DB
+	hub    *ws.Hub
+	msgs   *MessagesHandler
+	client *http.Client
+}
+
+func NewInteractionsHandler(db *gorm.DB, hub *ws.Hub, msgs *MessagesHandler, client *http.Client) *InteractionsHandler {
+	return &InteractionsHandler{db: db, hub: hub, msgs: msgs, client: client}
+}
+
+const interactionTimeout = 5 * time.Second
+
+type ActionIn struct {
+	ActionID string `json:"action_id" binding:"required,max=255" example:"approve"`
+	// static_select で選んだ option の value（button では不要）
+	Value *string `json:"value" binding:"omitempty,max=150"`
+}
+
+// InteractionAction は payload の actions の要素
+type InteractionAction struct {
+	Type           string           `json:"type"` // button / static_select
+	ActionID       string           `json:"action_id"`
+	BlockID        string           `json:"block_id,omitempty"`
+	Value          string           `json:"value,omitempty"` // button
+	SelectedOption *richtext.Option `json:"selected_option,omitempty"`
+	ActionTS       time.Time        `json:"action_ts"`
+}
+
+// InteractionPayload は interaction_url へ POST する JSON
+type InteractionPayload struct {
+	Type        string              `json:"type"` // "block_actions"
+	TriggerID   uuid.UUID           `json:"trigger_id"`
+	WorkspaceID uuid.UUID           `json:"workspace_id"`
+	ChannelID   uuid.UUID           `json:"channel_id"`
+	UserID      uuid.UUID           `json:"user_id"` // 操作したユーザー
+	Message     MsgOut              `json:"message"`
+	Actions     []InteractionAction `json:"actions"`
+}
+
+// interactionReply は app の応答（空なら受け付けのみ）
+type interactionReply struct {
+	ReplaceOriginal bool            `json:"replace_original"`
+	DeleteOriginal  bool            `json:"delete_original"`
+	ResponseType    string          `json:"response_type"` // ephemeral（既定）
+	Text            string          `json:"text"`
+	Blocks          json.RawMessage `json:"blocks"`
+}
+
+var errInteractionFailed = errors.New("the app did not handle the action")
+
+// Act godoc
+// @Summary  Click a button or choose a select option in a message. Forwarded to the posting app's interaction URL
+// @Tags     messages
+// @Accept   json
+// @Produce  json
+// @Param    channel_id path string   true "Channel ID (UUID)"
+// @Param    message_id path string   true "Message ID (UUID)"
+// @Param    body       body ActionIn true "action"
+// @Success  200 {object} map[string]any "ok, message (when replaced), deleted"
+// @Failure  404 {object} map[string]string
+// @Failure  409 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Failure  502 {object} map[string]string
+// @Security Bearer
+// @Router   /channels/{channel_id}/messages/{message_id}/actions [post]
+func (h *InteractionsHandler) Act(c *gin.Context) {
+	var in ActionIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	msg, ok := h.msgs.load(c)
+	if !ok {
+		return
+	}
+
+	var blocks []richtext.Block
+	if len(msg.Blocks) > 0 {
+		if err := json.Unmarshal(msg.Blocks, &blocks); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"detail": "stored blocks are broken"})
+			return
+		}
+	}
+	blockID, elem, found := richtext.FindAction(blocks, in.ActionID)
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "action not found in the message", "code": "action_not_found"})
+		return
+	}
+	now := time.Now()
+	action := InteractionAction{ActionID: in.ActionID, BlockID: blockID, ActionTS: now}
+	switch {
+	case elem.Button != nil:
+		action.Type, action.Value = richtext.ElementButton, elem.Button.Value
+	case elem.Select != nil:
+		if in.Value == nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "value is required for selects"})
+			return
+		}
+		opt, ok := elem.Select.Option(*in.Value)
+		if !ok {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "value is not one of the options"})
+			return
+		}
+		action.Type, action.SelectedOption = richtext.ElementSelect, opt
+	}
+
+	// 受け取るのはメッセージを投稿した bot（有効で interaction_url があるもの）
+	var bot model.Bot
+	err := h.db.First(&bot, "user_id = ? AND deactivated_at IS NULL", msg.UserID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return
+	}
+	if err != nil || bot.InteractionURL == nil || bot.SigningSecret == nil {
+		c.JSON(http.StatusConflict, gin.H{"detail": "no app handles actions for this message", "code": "no_interaction_url"})
+		return
+	}
+
+	uid := uuid.MustParse(c.GetString("user_id"))
+	reply, err := h.forward(c.Request.Context(), &bot, InteractionPayload{
+		Type:        "block_actions",
+		TriggerID:   uuid.New(),
+		WorkspaceID: msg.WorkspaceID,
+		ChannelID:   msg.ChannelID,
+		UserID:      uid,
+		Message:     h.msgs.out(h.db, msg),
+		Actions:     []InteractionAction{action},
+	})
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"detail": err.Error(), "code": "interaction_failed"})
+		return
+	}
+
+	switch {
+	case reply.DeleteOriginal:
+		if err := h.msgs.remove(msg); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"detail": "delete failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true, "deleted": true})
+	case reply.ReplaceOriginal:
+		var newBlocks []richtext.Block
+		if hasBlocks(reply.Blocks) {
+			if newBlocks, err = richtext.ParseBlocks(reply.Blocks); err != nil {
+				c.JSON(http.StatusBadGateway, gin.H{"detail": "the app returned invalid blocks: " + err.Error(), "code": "interaction_failed"})
+				return
+			}
+		}
+		text := reply.Text
+		if text == "" {
+			text = derefStr(msg.Text)
+		}
+		out, err := h.msgs.update(msg, text, newBlocks)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"detail": err.Error(), "code": "interaction_failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true, "message": out})
+	default:
+		if reply.Text != "" {
+			sendEphemeral(h.hub, EphemeralOut{
+				ChannelID: msg.ChannelID,
+				UserID:    uid,
+				SenderID:  &bot.UserID,
+				ParentID:  msg.ThreadRootID,
+				Text:      reply.Text,
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
+
+// forward は payload を署名して bot へ送り、応答を読む
+func (h *InteractionsHandler) forward(ctx context.Context, bot *model.Bot, p InteractionPayload) (interactionReply, error) {
+	var reply interactionReply
+	body, err := json.Marshal(p)
+	if err != nil {
+		return reply, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, interactionTimeout)
+	defer cancel()
+	resp, err := events.PostSigned(ctx, h.client, *bot.InteractionURL, *bot.SigningSecret, body, nil)
+	if err != nil {
+		return reply, errInteractionFailed
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return reply, fmt.Errorf("%w (status %d)", errInteractionFailed, resp.StatusCode)
+	}
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return reply, errInteractionFailed
+	}
+	if len(strings.TrimSpace(string(raw))) > 0 {
+		if json.Unmarshal(raw, &reply) != nil {
+			reply = interactionReply{Text: string(raw)} // JSON でなければ本文をそのまま ephemeral で出す
+		}
+	}
+	return reply, nil
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"slackgo/internal/authz"
+	"slackgo/internal/model"
+	"slackgo/internal/ws"
+)
+
+// --- メンション展開 ---
+// 本文中の <@user_id> と @handle（ユーザーグループ）を拾い、
+// 読めるメンバーごとに message_mentions を作って各ユーザーのルームへ通知する
+
+var (
+	userMentionRe  = regexp.MustCompile(`<@([0-9a-fA-F-]{36})>`)
+	groupMentionRe = regexp.MustCompile(`(?:^|[^\w@<])@([a-zA-Z0-9][a-zA-Z0-9._-]{0,79})`)
+)
+
+// parseMentions は本文からユーザーIDとグループハンドル（小文字）を取り出す
+func parseMentions(text string) (userIDs []uuid.UUID, handles []string) {
+	seenU := map[uuid.UUID]struct{}{}
+	for _, m := range userMentionRe.FindAllStringSubmatch(text, -1) {
+		id, err := uuid.Parse(m[1])
+		if err != nil {
+			continue
+		}
+		if _, ok := seenU[id]; ok {
+			continue
+		}
+		seenU[id] = struct{}{}
+		userIDs = append(userIDs, id)
+	}
+	seenH := map[string]struct{}{}
+	for _, m := range groupMentionRe.FindAllStringSubmatch(text, -1) {
+		h := strings.TrimRight(strings.ToLower(m[1]), "._-") // 文末の句読点を落とす
+		if _, ok := seenH[h]; ok || h == "" {
+			continue
+		}
+		seenH[h] = struct{}{}
+		handles = append(handles, h)
+	}
+	return userIDs, handles
+}
+
+// notifyMentions は msg のメンションを展開して保存・通知する。
+// メッセージ自体は作成済みなので、失敗してもログだけ残す
+func notifyMentions(db *gorm.DB, hub *ws.Hub, msg *model.Message, out MsgOut) {
+	userIDs, handles := parseMentions(out.Text)
+	if len(userIDs) == 0 && len(handles) == 0 {
+		return
+	}
+
+	// user_id → 経由グループ（直接メンションは nil を優先）
+	targets := map[uuid.UUID]*uuid.UUID{}
+	order := []uuid.UUID{}
+	add := func(uid uuid.UUID, via *uuid.UUID) {
+		if prev, ok := targets[uid]; ok {
+			if prev != nil && via == nil {
+				targets[uid] = nil
+			}
+			return
+		}
+		targets[uid] = via
+		order = append(order, uid)
+	}
+
+	// 直接メンションは同じワークスペースのメンバーのみ
+	if len(userIDs) > 0 {
+		var ids []uuid.UUID
+		if err := db.Table("workspace_members").
+			Where("workspace_id = ? AND user_id IN ?", msg.WorkspaceID, userIDs).
+			Pluck("user_id", &ids).Error; err != nil {
+			log.Printf("[mentions] resolve users: %v", err)
+			return
+		}
+		for _, id := range ids {
+			add(id, nil)
+		}
+	}
+
+	if len(handles) > 0 {
+		type row struct {
+			GroupID uuid.UUID
+			UserID  uuid.UUID
+		}
+		var rows []row
+		if err := db.Table("user_groups g").
+			Select("g.id AS group_id, gm.user_id").
+			Joins("JOIN user_group_members gm ON gm.group_id = g.id").
+			Where("g.workspace_id = ? AND lower(g.handle) IN ?", msg.WorkspaceID, handles).
+			Order("gm.created_at ASC").
+			Scan(&rows).Error; err != nil {
+			log.Printf("[mentions] resolve groups: %v", err)
+			return
+		}
+		for _, r := range rows {
+			gid := r.GroupID
+			add(r.UserID, &gid)
+		}
+	}
+
+	// チャンネルを読めない人（非参加のプライベート・ゲスト等）と自分には通知しない
+	readable, err := authz.ChannelReaders(db, msg.ChannelID, order)
+	if err != nil {
+		log.Printf("[mentions] access check: %v", err)
+		return
+	}
+	canRead := map[uuid.UUID]bool{}
+	for _, id := range readable {
+		canRead[id] = true
+	}
+	recs := make([]model.MessageMention, 0, len(order))
+	for _, uid := range order {
+		if !canRead[uid] || msg.UserID != nil && uid == *msg.UserID {
+			continue
+		}
+		recs = append(recs, model.MessageMention{MessageID: msg.ID, UserID: uid, ViaGroupID: targets[uid]})
+	}
+	if len(recs) == 0 {
+		return
+	}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&recs).Error; err != nil {
+		log.Printf("[mentions] save: %v", err)
+		return
+	}
+
+	for _, rec := range recs {
+		ev := map[string]any{"type": "mention", "message": out}
+		if rec.ViaGroupID != nil {
+			ev["via_group_id"] = rec.ViaGroupID
+		}
+		if b, err := json.Marshal(ev); err == nil {
+			hub.Broadcast(ws.UserRoom(rec.UserID.String()), b)
+		}
+	}
+}
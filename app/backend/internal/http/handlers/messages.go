@@ -2,30 +2,44 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"slackgo/internal/events"
+	"slackgo/internal/http/middleware"
 	"slackgo/internal/model"
+	"slackgo/internal/richtext"
 	"slackgo/internal/ws"
 )
 
 type MessagesHandler struct {
-	db  *gorm.DB
-	hub *ws.Hub
+	db      *gorm.DB
+	hub     *ws.Hub
+	avatars *AvatarURLs
+	// 先頭が / の投稿はここへ回す（NewCommandsHandler が設定する）
+	commands *CommandsHandler
 }
 
-func NewMessagesHandler(db *gorm.DB, hub *ws.Hub) *MessagesHandler {
-	return &MessagesHandler{db: db, hub: hub}
+func NewMessagesHandler(db *gorm.DB, hub *ws.Hub, avatars *AvatarURLs) *MessagesHandler {
+	return &MessagesHandler{db: db, hub: hub, avatars: avatars}
 }
 
 type MsgCreateIn struct {
-	Text     string  `json:"text" binding:"required,min=1"`
+	Text     string  `json:"text" binding:"required,min=1,max=40000"`
 	ParentID *string `json:"parent_id,omitempty"` // 追加: 返信先（UUID文字列）
+	// Block Kit 風の構造（bot のみ）。text は通知・検索用の代替テキストとして必須
+	Blocks json.RawMessage `json:"blocks,omitempty" swaggertype:"array,object"`
+	// 添付するファイル（このチャンネルに自分が complete したもの）
+	FileIDs []uuid.UUID `json:"file_ids,omitempty" binding:"omitempty,max=10"`
 }
 
 type MsgOut struct {
@@ -35,14 +49,26 @@ type MsgOut struct {
 	UserID           uuid.UUID  `json:"user_id"`
 	UserDisplayName  *string    `json:"user_display_name,omitempty"`
 	UserAvatarFileID *uuid.UUID `json:"user_avatar_file_id,omitempty"`
+	UserAvatarURL    *string    `json:"user_avatar_url,omitempty"` // キャッシュできる署名 URL（/avatars/...）
+	Username         *string    `json:"username,omitempty"`        // 表示名の上書き（webhook）
+	IconURL          *string    `json:"icon_url,omitempty"`
+	Subtype          *string    `json:"subtype,omitempty"` // me_message など
 	Text             string     `json:"text"`
 	ParentID         *uuid.UUID `json:"parent_id,omitempty"`
 	ThreadRootID     *uuid.UUID `json:"thread_root_id,omitempty"`
 	CreatedAt        time.Time  `json:"created_at"`
+	EditedAt         *time.Time `json:"edited_at,omitempty"`
+
+	// Rich は text の AST（richtext.Document）。Blocks は bot が送った構造（[]richtext.Block）
+	Rich   json.RawMessage `json:"rich,omitempty" swaggertype:"object"`
+	Blocks json.RawMessage `json:"blocks,omitempty" swaggertype:"array,object"`
+
+	// 添付ファイル（削除済みは除く）
+	FileIDs []uuid.UUID `json:"file_ids,omitempty"`
 }
 
 // Create message godoc
-// @Summary  Create message (supports thread replies)
+// @Summary  Create message (supports thread replies). Text starting with "/" runs a slash command ("//" posts a literal "/")
 // @Tags     messages
 // @Accept   json
 // @Produce  json
@@ -52,6 +78,7 @@ type MsgOut struct {
 // @Failure  400 {object} map[string]string
 // @Failure  401 {object} map[string]string
 // @Failure  404 {object} map[string]string
+// @Failure  422 {object} map[string]string
 // @Security Bearer
 // @Router   /channels/{channel_id}/messages [post]
 func (h *MessagesHandler) Create(c *gin.Context) {
@@ -68,36 +95,130 @@ func (h *MessagesHandler) Create(c *gin.Context) {
 		return
 	}
 
-	// チャンネル存在 & WS解決
-	var ch model.Channel
-	if err := h.db.First(&ch, "id = ?", chIDStr).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"detail": "channel not found"})
+	// スラッシュコマンド。"//" で始めると先頭の / を 1 つ外した本文として投稿する
+	if h.commands != nil {
+		if name, args, ok := parseCommand(in.Text); ok {
+			// コマンドは添付も blocks も受け取らないので、黙って捨てずに断る
+			if len(in.FileIDs) > 0 || hasBlocks(in.Blocks) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "file_ids and blocks cannot be sent with a slash command", "code": "command_with_attachments"})
+				return
+			}
+			h.commands.run(c, name, args, in.ParentID)
+			return
+		}
+	}
+	text := in.Text
+	if strings.HasPrefix(text, "//") {
+		text = text[1:]
+	}
+	var blocks []richtext.Block
+	if hasBlocks(in.Blocks) {
+		if c.GetString("auth_kind") != middleware.AuthKindBot {
+			c.JSON(http.StatusForbidden, gin.H{"detail": "blocks can only be posted by bots"})
+			return
+		}
+		var err error
+		if blocks, err = richtext.ParseBlocks(in.Blocks); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error(), "code": "invalid_blocks"})
+			return
+		}
+	}
+
+	out, err := h.post(postParams{
+		ChannelID: uuid.MustParse(chIDStr),
+		UserID:    uuid.MustParse(uidStr),
+		Text:      text,
+		ParentID:  in.ParentID,
+		Blocks:    blocks,
+		FileIDs:   in.FileIDs,
+	})
+	if err != nil {
+		respondPostErr(c, err)
 		return
 	}
+	c.JSON(http.StatusOK, out)
+}
 
-	uid := uuid.MustParse(uidStr)
-	chID := uuid.MustParse(chIDStr)
-	text := in.Text
+// postParams は投稿の共通入力（通常投稿・incoming webhook など）
+type postParams struct {
+	ChannelID uuid.UUID
+	UserID    uuid.UUID
+	Text      string
+	ParentID  *string // 返信先（UUID文字列）
+
+	// 表示名・アイコンの上書き（webhook 用）
+	Username  *string
+	IconURL   *string
+	WebhookID *uuid.UUID
+
+	Subtype *string
+	Blocks  []richtext.Block // 検証済み（richtext.ParseBlocks）
+	FileIDs []uuid.UUID      // 添付（投稿者がこのチャンネルにアップロードしたもの）
+}
+
+// hasBlocks は blocks が指定されたか（省略・null は無し）
+func hasBlocks(raw json.RawMessage) bool {
+	s := strings.TrimSpace(string(raw))
+	return s != "" && s != "null"
+}
 
+var (
+	errPostChannelNotFound = errors.New("channel not found")
+	errPostInvalidParent   = errors.New("invalid parent_id")
+	errPostParentNotFound  = errors.New("parent message not found")
+	errPostParentMismatch  = errors.New("parent message channel mismatch")
+	errPostInvalidFormat   = errors.New("message formatting could not be stored")
+	errPostInvalidFiles    = errors.New("file_ids must be your own uploads in this channel")
+	errPostTooLong         = fmt.Errorf("text must be at most %d characters", maxMessageText)
+)
+
+func respondPostErr(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errPostChannelNotFound), errors.Is(err, errPostParentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"detail": err.Error()})
+	case errors.Is(err, errPostInvalidParent), errors.Is(err, errPostParentMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+	case errors.Is(err, errPostInvalidFormat), errors.Is(err, errPostTooLong):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+	case errors.Is(err, errPostInvalidFiles):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error(), "code": "invalid_files"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "create message failed"})
+	}
+}
+
+// maxMessageText は本文の上限（文字数）。bot・コマンドの応答のように binding を通らない本文も post / update で弾く
+const maxMessageText = 40000
+
+// post はメッセージを保存し、hub への配信とメンション通知まで行う。
+// 権限チェックは呼び出し側（middleware など）で済ませておくこと
+func (h *MessagesHandler) post(p postParams) (MsgOut, error) {
+	// チャンネル存在 & WS解決
+	var ch model.Channel
+	if err := h.db.First(&ch, "id = ?", p.ChannelID).Error; err != nil {
+		return MsgOut{}, errPostChannelNotFound
+	}
+
+	text := p.Text
+	if utf8.RuneCountInString(text) > maxMessageText {
+		return MsgOut{}, errPostTooLong
+	}
 	var parentID *uuid.UUID
 	var rootID *uuid.UUID
 
 	// 返信の場合、親を検証
-	if in.ParentID != nil && *in.ParentID != "" {
-		pid, err := uuid.Parse(*in.ParentID)
+	if p.ParentID != nil && *p.ParentID != "" {
+		pid, err := uuid.Parse(*p.ParentID)
 		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid parent_id"})
-			return
+			return MsgOut{}, errPostInvalidParent
 		}
 		var parent model.Message
 		if err := h.db.First(&parent, "id = ?", pid).Error; err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"detail": "parent message not found"})
-			return
+			return MsgOut{}, errPostParentNotFound
 		}
 		// 同一チャンネルであることを保証
-		if parent.ChannelID != chID {
-			c.JSON(http.StatusBadRequest, gin.H{"detail": "parent message channel mismatch"})
-			return
+		if parent.ChannelID != p.ChannelID {
+			return MsgOut{}, errPostParentMismatch
 		}
 		parentID = &pid
 
@@ -109,48 +230,276 @@ func (h *MessagesHandler) Create(c *gin.Context) {
 		}
 	}
 
+	// 本文の AST（解析自体は失敗しないが、大きすぎるものは弾く）
+	doc := richtext.Parse(text)
+	if err := richtext.Validate(doc); err != nil {
+		return MsgOut{}, fmt.Errorf("%w: %v", errPostInvalidFormat, err)
+	}
+	rich, err := json.Marshal(doc)
+	if err != nil {
+		return MsgOut{}, err
+	}
+	var blocks json.RawMessage
+	if len(p.Blocks) > 0 {
+		if blocks, err = json.Marshal(p.Blocks); err != nil {
+			return MsgOut{}, err
+		}
+	}
+
+	// 添付は投稿者がこのチャンネルへ complete したファイルだけ
+	fileIDs := uniqueUUIDs(p.FileIDs)
+	if len(fileIDs) > 0 {
+		var n int64
+		if err := h.db.Model(&model.File{}).
+			Where("id IN ? AND channel_id = ? AND uploader_id = ? AND purpose = ?",
+				fileIDs, p.ChannelID, p.UserID, "message_attachment").
+			Count(&n).Error; err != nil {
+			return MsgOut{}, err
+		}
+		if int(n) != len(fileIDs) {
+			return MsgOut{}, errPostInvalidFiles
+		}
+	}
+
+	uid := p.UserID
 	msg := model.Message{
 		WorkspaceID:  ch.WorkspaceID,
-		ChannelID:    chID,
+		ChannelID:    p.ChannelID,
 		UserID:       &uid,
 		Text:         &text,
 		ParentID:     parentID,
 		ThreadRootID: rootID,
+		Username:     p.Username,
+		IconURL:      p.IconURL,
+		WebhookID:    p.WebhookID,
+		Subtype:      p.Subtype,
+		Rich:         rich,
+		Blocks:       blocks,
 	}
 
-	if err := h.db.Create(&msg).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"detail": "create message failed"})
-		return
+	var out MsgOut
+	var evs events.Batch
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&msg).Error; err != nil {
+			return err
+		}
+		for _, fid := range fileIDs {
+			if err := tx.Create(&model.MessageAttachment{MessageID: msg.ID, FileID: fid}).Error; err != nil {
+				return err
+			}
+		}
+		// WSイベント（外部への配信はメッセージと一緒にコミットする）
+		out = h.out(tx, &msg)
+		return evs.Add(tx, p.ChannelID.String(), map[string]any{"type": "message_created", "message": out})
+	}); err != nil {
+		return MsgOut{}, err
 	}
+	evs.Broadcast(h.hub)
+	notifyMentions(h.db, h.hub, &msg, out)
+	return out, nil
+}
 
+// out は保存済みのメッセージを応答の形にする（投稿者の表示名・アバターを引く）。
+// db は書き込み中の tx でもよい（コミット前の添付も見える）
+func (h *MessagesHandler) out(db *gorm.DB, msg *model.Message) MsgOut {
 	var disp *string
 	var avatarID *uuid.UUID
 
-	_ = h.db.Table("users").
+	_ = db.Table("users").
 		Select("display_name, avatar_file_id").
-		Where("id = ?", uid).
+		Where("id = ?", msg.UserID).
 		Row().
 		Scan(&disp, &avatarID)
 
-	out := MsgOut{
+	return MsgOut{
 		ID:               msg.ID,
 		WorkspaceID:      msg.WorkspaceID,
 		ChannelID:        msg.ChannelID,
-		UserID:           *msg.UserID,
+		UserID:           derefUUID(msg.UserID),
 		UserDisplayName:  disp,
 		UserAvatarFileID: avatarID,
-		Text:             text,
+		UserAvatarURL:    h.avatars.URLOf(avatarID),
+		Username:         msg.Username,
+		IconURL:          msg.IconURL,
+		Subtype:          msg.Subtype,
+		Text:             derefStr(msg.Text),
+		Rich:             msg.Rich,
+		Blocks:           msg.Blocks,
 		ParentID:         msg.ParentID,
 		ThreadRootID:     msg.ThreadRootID,
 		CreatedAt:        msg.CreatedAt,
+		EditedAt:         msg.EditedAt,
+		FileIDs:          attachments(db, msg.ID)[msg.ID],
+	}
+}
+
+// attachments はメッセージごとの添付ファイル ID（削除済みのファイルは除く）
+func attachments(db *gorm.DB, msgIDs ...uuid.UUID) map[uuid.UUID][]uuid.UUID {
+	out := map[uuid.UUID][]uuid.UUID{}
+	if len(msgIDs) == 0 {
+		return out
+	}
+	var rows []model.MessageAttachment
+	if err := db.Table("message_attachments ma").
+		Select("ma.message_id, ma.file_id").
+		Joins("JOIN files f ON f.id = ma.file_id AND f.deleted_at IS NULL").
+		Where("ma.message_id IN ?", msgIDs).
+		Order("f.created_at").
+		Scan(&rows).Error; err != nil {
+		return out
+	}
+	for _, r := range rows {
+		out[r.MessageID] = append(out[r.MessageID], r.FileID)
+	}
+	return out
+}
+
+func uniqueUUIDs(ids []uuid.UUID) []uuid.UUID {
+	seen := map[uuid.UUID]bool{}
+	out := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// update は本文と blocks を置き換えて message_updated を配信する。
+// blocks が nil なら blocks は消える（置き換えなので元の構造は残さない）
+func (h *MessagesHandler) update(msg *model.Message, text string, blocks []richtext.Block) (MsgOut, error) {
+	if utf8.RuneCountInString(text) > maxMessageText {
+		return MsgOut{}, errPostTooLong
+	}
+	doc := richtext.Parse(text)
+	if err := richtext.Validate(doc); err != nil {
+		return MsgOut{}, fmt.Errorf("%w: %v", errPostInvalidFormat, err)
+	}
+	rich, err := json.Marshal(doc)
+	if err != nil {
+		return MsgOut{}, err
+	}
+	var rawBlocks json.RawMessage
+	if len(blocks) > 0 {
+		if rawBlocks, err = json.Marshal(blocks); err != nil {
+			return MsgOut{}, err
+		}
+	}
+	now := time.Now()
+	var out MsgOut
+	var evs events.Batch
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.Message{}).Where("id = ?", msg.ID).Updates(map[string]any{
+			"text":      text,
+			"rich":      rich,
+			"blocks":    rawBlocks,
+			"edited_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		msg.Text, msg.Rich, msg.Blocks, msg.EditedAt = &text, rich, rawBlocks, &now
+		out = h.out(tx, msg)
+		return evs.Add(tx, msg.ChannelID.String(), map[string]any{"type": "message_updated", "message": out})
+	}); err != nil {
+		return MsgOut{}, err
+	}
+	evs.Broadcast(h.hub)
+	return out, nil
+}
+
+// remove はメッセージを消して message_deleted を配信する（返信の parent_id は NULL になる）
+func (h *MessagesHandler) remove(msg *model.Message) error {
+	var evs events.Batch
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.Message{}, "id = ?", msg.ID).Error; err != nil {
+			return err
+		}
+		ev := map[string]any{"type": "message_deleted", "channel_id": msg.ChannelID, "message_id": msg.ID}
+		return evs.Add(tx, msg.ChannelID.String(), ev)
+	}); err != nil {
+		return err
+	}
+	evs.Broadcast(h.hub)
+	return nil
+}
+
+type MsgUpdateIn struct {
+	Text string `json:"text" binding:"required,min=1,max=40000"`
+	// 置き換える blocks（bot のみ）。省略すると blocks は消える
+	Blocks json.RawMessage `json:"blocks,omitempty" swaggertype:"array,object"`
+}
+
+// Update message godoc
+// @Summary  Edit own message (text, and blocks for bots). Viewers receive message_updated
+// @Tags     messages
+// @Accept   json
+// @Produce  json
+// @Param    channel_id path string      true "Channel ID (UUID)"
+// @Param    message_id path string      true "Message ID (UUID)"
+// @Param    body       body MsgUpdateIn true "new content"
+// @Success  200 {object} MsgOut
+// @Failure  403 {object} map[string]string
+// @Failure  404 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /channels/{channel_id}/messages/{message_id} [patch]
+func (h *MessagesHandler) Update(c *gin.Context) {
+	var in MsgUpdateIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	msg, ok := h.load(c)
+	if !ok {
+		return
+	}
+	if msg.UserID == nil || msg.UserID.String() != c.GetString("user_id") {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "only the author can edit the message"})
+		return
+	}
+	var blocks []richtext.Block
+	if hasBlocks(in.Blocks) {
+		if c.GetString("auth_kind") != middleware.AuthKindBot {
+			c.JSON(http.StatusForbidden, gin.H{"detail": "blocks can only be posted by bots"})
+			return
+		}
+		var err error
+		if blocks, err = richtext.ParseBlocks(in.Blocks); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error(), "code": "invalid_blocks"})
+			return
+		}
+	}
+	out, err := h.update(msg, in.Text, blocks)
+	if err != nil {
+		if errors.Is(err, errPostInvalidFormat) || errors.Is(err, errPostTooLong) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "update failed"})
+		return
 	}
 	c.JSON(http.StatusOK, out)
+}
 
-	// WSイベント
-	ev := map[string]any{"type": "message_created", "message": out}
-	if b, err := json.Marshal(ev); err == nil {
-		h.hub.Broadcast(chID.String(), b)
+// load は :channel_id 内の :message_id を返す。無ければ応答して false
+func (h *MessagesHandler) load(c *gin.Context) (*model.Message, bool) {
+	id, err := uuid.Parse(c.Param("message_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid message_id"})
+		return nil, false
+	}
+	var msg model.Message
+	err = h.db.First(&msg, "id = ? AND channel_id = ?", id, c.Param("channel_id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "message not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return nil, false
 	}
+	return &msg, true
 }
 
 // List messages godoc
@@ -200,13 +549,20 @@ func (h *MessagesHandler) List(c *gin.Context) {
 		ThreadRootID     *uuid.UUID
 		UserDisplayName  *string
 		UserAvatarFileID *uuid.UUID
+		Username         *string
+		IconURL          *string
+		Subtype          *string
+		Rich             json.RawMessage
+		Blocks           json.RawMessage
 		CreatedAt        time.Time
+		EditedAt         *time.Time
 	}
 
 	var rows []row
 
 	q := h.db.Table("messages m").
-		Select(`m.id, m.workspace_id, m.channel_id, m.user_id, m.text, m.parent_id, m.thread_root_id, m.created_at,
+		Select(`m.id, m.workspace_id, m.channel_id, m.user_id, m.text, m.parent_id, m.thread_root_id, m.created_at, m.edited_at,
+			m.username, m.icon_url, m.subtype, m.rich, m.blocks,
 			u.display_name AS user_display_name, u.avatar_file_id AS user_avatar_file_id`).
 		Joins("LEFT JOIN users u ON u.id = m.user_id").
 		Where("m.channel_id = ?", chID)
@@ -227,6 +583,12 @@ func (h *MessagesHandler) List(c *gin.Context) {
 		return
 	}
 
+	ids := make([]uuid.UUID, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, r.ID)
+	}
+	files := attachments(h.db, ids...)
+
 	out := make([]MsgOut, 0, len(rows))
 	for _, r := range rows {
 		out = append(out, MsgOut{
@@ -236,10 +598,18 @@ func (h *MessagesHandler) List(c *gin.Context) {
 			UserID:           derefUUID(r.UserID),
 			UserDisplayName:  r.UserDisplayName,
 			UserAvatarFileID: r.UserAvatarFileID, // ← 追加
+			UserAvatarURL:    h.avatars.URLOf(r.UserAvatarFileID),
+			Username:         r.Username,
+			IconURL:          r.IconURL,
+			Subtype:          r.Subtype,
 			Text:             derefStr(r.Text),
+			Rich:             r.Rich,
+			Blocks:           r.Blocks,
 			ParentID:         r.ParentID,
 			ThreadRootID:     r.ThreadRootID,
 			CreatedAt:        r.CreatedAt,
+			EditedAt:         r.EditedAt,
+			FileIDs:          files[r.ID],
 		})
 	}
 	c.JSON(http.StatusOK, out)
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"slackgo/internal/storage"
+)
+
+// --- ローカルストレージ（STORAGE_DRIVER=local）の署名 URL を受ける ---
+// 認証はヘッダではなく URL の署名で行う（S3 の署名 URL と同じ使い方ができる）
+
+type LocalStorageHandler struct {
+	store *storage.LocalStore
+}
+
+func NewLocalStorageHandler(store *storage.LocalStore) *LocalStorageHandler {
+	return &LocalStorageHandler{store: store}
+}
+
+// grant は署名を確かめる。だめなら応答して nil
+func (h *LocalStorageHandler) grant(c *gin.Context) (string, *storage.LocalGrant) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	g, err := h.store.Verify(key, c.Request.URL.Query())
+	switch {
+	case errors.Is(err, storage.ErrURLExpired):
+		c.JSON(http.StatusForbidden, gin.H{"detail": "signed url expired", "code": "url_expired"})
+		return "", nil
+	case err != nil:
+		c.JSON(http.StatusForbidden, gin.H{"detail": "invalid signature", "code": "bad_signature"})
+		return "", nil
+	}
+	return key, g
+}
+
+// Put godoc
+// @Summary  Upload an object to a signed URL (local storage driver only)
+// @Tags     files
+// @Accept   application/octet-stream
+// @Param    key path string true "Storage key"
+// @Success  200 "ETag header is set"
+// @Failure  403 {object} map[string]string
+// @Router   /storage/local/{key} [put]
+func (h *LocalStorageHandler) Put(c *gin.Context) {
+	key, g := h.grant(c)
+	if g == nil {
+		return
+	}
+	if g.Op != storage.LocalOpPut && g.Op != storage.LocalOpPart {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "url is not for uploads", "code": "bad_signature"})
+		return
+	}
+	// S3 と同じく署名した長さ・Content-Type と違う PUT は受け付けない
+	if c.Request.ContentLength != g.Length {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "Content-Length does not match the signed length", "code": "bad_signature"})
+		return
+	}
+	if g.Op == storage.LocalOpPut && g.ContentType != "" && c.GetHeader("Content-Type") != g.ContentType {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "Content-Type does not match the signed type", "code": "bad_signature"})
+		return
+	}
+
+	var etag string
+	var err error
+	if g.Op == storage.LocalOpPart {
+		etag, err = h.store.WritePart(key, g.UploadID, g.PartNumber, c.Request.Body, g.Length)
+	} else {
+		etag, err = h.store.WriteObject(key, g.ContentType, c.Request.Body, g.Length)
+	}
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"detail": "no such upload", "code": "upload_not_found"})
+		return
+	case errors.Is(err, storage.ErrSizeMismatch):
+		c.JSON(http.StatusBadRequest, gin.H{"detail": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "write failed"})
+		return
+	}
+	c.Header("ETag", `"`+etag+`"`)
+	c.Status(http.StatusOK)
+}
+
+// Get godoc
+// @Summary  Download an object from a signed URL (local storage driver only)
+// @Tags     files
+// @Param    key path string true "Storage key"
+// @Success  200
+// @Failure  403 {object} map[string]string
+// @Failure  404 {object} map[string]string
+// @Router   /storage/local/{key} [get]
+func (h *LocalStorageHandler) Get(c *gin.Context) {
+	key, g := h.grant(c)
+	if g == nil {
+		return
+	}
+	if g.Op != storage.LocalOpGet {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "url is not for downloads", "code": "bad_signature"})
+		return
+	}
+	f, info, err := h.store.Open(key)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "object not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "read failed"})
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "read failed"})
+		return
+	}
+	// API と同じオリジンから配るので、HTML や SVG などをページとして開かせない
+	c.Header("Content-Type", g.ContentType)
+	c.Header("Content-Disposition", safeDisposition(g.ContentType, g.Disposition))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "sandbox")
+	if info.ETag != "" {
+		c.Header("ETag", `"`+info.ETag+`"`)
+	}
+	http.ServeContent(c.Writer, c.Request, "", st.ModTime(), f) // Range にも応える
+}
+
+// inlineTypes はそのまま表示してよい形式（スクリプトを含められないラスター画像）
+var inlineTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp"}
+
+// safeDisposition は inlineTypes 以外を attachment（ダウンロード）にする
+func safeDisposition(contentType, disposition string) string {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	if slices.Contains(inlineTypes, mt) && disposition != "" {
+		return disposition
+	}
+	if rest, ok := strings.CutPrefix(disposition, "inline"); ok {
+		return "attachment" + rest
+	}
+	if disposition == "" {
+		return "attachment"
+	}
+	return disposition
+}
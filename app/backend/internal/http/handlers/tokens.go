@@ -0,0 +1,485 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+
+	"slackgo/internal/apitoken"
+	"slackgo/internal/authz"
+	"slackgo/internal/model"
+)
+
+// --- PAT（personal access token）と bot ---
+
+type TokensHandler struct {
+	db *gorm.DB
+}
+
+func NewTokensHandler(db *gorm.DB) *TokensHandler {
+	return &TokensHandler{db: db}
+}
+
+type CreateTokenIn struct {
+	Name   string   `json:"name" binding:"required,max=80" example:"ci-deploy"`
+	Scopes []string `json:"scopes" binding:"required,min=1" example:"chat:write"`
+	// 有効日数（省略で無期限。最大 365）
+	ExpiresInDays *int `json:"expires_in_days" binding:"omitempty,min=1,max=365" example:"90"`
+}
+
+type CreatedTokenOut struct {
+	model.APIToken
+	// Token は平文。この応答でしか返さない
+	Token string `json:"token"`
+}
+
+type CreateBotIn struct {
+	Name        string  `json:"name" binding:"required,max=80" example:"deploy-bot"`
+	DisplayName *string `json:"display_name" binding:"omitempty,max=255"`
+}
+
+type BotOut struct {
+	model.Bot
+	DisplayName *string `json:"display_name,omitempty"`
+}
+
+var errBotNotFound = errors.New("bot not found")
+
+// createBot は bot ユーザー（users.is_bot）と bots 行を作り、ワークスペースに member として入れる
+func createBot(tx *gorm.DB, wsID uuid.UUID, name string, displayName *string, creator uuid.UUID) (*model.Bot, error) {
+	u := model.User{DisplayName: displayName, IsBot: true}
+	if err := tx.Create(&u).Error; err != nil {
+		return nil, err
+	}
+	b := model.Bot{UserID: u.ID, WorkspaceID: wsID, Name: name, CreatedBy: &creator}
+	if err := tx.Create(&b).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&model.WorkspaceMember{
+		UserID: u.ID, WorkspaceID: wsID, Role: string(authz.RoleMember),
+	}).Error; err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// deactivateBot は bot を無効化し、トークン失効・ワークスペース/チャンネルからの退出まで行う
+func deactivateBot(tx *gorm.DB, b *model.Bot) error {
+	now := time.Now()
+	if err := tx.Model(&model.Bot{}).Where("user_id = ? AND deactivated_at IS NULL", b.UserID).
+		Update("deactivated_at", now).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&model.APIToken{}).Where("user_id = ? AND revoked_at IS NULL", b.UserID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec(`DELETE FROM channel_members WHERE user_id = ?
+		AND channel_id IN (SELECT id FROM channels WHERE workspace_id = ?)`, b.UserID, b.WorkspaceID).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ? AND workspace_id = ?", b.UserID, b.WorkspaceID).
+		Delete(&model.WorkspaceMember{}).Error
+}
+
+// issueToken は入力を検証して api_tokens を作る。エラー時は応答済み
+func (h *TokensHandler) issueToken(c *gin.Context, userID uuid.UUID, kind string) (*CreatedTokenOut, bool) {
+	var in CreateTokenIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return nil, false
+	}
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "name must not be empty"})
+		return nil, false
+	}
+	scopes, err := apitoken.NormalizeScopes(in.Scopes)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error(), "allowed": authz.AllScopes})
+		return nil, false
+	}
+	// bot は member ロール固定なので admin スコープは意味がない
+	if kind == apitoken.KindBot && authz.HasScope(scopes, authz.ScopeAdmin) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "admin scope is not allowed for bots"})
+		return nil, false
+	}
+
+	creator := uuid.MustParse(c.GetString("user_id"))
+	rec := model.APIToken{UserID: userID, Kind: kind, Name: name, CreatedBy: &creator}
+	if in.ExpiresInDays != nil {
+		exp := time.Now().Add(time.Duration(*in.ExpiresInDays) * 24 * time.Hour)
+		rec.ExpiresAt = &exp
+	}
+	raw, err := apitoken.Issue(h.db, &rec, scopes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "issue token failed"})
+		return nil, false
+	}
+	return &CreatedTokenOut{APIToken: rec, Token: raw}, true
+}
+
+func (h *TokensHandler) listTokens(c *gin.Context, userID uuid.UUID) {
+	rows := []model.APIToken{}
+	if err := h.db.Where("user_id = ?", userID).
+		Order("created_at DESC").Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+func (h *TokensHandler) revokeToken(c *gin.Context, userID uuid.UUID) {
+	tokenID, err := uuid.Parse(c.Param("token_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid token_id"})
+		return
+	}
+	err = apitoken.Revoke(h.db, userID, tokenID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "token not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "revoke failed"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListMine godoc
+// @Summary  List my personal access tokens (plaintext is never returned)
+// @Tags     tokens
+// @Produce  json
+// @Success  200 {array} model.APIToken
+// @Security Bearer
+// @Router   /auth/tokens [get]
+func (h *TokensHandler) ListMine(c *gin.Context) {
+	h.listTokens(c, uuid.MustParse(c.GetString("user_id")))
+}
+
+// CreateMine godoc
+// @Summary  Create personal access token (the token is shown only once)
+// @Tags     tokens
+// @Accept   json
+// @Produce  json
+// @Param    body body CreateTokenIn true "token"
+// @Success  200 {object} handlers.CreatedTokenOut
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /auth/tokens [post]
+func (h *TokensHandler) CreateMine(c *gin.Context) {
+	out, ok := h.issueToken(c, uuid.MustParse(c.GetString("user_id")), apitoken.KindPersonal)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// RevokeMine godoc
+// @Summary  Revoke my personal access token
+// @Tags     tokens
+// @Param    token_id path string true "Token ID (UUID)"
+// @Success  204
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /auth/tokens/{token_id} [delete]
+func (h *TokensHandler) RevokeMine(c *gin.Context) {
+	h.revokeToken(c, uuid.MustParse(c.GetString("user_id")))
+}
+
+// loadBot は ws_id 配下の bot を返す。無ければ応答して nil
+func (h *TokensHandler) loadBot(c *gin.Context) *model.Bot {
+	botID, err := uuid.Parse(c.Param("bot_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid bot_id"})
+		return nil
+	}
+	var b model.Bot
+	err = h.db.First(&b, "user_id = ? AND workspace_id = ?", botID, c.Param("ws_id")).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"detail": errBotNotFound.Error()})
+		return nil
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return nil
+	}
+	return &b
+}
+
+// ListBots godoc
+// @Summary  List bots in the workspace (admin)
+// @Tags     bots
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Success  200 {array} handlers.BotOut
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/bots [get]
+func (h *TokensHandler) ListBots(c *gin.Context) {
+	rows := []BotOut{}
+	if err := h.db.Table("bots b").
+		Select("b.*, u.display_name").
+		Joins("JOIN users u ON u.id = b.user_id").
+		Where("b.workspace_id = ?", c.Param("ws_id")).
+		Order("b.created_at ASC").
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+// CreateBot godoc
+// @Summary  Create bot user in the workspace (admin). Invite it to channels to let it post
+// @Tags     bots
+// @Accept   json
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Param    body  body CreateBotIn true "bot"
+// @Success  200 {object} handlers.BotOut
+// @Failure  409 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/bots [post]
+func (h *TokensHandler) CreateBot(c *gin.Context) {
+	wsID, err := uuid.Parse(c.Param("ws_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid ws_id"})
+		return
+	}
+	var in CreateBotIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	name, ok := normalizeHandle(in.Name)
+	if !ok {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "invalid name"})
+		return
+	}
+	disp := emptyToNil(in.DisplayName)
+	if disp == nil {
+		disp = &name
+	}
+	creator := uuid.MustParse(c.GetString("user_id"))
+
+	var out BotOut
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		b, err := createBot(tx, wsID, name, disp, creator)
+		if err != nil {
+			return err
+		}
+		out = BotOut{Bot: *b, DisplayName: disp}
+		return nil
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		c.JSON(http.StatusConflict, gin.H{"detail": "bot name already exists in this workspace"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "create bot failed"})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// DeactivateBot godoc
+// @Summary  Deactivate bot (admin). Its tokens stop working and it leaves the workspace
+// @Tags     bots
+// @Param    ws_id  path string true "Workspace ID (UUID)"
+// @Param    bot_id path string true "Bot user ID (UUID)"
+// @Success  204
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/bots/{bot_id} [delete]
+func (h *TokensHandler) DeactivateBot(c *gin.Context) {
+	b := h.loadBot(c)
+	if b == nil {
+		return
+	}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		return deactivateBot(tx, b)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "deactivate failed"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+type UpdateBotIn struct {
+	// ボタン・セレクトの操作を受け取る URL。空文字で解除
+	InteractionURL *string `json:"interaction_url" binding:"omitempty,max=2048" example:"https://bot.example.com/interactions"`
+}
+
+type BotSecretOut struct {
+	BotOut
+	// 署名鍵。発行・再発行した応答でしか返さない
+	SigningSecret string `json:"signing_secret,omitempty"`
+}
+
+// UpdateBot godoc
+// @Summary  Set bot interaction URL (admin). A signing secret is issued the first time and shown only once
+// @Tags     bots
+// @Accept   json
+// @Produce  json
+// @Param    ws_id  path string      true "Workspace ID (UUID)"
+// @Param    bot_id path string      true "Bot user ID (UUID)"
+// @Param    body   body UpdateBotIn true "settings"
+// @Success  200 {object} handlers.BotSecretOut
+// @Failure  404 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/bots/{bot_id} [patch]
+func (h *TokensHandler) UpdateBot(c *gin.Context) {
+	var in UpdateBotIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	b := h.loadBot(c)
+	if b == nil {
+		return
+	}
+	if b.DeactivatedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"detail": "bot is deactivated"})
+		return
+	}
+
+	out := BotSecretOut{}
+	if in.InteractionURL != nil {
+		u := emptyToNil(in.InteractionURL)
+		if u != nil {
+			if err := validateEventURL(*u); err != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+				return
+			}
+			if b.SigningSecret == nil {
+				secret, err := newSigningSecret()
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, gin.H{"detail": "update failed"})
+					return
+				}
+				b.SigningSecret = &secret
+				out.SigningSecret = secret
+			}
+		}
+		b.InteractionURL = u
+		if err := h.db.Model(&model.Bot{}).Where("user_id = ?", b.UserID).Updates(map[string]any{
+			"interaction_url": b.InteractionURL,
+			"signing_secret":  b.SigningSecret,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"detail": "update failed"})
+			return
+		}
+	}
+	out.BotOut = h.botOut(b)
+	c.JSON(http.StatusOK, out)
+}
+
+// RotateBotSecret godoc
+// @Summary  Issue a new signing secret for bot interactions (admin). The old one stops working immediately
+// @Tags     bots
+// @Produce  json
+// @Param    ws_id  path string true "Workspace ID (UUID)"
+// @Param    bot_id path string true "Bot user ID (UUID)"
+// @Success  200 {object} handlers.BotSecretOut
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/bots/{bot_id}/rotate-secret [post]
+func (h *TokensHandler) RotateBotSecret(c *gin.Context) {
+	b := h.loadBot(c)
+	if b == nil {
+		return
+	}
+	secret, err := newSigningSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "rotate failed"})
+		return
+	}
+	if err := h.db.Model(&model.Bot{}).Where("user_id = ?", b.UserID).
+		Update("signing_secret", secret).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "rotate failed"})
+		return
+	}
+	b.SigningSecret = &secret
+	c.JSON(http.StatusOK, BotSecretOut{BotOut: h.botOut(b), SigningSecret: secret})
+}
+
+func (h *TokensHandler) botOut(b *model.Bot) BotOut {
+	out := BotOut{Bot: *b}
+	_ = h.db.Table("users").Select("display_name").Where("id = ?", b.UserID).Row().Scan(&out.DisplayName)
+	return out
+}
+
+// ListBotTokens godoc
+// @Summary  List bot tokens (admin)
+// @Tags     bots
+// @Produce  json
+// @Param    ws_id  path string true "Workspace ID (UUID)"
+// @Param    bot_id path string true "Bot user ID (UUID)"
+// @Success  200 {array} model.APIToken
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/bots/{bot_id}/tokens [get]
+func (h *TokensHandler) ListBotTokens(c *gin.Context) {
+	b := h.loadBot(c)
+	if b == nil {
+		return
+	}
+	h.listTokens(c, b.UserID)
+}
+
+// CreateBotToken godoc
+// @Summary  Issue bot token (admin, the token is shown only once)
+// @Tags     bots
+// @Accept   json
+// @Produce  json
+// @Param    ws_id  path string true "Workspace ID (UUID)"
+// @Param    bot_id path string true "Bot user ID (UUID)"
+// @Param    body   body CreateTokenIn true "token"
+// @Success  200 {object} handlers.CreatedTokenOut
+// @Failure  409 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/bots/{bot_id}/tokens [post]
+func (h *TokensHandler) CreateBotToken(c *gin.Context) {
+	b := h.loadBot(c)
+	if b == nil {
+		return
+	}
+	if b.DeactivatedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"detail": "bot is deactivated"})
+		return
+	}
+	out, ok := h.issueToken(c, b.UserID, apitoken.KindBot)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// RevokeBotToken godoc
+// @Summary  Revoke bot token (admin)
+// @Tags     bots
+// @Param    ws_id    path string true "Workspace ID (UUID)"
+// @Param    bot_id   path string true "Bot user ID (UUID)"
+// @Param    token_id path string true "Token ID (UUID)"
+// @Success  204
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/bots/{bot_id}/tokens/{token_id} [delete]
+func (h *TokensHandler) RevokeBotToken(c *gin.Context) {
+	b := h.loadBot(c)
+	if b == nil {
+		return
+	}
+	h.revokeToken(c, b.UserID)
+}
@@ -0,0 +1,596 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"slackgo/internal/authz"
+	"slackgo/internal/events"
+	"slackgo/internal/model"
+	"slackgo/internal/ws"
+)
+
+// --- ユーザーグループ（@handle） ---
+
+type UserGroupsHandler struct {
+	db  *gorm.DB
+	hub *ws.Hub
+}
+
+func NewUserGroupsHandler(db *gorm.DB, hub *ws.Hub) *UserGroupsHandler {
+	return &UserGroupsHandler{db: db, hub: hub}
+}
+
+type CreateUserGroupIn struct {
+	// @ なしのハンドル（英小文字・数字・. _ -）
+	Handle      string   `json:"handle" binding:"required,max=80" example:"backend-team"`
+	Name        string   `json:"name" binding:"required,max=255" example:"Backend Team"`
+	Description *string  `json:"description"`
+	UserIDs     []string `json:"user_ids" binding:"omitempty,dive,uuid"`
+	ChannelIDs  []string `json:"channel_ids" binding:"omitempty,dive,uuid"` // デフォルトチャンネル
+}
+
+type UpdateUserGroupIn struct {
+	Handle      *string `json:"handle" binding:"omitempty,max=80"`
+	Name        *string `json:"name" binding:"omitempty,max=255"`
+	Description *string `json:"description"`
+}
+
+type UserGroupIDsIn struct {
+	IDs []string `json:"ids" binding:"required,dive,uuid"`
+}
+
+type UserGroupOut struct {
+	model.UserGroup
+	UserIDs    []uuid.UUID `json:"user_ids"`
+	ChannelIDs []uuid.UUID `json:"channel_ids"`
+}
+
+var (
+	handleRe = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,79}$`)
+
+	errGroupNotFound   = errors.New("user group not found")
+	errGroupBadMember  = errors.New("user is not a workspace member")
+	errGroupBadChannel = errors.New("channel does not belong to the workspace")
+	// 招待できないプライベートチャンネルをデフォルトにして、グループ経由で入り込めないようにする
+	errGroupPrivateChannel = errors.New("only members of a private channel can make it a default channel")
+)
+
+func normalizeHandle(s string) (string, bool) {
+	h := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "@"))
+	return h, handleRe.MatchString(h)
+}
+
+func parseUUIDs(ss []string) []uuid.UUID {
+	out := make([]uuid.UUID, 0, len(ss))
+	seen := map[uuid.UUID]struct{}{}
+	for _, s := range ss {
+		id := uuid.MustParse(s) // binding で uuid 検証済み
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		out = append(out, id)
+	}
+	return out
+}
+
+func (h *UserGroupsHandler) load(tx *gorm.DB, wsID, groupID uuid.UUID) (*UserGroupOut, error) {
+	var g model.UserGroup
+	if err := tx.First(&g, "id = ? AND workspace_id = ?", groupID, wsID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errGroupNotFound
+		}
+		return nil, err
+	}
+	out := &UserGroupOut{UserGroup: g, UserIDs: []uuid.UUID{}, ChannelIDs: []uuid.UUID{}}
+	if err := tx.Model(&model.UserGroupMember{}).Where("group_id = ?", g.ID).
+		Order("created_at ASC").Pluck("user_id", &out.UserIDs).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Model(&model.UserGroupChannel{}).Where("group_id = ?", g.ID).
+		Pluck("channel_id", &out.ChannelIDs).Error; err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// groupOp はグループ操作の tx・操作した人・参加イベント（コミット後に流す）
+type groupOp struct {
+	tx     *gorm.DB
+	caller uuid.UUID
+	evs    events.Batch
+}
+
+// addGroupMembers はメンバーを追加し、追加された人をデフォルトチャンネルへ参加させる
+func addGroupMembers(op *groupOp, wsID, groupID uuid.UUID, userIDs []uuid.UUID) error {
+	tx := op.tx
+	if len(userIDs) == 0 {
+		return nil
+	}
+	var n int64
+	if err := tx.Table("workspace_members").
+		Where("workspace_id = ? AND user_id IN ?", wsID, userIDs).
+		Count(&n).Error; err != nil {
+		return err
+	}
+	if int(n) != len(userIDs) {
+		return errGroupBadMember
+	}
+	for _, uid := range userIDs {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.UserGroupMember{GroupID: groupID, UserID: uid}).Error; err != nil {
+			return err
+		}
+	}
+	var chIDs []uuid.UUID
+	if err := tx.Model(&model.UserGroupChannel{}).Where("group_id = ?", groupID).
+		Pluck("channel_id", &chIDs).Error; err != nil {
+		return err
+	}
+	return joinDefaultChannels(op, userIDs, chIDs)
+}
+
+// addGroupChannels はデフォルトチャンネルを追加し、現メンバーをそのチャンネルへ参加させる。
+// プライベートチャンネルは操作した人がそのメンバー（＝招待できる人）のときだけ
+func addGroupChannels(op *groupOp, wsID, groupID uuid.UUID, chIDs []uuid.UUID) error {
+	if len(chIDs) == 0 {
+		return nil
+	}
+	tx := op.tx
+	var n int64
+	if err := tx.Table("channels").
+		Where("workspace_id = ? AND id IN ?", wsID, chIDs).
+		Count(&n).Error; err != nil {
+		return err
+	}
+	if int(n) != len(chIDs) {
+		return errGroupBadChannel
+	}
+	closed, err := closedChannels(op, chIDs)
+	if err != nil {
+		return err
+	}
+	if len(closed) > 0 {
+		return errGroupPrivateChannel
+	}
+	for _, chID := range chIDs {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.UserGroupChannel{GroupID: groupID, ChannelID: chID}).Error; err != nil {
+			return err
+		}
+	}
+	var userIDs []uuid.UUID
+	if err := tx.Model(&model.UserGroupMember{}).Where("group_id = ?", groupID).
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return err
+	}
+	return joinDefaultChannels(op, userIDs, chIDs)
+}
+
+// closedChannels は chIDs のうち、操作した人がメンバーでないプライベートチャンネル（招待できないもの）
+func closedChannels(op *groupOp, chIDs []uuid.UUID) (map[uuid.UUID]bool, error) {
+	var ids []uuid.UUID
+	if err := op.tx.Table("channels c").
+		Where("c.id IN ? AND c.is_private", chIDs).
+		Where("NOT EXISTS (SELECT 1 FROM channel_members cm WHERE cm.channel_id = c.id AND cm.user_id = ?)", op.caller).
+		Pluck("c.id", &ids).Error; err != nil {
+		return nil, err
+	}
+	closed := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		closed[id] = true
+	}
+	return closed, nil
+}
+
+// joinDefaultChannels は users × channels を channel_members へ追加し、member_joined_channel を積む。
+// single_channel_guest の上限に当たるもの、操作した人が招待できないプライベートチャンネル
+// （別の人がデフォルトにしたもの）はスキップ（グループ操作自体は失敗させない）
+func joinDefaultChannels(op *groupOp, userIDs, chIDs []uuid.UUID) error {
+	if len(userIDs) == 0 || len(chIDs) == 0 {
+		return nil
+	}
+	closed, err := closedChannels(op, chIDs)
+	if err != nil {
+		return err
+	}
+	for _, chID := range chIDs {
+		if closed[chID] {
+			log.Printf("[usergroups] skip auto-join channel=%s: caller %s cannot invite to it", chID, op.caller)
+			continue
+		}
+		for _, uid := range userIDs {
+			added, err := addChannelMember(op.tx, chID, uid, authz.ChannelRoleMember)
+			if errors.Is(err, authz.ErrSingleChannelGuestLimit) || errors.Is(err, errNotWorkspaceMember) {
+				log.Printf("[usergroups] skip auto-join user=%s channel=%s: %v", uid, chID, err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !added {
+				continue
+			}
+			if err := memberEvent(op.tx, &op.evs, events.TypeMemberJoinedChannel, chID, uid); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// diffUUIDs は want にあって have に無いもの / have にあって want に無いもの
+func diffUUIDs(have, want []uuid.UUID) (added, removed []uuid.UUID) {
+	hs := map[uuid.UUID]struct{}{}
+	for _, id := range have {
+		hs[id] = struct{}{}
+	}
+	ws := map[uuid.UUID]struct{}{}
+	for _, id := range want {
+		ws[id] = struct{}{}
+		if _, ok := hs[id]; !ok {
+			added = append(added, id)
+		}
+	}
+	for _, id := range have {
+		if _, ok := ws[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	return added, removed
+}
+
+func (h *UserGroupsHandler) respondErr(c *gin.Context, err error, fallback string) {
+	var pgErr *pgconn.PgError
+	switch {
+	case errors.Is(err, errGroupNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"detail": err.Error()})
+	case errors.Is(err, errGroupBadMember), errors.Is(err, errGroupBadChannel):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+	case errors.Is(err, errGroupPrivateChannel):
+		c.JSON(http.StatusForbidden, gin.H{"detail": err.Error(), "code": "private_channel_not_member"})
+	case errors.As(err, &pgErr) && pgErr.Code == "23505":
+		c.JSON(http.StatusConflict, gin.H{
+			"detail": "handle already exists in this workspace",
+			"code":   "usergroup_handle_conflict",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": fallback})
+	}
+}
+
+func groupParams(c *gin.Context) (wsID, groupID uuid.UUID, ok bool) {
+	var err1, err2 error
+	wsID, err1 = uuid.Parse(c.Param("ws_id"))
+	groupID, err2 = uuid.Parse(c.Param("group_id"))
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "bad params"})
+		return
+	}
+	return wsID, groupID, true
+}
+
+// List godoc
+// @Summary  List user groups in the workspace
+// @Tags     usergroups
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Success  200 {array} model.UserGroup
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/usergroups [get]
+func (h *UserGroupsHandler) List(c *gin.Context) {
+	rows := []model.UserGroup{}
+	if err := h.db.Where("workspace_id = ?", c.Param("ws_id")).
+		Order("handle ASC").Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+// Get godoc
+// @Summary  Get a user group with members and default channels
+// @Tags     usergroups
+// @Produce  json
+// @Param    ws_id    path string true "Workspace ID (UUID)"
+// @Param    group_id path string true "User group ID (UUID)"
+// @Success  200 {object} handlers.UserGroupOut
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/usergroups/{group_id} [get]
+func (h *UserGroupsHandler) Get(c *gin.Context) {
+	wsID, groupID, ok := groupParams(c)
+	if !ok {
+		return
+	}
+	out, err := h.load(h.db, wsID, groupID)
+	if err != nil {
+		h.respondErr(c, err, "lookup failed")
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// Create godoc
+// @Summary  Create user group (admin)
+// @Tags     usergroups
+// @Accept   json
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Param    body  body CreateUserGroupIn true "group"
+// @Success  200 {object} handlers.UserGroupOut
+// @Failure  403 {object} map[string]string
+// @Failure  409 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/usergroups [post]
+func (h *UserGroupsHandler) Create(c *gin.Context) {
+	wsID, err := uuid.Parse(c.Param("ws_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid ws_id"})
+		return
+	}
+	uid := uuid.MustParse(c.GetString("user_id"))
+	var in CreateUserGroupIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	handle, ok := normalizeHandle(in.Handle)
+	if !ok {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "invalid handle"})
+		return
+	}
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "name must not be empty"})
+		return
+	}
+
+	var out *UserGroupOut
+	op := groupOp{caller: uid}
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		op.tx = tx
+		g := model.UserGroup{
+			WorkspaceID: wsID,
+			Handle:      handle,
+			Name:        name,
+			Description: in.Description,
+			CreatedBy:   &uid,
+		}
+		if err := tx.Create(&g).Error; err != nil {
+			return err
+		}
+		// 先にチャンネル→メンバーの順で入れると、メンバー追加時に自動参加まで済む
+		if err := addGroupChannels(&op, wsID, g.ID, parseUUIDs(in.ChannelIDs)); err != nil {
+			return err
+		}
+		if err := addGroupMembers(&op, wsID, g.ID, parseUUIDs(in.UserIDs)); err != nil {
+			return err
+		}
+		var err error
+		out, err = h.load(tx, wsID, g.ID)
+		return err
+	})
+	if err != nil {
+		h.respondErr(c, err, "create user group failed")
+		return
+	}
+	c.JSON(http.StatusOK, out)
+	op.evs.Broadcast(h.hub)
+}
+
+// Update godoc
+// @Summary  Update user group handle/name/description (admin)
+// @Tags     usergroups
+// @Accept   json
+// @Produce  json
+// @Param    ws_id    path string true "Workspace ID (UUID)"
+// @Param    group_id path string true "User group ID (UUID)"
+// @Param    body     body UpdateUserGroupIn true "fields to change"
+// @Success  200 {object} handlers.UserGroupOut
+// @Failure  404 {object} map[string]string
+// @Failure  409 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/usergroups/{group_id} [patch]
+func (h *UserGroupsHandler) Update(c *gin.Context) {
+	wsID, groupID, ok := groupParams(c)
+	if !ok {
+		return
+	}
+	var in UpdateUserGroupIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	updates := map[string]any{}
+	if in.Handle != nil {
+		handle, ok := normalizeHandle(*in.Handle)
+		if !ok {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "invalid handle"})
+			return
+		}
+		updates["handle"] = handle
+	}
+	if in.Name != nil {
+		name := strings.TrimSpace(*in.Name)
+		if name == "" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "name must not be empty"})
+			return
+		}
+		updates["name"] = name
+	}
+	if in.Description != nil {
+		updates["description"] = emptyToNil(in.Description)
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "no changes"})
+		return
+	}
+
+	var out *UserGroupOut
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&model.UserGroup{}).
+			Where("id = ? AND workspace_id = ?", groupID, wsID).
+			Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errGroupNotFound
+		}
+		var err error
+		out, err = h.load(tx, wsID, groupID)
+		return err
+	})
+	if err != nil {
+		h.respondErr(c, err, "update failed")
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+// Delete godoc
+// @Summary  Delete user group (admin). Channel memberships are kept
+// @Tags     usergroups
+// @Param    ws_id    path string true "Workspace ID (UUID)"
+// @Param    group_id path string true "User group ID (UUID)"
+// @Success  204
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/usergroups/{group_id} [delete]
+func (h *UserGroupsHandler) Delete(c *gin.Context) {
+	wsID, groupID, ok := groupParams(c)
+	if !ok {
+		return
+	}
+	res := h.db.Where("id = ? AND workspace_id = ?", groupID, wsID).Delete(&model.UserGroup{})
+	if res.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "delete failed"})
+		return
+	}
+	if res.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"detail": errGroupNotFound.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// SetMembers godoc
+// @Summary  Replace user group members (admin). New members auto-join the default channels
+// @Tags     usergroups
+// @Accept   json
+// @Produce  json
+// @Param    ws_id    path string true "Workspace ID (UUID)"
+// @Param    group_id path string true "User group ID (UUID)"
+// @Param    body     body UserGroupIDsIn true "user IDs"
+// @Success  200 {object} handlers.UserGroupOut
+// @Failure  404 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/usergroups/{group_id}/members [put]
+func (h *UserGroupsHandler) SetMembers(c *gin.Context) {
+	wsID, groupID, ok := groupParams(c)
+	if !ok {
+		return
+	}
+	var in UserGroupIDsIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+
+	var out *UserGroupOut
+	op := groupOp{caller: uuid.MustParse(c.GetString("user_id"))}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		op.tx = tx
+		cur, err := h.load(tx, wsID, groupID)
+		if err != nil {
+			return err
+		}
+		added, removed := diffUUIDs(cur.UserIDs, parseUUIDs(in.IDs))
+		// グループから外してもチャンネルからは外さない
+		if len(removed) > 0 {
+			if err := tx.Where("group_id = ? AND user_id IN ?", groupID, removed).
+				Delete(&model.UserGroupMember{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := addGroupMembers(&op, wsID, groupID, added); err != nil {
+			return err
+		}
+		out, err = h.load(tx, wsID, groupID)
+		return err
+	})
+	if err != nil {
+		h.respondErr(c, err, "update members failed")
+		return
+	}
+	c.JSON(http.StatusOK, out)
+	op.evs.Broadcast(h.hub)
+}
+
+// SetChannels godoc
+// @Summary  Replace user group default channels (admin; private channels only by their members). Current members auto-join added channels
+// @Tags     usergroups
+// @Accept   json
+// @Produce  json
+// @Param    ws_id    path string true "Workspace ID (UUID)"
+// @Param    group_id path string true "User group ID (UUID)"
+// @Param    body     body UserGroupIDsIn true "channel IDs"
+// @Success  200 {object} handlers.UserGroupOut
+// @Failure  403 {object} map[string]string
+// @Failure  404 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/usergroups/{group_id}/channels [put]
+func (h *UserGroupsHandler) SetChannels(c *gin.Context) {
+	wsID, groupID, ok := groupParams(c)
+	if !ok {
+		return
+	}
+	var in UserGroupIDsIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+
+	var out *UserGroupOut
+	op := groupOp{caller: uuid.MustParse(c.GetString("user_id"))}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		op.tx = tx
+		cur, err := h.load(tx, wsID, groupID)
+		if err != nil {
+			return err
+		}
+		added, removed := diffUUIDs(cur.ChannelIDs, parseUUIDs(in.IDs))
+		if len(removed) > 0 {
+			if err := tx.Where("group_id = ? AND channel_id IN ?", groupID, removed).
+				Delete(&model.UserGroupChannel{}).Error; err != nil {
+				return err
+			}
+		}
+		if err := addGroupChannels(&op, wsID, groupID, added); err != nil {
+			return err
+		}
+		out, err = h.load(tx, wsID, groupID)
+		return err
+	})
+	if err != nil {
+		h.respondErr(c, err, "update channels failed")
+		return
+	}
+	c.JSON(http.StatusOK, out)
+	op.evs.Broadcast(h.hub)
+}
@@ -1,31 +1,47 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"slackgo/internal/authz"
+	"slackgo/internal/events"
 	"slackgo/internal/model"
-	"slackgo/internal/storage"
+	"slackgo/internal/profile"
+	"slackgo/internal/ws"
 )
 
 type UsersHandler struct {
-	db     *gorm.DB
-	s3deps *storage.S3Deps
+	db      *gorm.DB
+	hub     *ws.Hub
+	avatars *AvatarURLs
 }
 
-func NewUsersHandler(db *gorm.DB, s3deps *storage.S3Deps) *UsersHandler {
-	return &UsersHandler{db: db, s3deps: s3deps}
+func NewUsersHandler(db *gorm.DB, hub *ws.Hub, avatars *AvatarURLs) *UsersHandler {
+	return &UsersHandler{db: db, hub: hub, avatars: avatars}
 }
 
 type MeOut struct {
-	ID           uuid.UUID  `json:"id"`
-	Email        *string    `json:"email,omitempty"`
-	DisplayName  *string    `json:"display_name,omitempty"`
-	AvatarFileID *uuid.UUID `json:"avatar_file_id,omitempty"`
-	AvatarURL    *string    `json:"avatar_url,omitempty"` // 署名URL(オプション)
+	ID           uuid.UUID       `json:"id"`
+	Email        *string         `json:"email,omitempty"`
+	DisplayName  *string         `json:"display_name,omitempty"`
+	AvatarFileID *uuid.UUID      `json:"avatar_file_id,omitempty"`
+	AvatarURL    *string         `json:"avatar_url,omitempty"` // 署名URL(オプション)
+	Title        *string         `json:"title,omitempty"`
+	Phone        *string         `json:"phone,omitempty"`
+	Timezone     *string         `json:"timezone,omitempty"`
+	Pronouns     *string         `json:"pronouns,omitempty"`
+	Status       *profile.Status `json:"status,omitempty"` // 期限切れは返さない
+}
+
+// avatarURL はアバター画像の URL（/avatars/<file_id>）を返す（未設定なら nil）
+func (h *UsersHandler) avatarURL(fileID *uuid.UUID) *string {
+	return h.avatars.URLOf(fileID)
 }
 
 // GET /users/me
@@ -42,28 +58,7 @@ func (h *UsersHandler) GetMe(c *gin.Context) {
 		return
 	}
 
-	var avatarURL *string
-	if u.AvatarFileID != nil {
-		// files から storage_key / filename / content_type を引く
-		var f struct {
-			StorageKey  string
-			Filename    string
-			ContentType *string
-		}
-		if err := h.db.
-			Table("files").
-			Select("storage_key, filename, content_type").
-			Where("id = ?", *u.AvatarFileID).
-			Take(&f).Error; err == nil && f.StorageKey != "" {
-			ct := ""
-			if f.ContentType != nil {
-				ct = *f.ContentType
-			}
-			if link, err := h.s3deps.SignGetURL(c, f.StorageKey, f.Filename, ct, "inline"); err == nil {
-				avatarURL = &link
-			}
-		}
-	}
+	avatarURL := h.avatarURL(u.AvatarFileID)
 
 	out := MeOut{
 		ID:           u.ID,
@@ -71,6 +66,11 @@ func (h *UsersHandler) GetMe(c *gin.Context) {
 		DisplayName:  u.DisplayName,
 		AvatarFileID: u.AvatarFileID,
 		AvatarURL:    avatarURL,
+		Title:        u.Title,
+		Phone:        u.Phone,
+		Timezone:     u.Timezone,
+		Pronouns:     u.Pronouns,
+		Status:       profile.StatusOf(&u, time.Now()),
 	}
 	c.JSON(http.StatusOK, out)
 }
@@ -78,6 +78,30 @@ func (h *UsersHandler) GetMe(c *gin.Context) {
 type UpdateMeIn struct {
 	DisplayName  *string `json:"display_name"`           // null なら変更なし、"" にしたいなら空文字を送る
 	AvatarFileID *string `json:"avatar_file_id_or_null"` // null: 変更なし, ""(空文字): 画像解除, UUID文字列: 設定
+
+	// 以下も null なら変更なし、"" で解除
+	Title    *string `json:"title"    binding:"omitempty,max=255"`
+	Phone    *string `json:"phone"    binding:"omitempty,max=64"`
+	Timezone *string `json:"timezone" binding:"omitempty,max=64"` // IANA 名（例: Asia/Tokyo）
+	Pronouns *string `json:"pronouns" binding:"omitempty,max=64"`
+
+	// null なら変更なし。emoji/text とも空ならステータス解除
+	Status *StatusIn `json:"status"`
+}
+
+type StatusIn struct {
+	Emoji string `json:"emoji" binding:"max=64"  example:":palm_tree:"`
+	Text  string `json:"text"  binding:"max=100" example:"休暇中"`
+	// 省略時は無期限。過去時刻は不可
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// emptyToNil は "" を NULL として保存するため
+func emptyToNil(s *string) *string {
+	if s == nil || *s == "" {
+		return nil
+	}
+	return s
 }
 
 // PUT /users/me
@@ -99,19 +123,62 @@ func (h *UsersHandler) UpdateMe(c *gin.Context) {
 	if in.DisplayName != nil {
 		updates["display_name"] = in.DisplayName
 	}
+	if in.Title != nil {
+		updates["title"] = emptyToNil(in.Title)
+	}
+	if in.Phone != nil {
+		updates["phone"] = emptyToNil(in.Phone)
+	}
+	if in.Pronouns != nil {
+		updates["pronouns"] = emptyToNil(in.Pronouns)
+	}
+	if in.Timezone != nil {
+		if *in.Timezone != "" {
+			if _, err := time.LoadLocation(*in.Timezone); err != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "invalid timezone"})
+				return
+			}
+		}
+		updates["timezone"] = emptyToNil(in.Timezone)
+	}
+	if st := in.Status; st != nil {
+		if st.Emoji == "" && st.Text == "" {
+			updates["status_emoji"] = nil
+			updates["status_text"] = nil
+			updates["status_expires_at"] = nil
+		} else {
+			if st.ExpiresAt != nil && !st.ExpiresAt.After(time.Now()) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "status expires_at must be in the future"})
+				return
+			}
+			updates["status_emoji"] = emptyToNil(&st.Emoji)
+			updates["status_text"] = emptyToNil(&st.Text)
+			updates["status_expires_at"] = st.ExpiresAt
+		}
+	}
 
 	if in.AvatarFileID != nil {
 		if *in.AvatarFileID == "" {
 			// 空文字なら解除
 			updates["avatar_file_id"] = nil
 		} else {
-			// UUID妥当性だけチェック（存在チェックは任意）
-			if fid, err := uuid.Parse(*in.AvatarFileID); err == nil {
-				updates["avatar_file_id"] = &fid
-			} else {
+			fid, err := uuid.Parse(*in.AvatarFileID)
+			if err != nil {
 				c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid avatar_file_id"})
 				return
 			}
+			// 自分を持ち主として complete したアバター用のファイルに限る（他人のファイルや添付は使えない）
+			var f model.File
+			err = h.db.First(&f, "id = ? AND purpose = ?", fid, "avatar").Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+				return
+			}
+			if err != nil || f.OwnerUserID == nil || f.OwnerUserID.String() != uid {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "avatar_file_id must be an avatar you own", "code": "invalid_avatar_file"})
+				return
+			}
+			updates["avatar_file_id"] = &fid
 		}
 	}
 
@@ -120,12 +187,64 @@ func (h *UsersHandler) UpdateMe(c *gin.Context) {
 		return
 	}
 
-	if err := h.db.Model(&model.User{}).
-		Where("id = ?", uid).
-		Updates(updates).Error; err != nil {
+	var evs events.Batch
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).
+			Where("id = ?", uid).
+			Updates(updates).Error; err != nil {
+			return err
+		}
+		// 同じWSのメンバーへ変更を通知
+		return profile.Publish(tx, &evs, uuid.MustParse(uid))
+	}); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"detail": "update failed"})
 		return
 	}
+	evs.Broadcast(h.hub)
 
 	c.Status(http.StatusNoContent)
 }
+
+// GetUser godoc
+// @Summary  Get a user's profile (only users who share a workspace with me)
+// @Tags     users
+// @Produce  json
+// @Param    id path string true "User ID (UUID)"
+// @Success  200 {object} profile.Profile
+// @Failure  400 {object} map[string]string
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /users/{id} [get]
+func (h *UsersHandler) GetUser(c *gin.Context) {
+	me, err := uuid.Parse(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"detail": "unauthorized"})
+		return
+	}
+	target, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid id"})
+		return
+	}
+
+	// 共有WSが無い相手は存在も明かさない
+	if target != me {
+		ok, err := authz.SharesWorkspace(h.db, me, target)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusNotFound, gin.H{"detail": "user not found"})
+			return
+		}
+	}
+
+	p, err := profile.Load(h.db, target)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "user not found"})
+		return
+	}
+	p.AvatarURL = h.avatarURL(p.AvatarFileID)
+	c.JSON(http.StatusOK, p)
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/apitoken"
+	"slackgo/internal/authz"
+	"slackgo/internal/model"
+	"slackgo/internal/ratelimit"
+	"slackgo/internal/richtext"
+)
+
+// --- Incoming webhook（秘密 URL への POST でチャンネルに投稿） ---
+
+type WebhooksHandler struct {
+	db      *gorm.DB
+	msgs    *MessagesHandler
+	limiter *ratelimit.Limiter
+	baseURL string // 例: https://api.example.com（URL 生成用）
+}
+
+func NewWebhooksHandler(db *gorm.DB, msgs *MessagesHandler, limiter *ratelimit.Limiter, baseURL string) *WebhooksHandler {
+	return &WebhooksHandler{db: db, msgs: msgs, limiter: limiter, baseURL: baseURL}
+}
+
+const webhookTokenPrefix = "whk-"
+
+type CreateWebhookIn struct {
+	// 投稿者として表示される名前（bot の表示名）
+	Name string `json:"name" binding:"required,max=80" example:"Alertmanager"`
+}
+
+type CreatedWebhookOut struct {
+	model.IncomingWebhook
+	// URL は秘密。この応答でしか返さない
+	URL string `json:"url"`
+}
+
+// IncomingWebhookIn は外部から POST される JSON
+type IncomingWebhookIn struct {
+	Text     string  `json:"text" binding:"required,min=1,max=40000" example:"Deploy finished :rocket:"`
+	Username *string `json:"username" binding:"omitempty,max=80" example:"deploy-bot"`
+	// クライアントがそのまま画像として読み込むので http(s) の URL に限る（javascript: や data: は弾く）
+	IconURL  *string `json:"icon_url" binding:"omitempty,http_url,max=2048" example:"https://example.com/deploy.png"`
+	ParentID *string `json:"parent_id" binding:"omitempty,uuid"` // スレッドに返信する場合
+	// Block Kit 風の構造。text は通知用の代替テキスト
+	Blocks json.RawMessage `json:"blocks" swaggertype:"array,object"`
+}
+
+// List godoc
+// @Summary  List incoming webhooks of the channel (URLs are never returned)
+// @Tags     webhooks
+// @Produce  json
+// @Param    channel_id path string true "Channel ID (UUID)"
+// @Success  200 {array} model.IncomingWebhook
+// @Security Bearer
+// @Router   /channels/{channel_id}/webhooks [get]
+func (h *WebhooksHandler) List(c *gin.Context) {
+	rows := []model.IncomingWebhook{}
+	if err := h.db.Where("channel_id = ?", c.Param("channel_id")).
+		Order("created_at ASC").Find(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+// Create godoc
+// @Summary  Create incoming webhook for the channel (channel member). The URL is shown only once
+// @Tags     webhooks
+// @Accept   json
+// @Produce  json
+// @Param    channel_id path string true "Channel ID (UUID)"
+// @Param    body       body CreateWebhookIn true "webhook"
+// @Success  200 {object} handlers.CreatedWebhookOut
+// @Failure  403 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /channels/{channel_id}/webhooks [post]
+func (h *WebhooksHandler) Create(c *gin.Context) {
+	chID, err := uuid.Parse(c.Param("channel_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid channel_id"})
+		return
+	}
+	var in CreateWebhookIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "name must not be empty"})
+		return
+	}
+	// ゲストは webhook を作れない（bot をチャンネルに入れることになるため）
+	if r, _ := authz.ParseRole(c.GetString("workspace_role")); !r.AtLeast(authz.RoleMember) {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "guests cannot create webhooks"})
+		return
+	}
+	var ch model.Channel
+	if err := h.db.First(&ch, "id = ?", chID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "channel not found"})
+		return
+	}
+
+	raw, err := apitoken.NewSecret(webhookTokenPrefix)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "create webhook failed"})
+		return
+	}
+	creator := uuid.MustParse(c.GetString("user_id"))
+	hook := model.IncomingWebhook{
+		ID:          uuid.New(),
+		WorkspaceID: ch.WorkspaceID,
+		ChannelID:   chID,
+		Name:        name,
+		TokenHash:   apitoken.Hash(raw),
+		TokenPrefix: raw[:len(webhookTokenPrefix)+6],
+		CreatedBy:   &creator,
+	}
+
+	// 投稿者は webhook ごとの bot（名前は webhook ID から決める）
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		bot, err := createBot(tx, ch.WorkspaceID, "webhook-"+hook.ID.String()[:8], &name, creator)
+		if err != nil {
+			return err
+		}
+		if _, err := addChannelMember(tx, chID, bot.UserID, authz.ChannelRoleMember); err != nil {
+			return err
+		}
+		hook.BotUserID = bot.UserID
+		return tx.Create(&hook).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "create webhook failed"})
+		return
+	}
+	c.JSON(http.StatusOK, CreatedWebhookOut{IncomingWebhook: hook, URL: h.baseURL + "/hooks/" + raw})
+}
+
+// Delete godoc
+// @Summary  Delete incoming webhook (creator or workspace admin). Its bot is deactivated
+// @Tags     webhooks
+// @Param    channel_id path string true "Channel ID (UUID)"
+// @Param    webhook_id path string true "Webhook ID (UUID)"
+// @Success  204
+// @Failure  403 {object} map[string]string
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /channels/{channel_id}/webhooks/{webhook_id} [delete]
+func (h *WebhooksHandler) Delete(c *gin.Context) {
+	hookID, err := uuid.Parse(c.Param("webhook_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid webhook_id"})
+		return
+	}
+	var hook model.IncomingWebhook
+	if err := h.db.First(&hook, "id = ? AND channel_id = ?", hookID, c.Param("channel_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "webhook not found"})
+		return
+	}
+	role, _ := authz.ParseRole(c.GetString("workspace_role"))
+	isCreator := hook.CreatedBy != nil && hook.CreatedBy.String() == c.GetString("user_id")
+	if !isCreator && !role.AtLeast(authz.RoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "only the creator or an admin can delete"})
+		return
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.IncomingWebhook{}, "id = ?", hook.ID).Error; err != nil {
+			return err
+		}
+		var bot model.Bot
+		if err := tx.First(&bot, "user_id = ?", hook.BotUserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		return deactivateBot(tx, &bot)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "delete failed"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Receive godoc
+// @Summary  Post a message through an incoming webhook (no auth header; the URL is the secret)
+// @Tags     webhooks
+// @Accept   json
+// @Produce  json
+// @Param    token path string true "webhook token"
+// @Param    body  body IncomingWebhookIn true "message"
+// @Success  200 {object} map[string]any
+// @Failure  404 {object} map[string]string
+// @Failure  410 {object} map[string]string
+// @Failure  429 {object} map[string]string
+// @Router   /hooks/{token} [post]
+func (h *WebhooksHandler) Receive(c *gin.Context) {
+	raw := c.Param("token")
+	if !strings.HasPrefix(raw, webhookTokenPrefix) {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "no such webhook"})
+		return
+	}
+	var hook model.IncomingWebhook
+	if err := h.db.First(&hook, "token_hash = ?", apitoken.Hash(raw)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"detail": "no such webhook"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return
+	}
+
+	if ok, wait := h.limiter.Allow(hook.ID.String()); !ok {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"detail": "rate limited", "code": "rate_limited"})
+		return
+	}
+
+	var in IncomingWebhookIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+
+	var blocks []richtext.Block
+	if hasBlocks(in.Blocks) {
+		var err error
+		if blocks, err = richtext.ParseBlocks(in.Blocks); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error(), "code": "invalid_blocks"})
+			return
+		}
+	}
+
+	// bot がチャンネルから外された・無効化された webhook は使えない
+	access, err := authz.Channel(h.db, hook.BotUserID, hook.ChannelID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return
+	}
+	if !access.CanWrite {
+		c.JSON(http.StatusGone, gin.H{"detail": "webhook can no longer post to the channel", "code": "webhook_disabled"})
+		return
+	}
+
+	out, err := h.msgs.post(postParams{
+		ChannelID: hook.ChannelID,
+		UserID:    hook.BotUserID,
+		Text:      in.Text,
+		ParentID:  in.ParentID,
+		Username:  emptyToNil(in.Username),
+		IconURL:   emptyToNil(in.IconURL),
+		WebhookID: &hook.ID,
+		Blocks:    blocks,
+	})
+	if err != nil {
+		respondPostErr(c, err)
+		return
+	}
+
+	// 毎回書き込まないよう、1 分以上経っていれば更新
+	now := time.Now()
+	h.db.Model(&model.IncomingWebhook{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", hook.ID, now.Add(-time.Minute)).
+		Update("last_used_at", now)
+
+	c.JSON(http.StatusOK, gin.H{"ok": true, "message_id": out.ID})
+}
@@ -0,0 +1,409 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"slackgo/internal/authz"
+	"slackgo/internal/model"
+)
+
+// --- ワークスペース管理（admin / owner） ---
+
+type RenameWorkspaceIn struct {
+	// 新しいワークスペース名
+	Name string `json:"name" binding:"required" example:"my-team"`
+}
+
+type ChangeMemberRoleIn struct {
+	// owner は transfer-ownership でのみ付与できる
+	Role string `json:"role" binding:"required,oneof=admin member multi_channel_guest single_channel_guest" example:"admin"`
+}
+
+type TransferOwnershipIn struct {
+	// 新しい owner（ゲスト以外のメンバー）
+	UserID string `json:"user_id" binding:"required,uuid" example:"6d4c2f52-1f1c-4e7d-92a2-4b2d4a3d9a10"`
+}
+
+var (
+	errMemberNotFound = errors.New("member not found")
+	errNotPermitted   = errors.New("not permitted")
+	errGuestOwner     = errors.New("guests cannot become owner")
+	errBotPrivileged  = errors.New("bots cannot become owner or admin")
+)
+
+func isBotUser(tx *gorm.DB, userID uuid.UUID) (bool, error) {
+	var n int64
+	err := tx.Model(&model.User{}).Where("id = ? AND is_bot", userID).Count(&n).Error
+	return n > 0, err
+}
+
+// Rename godoc
+// @Summary  Rename workspace (admin)
+// @Tags     workspaces
+// @Accept   json
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Param    body  body RenameWorkspaceIn true "new name"
+// @Success  200 {object} model.Workspace
+// @Failure  403 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id} [patch]
+func (h *WorkspacesHandler) Rename(c *gin.Context) {
+	var in RenameWorkspaceIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "name must not be empty"})
+		return
+	}
+
+	var ws model.Workspace
+	if err := h.db.First(&ws, "id = ? AND deleted_at IS NULL", c.Param("ws_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "workspace not found"})
+		return
+	}
+	if err := h.db.Model(&ws).Update("name", name).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "update failed"})
+		return
+	}
+	c.JSON(http.StatusOK, ws)
+}
+
+// Delete godoc
+// @Summary  Soft-delete workspace (owner). Restorable until purge_after
+// @Tags     workspaces
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Success  200 {object} model.Workspace
+// @Failure  403 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id} [delete]
+func (h *WorkspacesHandler) Delete(c *gin.Context) {
+	var ws model.Workspace
+	if err := h.db.First(&ws, "id = ? AND deleted_at IS NULL", c.Param("ws_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "workspace not found"})
+		return
+	}
+	now := time.Now()
+	purgeAfter := now.Add(h.purgeGrace)
+	if err := h.db.Model(&ws).Updates(map[string]any{
+		"deleted_at":  now,
+		"purge_after": purgeAfter,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "delete failed"})
+		return
+	}
+	c.JSON(http.StatusOK, ws)
+}
+
+// Restore godoc
+// @Summary  Restore a soft-deleted workspace before it is purged (owner)
+// @Tags     workspaces
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Success  200 {object} model.Workspace
+// @Failure  403 {object} map[string]string
+// @Failure  404 {object} map[string]string
+// @Failure  410 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/restore [post]
+func (h *WorkspacesHandler) Restore(c *gin.Context) {
+	uid, err1 := uuid.Parse(c.GetString("user_id"))
+	wsID, err2 := uuid.Parse(c.Param("ws_id"))
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "bad params"})
+		return
+	}
+	// 削除済みWSは通常の middleware では弾かれるので、ここで owner を確認する
+	role, err := authz.WorkspaceRoleIncludingDeleted(h.db, uid, wsID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return
+	}
+	if role != authz.RoleOwner {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "owner only"})
+		return
+	}
+
+	var ws model.Workspace
+	if err := h.db.First(&ws, "id = ? AND deleted_at IS NOT NULL", wsID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"detail": "workspace is not deleted"})
+		return
+	}
+	if ws.PurgeAfter != nil && !time.Now().Before(*ws.PurgeAfter) {
+		c.JSON(http.StatusGone, gin.H{"detail": "grace period expired"})
+		return
+	}
+	if err := h.db.Model(&ws).Updates(map[string]any{
+		"deleted_at":  nil,
+		"purge_after": nil,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "restore failed"})
+		return
+	}
+	c.JSON(http.StatusOK, ws)
+}
+
+// lockMember は tx 内で対象メンバー行を FOR UPDATE で取る
+func lockMember(tx *gorm.DB, wsID, userID uuid.UUID) (*model.WorkspaceMember, error) {
+	var m model.WorkspaceMember
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("workspace_id = ? AND user_id = ?", wsID, userID).
+		Take(&m).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errMemberNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// canManage は actor が target の役割を変更/除名できるか。
+// owner は誰も触れない（transfer-ownership のみ）。admin を触れるのは owner だけ。
+func canManage(actor, target authz.Role) bool {
+	if target == authz.RoleOwner {
+		return false
+	}
+	if target == authz.RoleAdmin {
+		return actor == authz.RoleOwner
+	}
+	return actor.AtLeast(authz.RoleAdmin)
+}
+
+func (h *WorkspacesHandler) adminParams(c *gin.Context) (actorID, wsID, targetID uuid.UUID, actor authz.Role, ok bool) {
+	var err1, err2, err3 error
+	actorID, err1 = uuid.Parse(c.GetString("user_id"))
+	wsID, err2 = uuid.Parse(c.Param("ws_id"))
+	targetID, err3 = uuid.Parse(c.Param("user_id"))
+	if err1 != nil || err2 != nil || err3 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "bad params"})
+		return
+	}
+	actor, _ = authz.ParseRole(c.GetString("workspace_role"))
+	return actorID, wsID, targetID, actor, true
+}
+
+// ChangeMemberRole godoc
+// @Summary  Change a member's role (admin; granting/revoking admin requires owner)
+// @Tags     workspaces
+// @Accept   json
+// @Produce  json
+// @Param    ws_id   path string true "Workspace ID (UUID)"
+// @Param    user_id path string true "User ID (UUID)"
+// @Param    body    body ChangeMemberRoleIn true "new role"
+// @Success  200 {object} model.WorkspaceMember
+// @Failure  403 {object} map[string]string
+// @Failure  404 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/members/{user_id} [patch]
+func (h *WorkspacesHandler) ChangeMemberRole(c *gin.Context) {
+	actorID, wsID, targetID, actor, ok := h.adminParams(c)
+	if !ok {
+		return
+	}
+	var in ChangeMemberRoleIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	newRole := authz.Role(in.Role)
+	if actorID == targetID {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "cannot change your own role"})
+		return
+	}
+
+	var out *model.WorkspaceMember
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		m, err := lockMember(tx, wsID, targetID)
+		if err != nil {
+			return err
+		}
+		cur, _ := authz.ParseRole(m.Role)
+		if !canManage(actor, cur) || (newRole == authz.RoleAdmin && actor != authz.RoleOwner) {
+			return errNotPermitted
+		}
+		if newRole == authz.RoleAdmin {
+			if bot, err := isBotUser(tx, targetID); err != nil {
+				return err
+			} else if bot {
+				return errBotPrivileged
+			}
+		}
+		// single_channel_guest への降格は所属チャンネルが1つ以下のときだけ
+		if newRole == authz.RoleSingleChannelGuest {
+			var n int64
+			if err := tx.Table("channel_members cm").
+				Joins("JOIN channels ch ON ch.id = cm.channel_id").
+				Where("cm.user_id = ? AND ch.workspace_id = ?", targetID, wsID).
+				Count(&n).Error; err != nil {
+				return err
+			}
+			if n > 1 {
+				return authz.ErrSingleChannelGuestLimit
+			}
+		}
+		m.Role = string(newRole)
+		if err := tx.Model(&model.WorkspaceMember{}).
+			Where("workspace_id = ? AND user_id = ?", wsID, targetID).
+			Update("role", m.Role).Error; err != nil {
+			return err
+		}
+		out = m
+		return nil
+	})
+	switch {
+	case errors.Is(err, errMemberNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"detail": err.Error()})
+	case errors.Is(err, errNotPermitted):
+		c.JSON(http.StatusForbidden, gin.H{"detail": err.Error()})
+	case errors.Is(err, authz.ErrSingleChannelGuestLimit):
+		c.JSON(http.StatusConflict, gin.H{"detail": err.Error(), "code": "single_channel_guest_limit"})
+	case errors.Is(err, errBotPrivileged):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "update failed"})
+	default:
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// RemoveMember godoc
+// @Summary  Remove a member from the workspace and all of its channels (admin, or self to leave)
+// @Tags     workspaces
+// @Produce  json
+// @Param    ws_id   path string true "Workspace ID (UUID)"
+// @Param    user_id path string true "User ID (UUID)"
+// @Success  204
+// @Failure  403 {object} map[string]string
+// @Failure  404 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/members/{user_id} [delete]
+func (h *WorkspacesHandler) RemoveMember(c *gin.Context) {
+	actorID, wsID, targetID, actor, ok := h.adminParams(c)
+	if !ok {
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		m, err := lockMember(tx, wsID, targetID)
+		if err != nil {
+			return err
+		}
+		cur, _ := authz.ParseRole(m.Role)
+		self := actorID == targetID
+		// 自分で抜けるのは owner 以外なら可。owner は先に transfer-ownership が必要
+		if cur == authz.RoleOwner || (!self && !canManage(actor, cur)) {
+			return errNotPermitted
+		}
+
+		// WS 内の全チャンネルから外す
+		if err := tx.Exec(`
+			DELETE FROM channel_members cm
+			USING channels ch
+			WHERE ch.id = cm.channel_id AND ch.workspace_id = ? AND cm.user_id = ?`,
+			wsID, targetID).Error; err != nil {
+			return err
+		}
+		return tx.Where("workspace_id = ? AND user_id = ?", wsID, targetID).
+			Delete(&model.WorkspaceMember{}).Error
+	})
+	switch {
+	case errors.Is(err, errMemberNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"detail": err.Error()})
+	case errors.Is(err, errNotPermitted):
+		c.JSON(http.StatusForbidden, gin.H{"detail": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "remove failed"})
+	default:
+		c.Status(http.StatusNoContent)
+	}
+}
+
+// TransferOwnership godoc
+// @Summary  Transfer workspace ownership (owner). The previous owner becomes admin
+// @Tags     workspaces
+// @Accept   json
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Param    body  body TransferOwnershipIn true "new owner"
+// @Success  200 {object} map[string]bool "ok: true"
+// @Failure  403 {object} map[string]string
+// @Failure  404 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/transfer-ownership [post]
+func (h *WorkspacesHandler) TransferOwnership(c *gin.Context) {
+	actorID, err1 := uuid.Parse(c.GetString("user_id"))
+	wsID, err2 := uuid.Parse(c.Param("ws_id"))
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"detail": "bad params"})
+		return
+	}
+	var in TransferOwnershipIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+	targetID := uuid.MustParse(in.UserID)
+	if targetID == actorID {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "already the owner"})
+		return
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		// 両方の行をロックしてから入れ替える（同時 transfer で owner が0人/2人にならないように）
+		me, err := lockMember(tx, wsID, actorID)
+		if err != nil {
+			return err
+		}
+		if me.Role != string(authz.RoleOwner) {
+			return errNotPermitted
+		}
+		target, err := lockMember(tx, wsID, targetID)
+		if err != nil {
+			return err
+		}
+		if r, _ := authz.ParseRole(target.Role); r.IsGuest() {
+			return errGuestOwner
+		}
+		if bot, err := isBotUser(tx, targetID); err != nil {
+			return err
+		} else if bot {
+			return errBotPrivileged
+		}
+		if err := tx.Model(&model.WorkspaceMember{}).
+			Where("workspace_id = ? AND user_id = ?", wsID, targetID).
+			Update("role", string(authz.RoleOwner)).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.WorkspaceMember{}).
+			Where("workspace_id = ? AND user_id = ?", wsID, actorID).
+			Update("role", string(authz.RoleAdmin)).Error
+	})
+	switch {
+	case errors.Is(err, errMemberNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"detail": err.Error()})
+	case errors.Is(err, errNotPermitted):
+		c.JSON(http.StatusForbidden, gin.H{"detail": err.Error()})
+	case errors.Is(err, errGuestOwner), errors.Is(err, errBotPrivileged):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "transfer failed"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	}
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"slackgo/internal/authz"
+	"slackgo/internal/model"
+)
+
+// --- メールドメインによる自動参加 ---
+
+type AllowedDomainsIn struct {
+	// 許可するメールドメイン（例: ourcompany.co.jp）。空配列で全解除
+	Domains []string `json:"domains" binding:"required,max=50" example:"ourcompany.co.jp"`
+}
+
+type JoinableWorkspaceRow struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	MemberCount int64     `json:"member_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// normalizeDomain は "@OurCompany.co.jp " → "ourcompany.co.jp" に正規化する。不正なら ""
+func normalizeDomain(s string) string {
+	d := strings.ToLower(strings.TrimSpace(s))
+	d = strings.TrimPrefix(d, "@")
+	if d == "" || strings.ContainsAny(d, "@ /") || !strings.Contains(d, ".") {
+		return ""
+	}
+	return d
+}
+
+// emailDomain はメールアドレスのドメイン部（小文字）を返す
+func emailDomain(email string) string {
+	i := strings.LastIndex(email, "@")
+	if i < 0 || i == len(email)-1 {
+		return ""
+	}
+	return normalizeDomain(email[i+1:])
+}
+
+// ListAllowedDomains godoc
+// @Summary  List email domains allowed to auto-join the workspace
+// @Tags     workspaces
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Success  200 {array}  string
+// @Failure  403 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/allowed-domains [get]
+func (h *WorkspacesHandler) ListAllowedDomains(c *gin.Context) {
+	wsID := c.Param("ws_id")
+	domains := []string{}
+	if err := h.db.Model(&model.WorkspaceAllowedDomain{}).
+		Where("workspace_id = ?", wsID).
+		Order("domain ASC").
+		Pluck("domain", &domains).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
+		return
+	}
+	c.JSON(http.StatusOK, domains)
+}
+
+// PutAllowedDomains godoc
+// @Summary  Replace email domains allowed to auto-join the workspace (owner only)
+// @Tags     workspaces
+// @Accept   json
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Param    body  body AllowedDomainsIn true "domains"
+// @Success  200 {array}  string
+// @Failure  403 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/allowed-domains [put]
+func (h *WorkspacesHandler) PutAllowedDomains(c *gin.Context) {
+	wsUUID, err := uuid.Parse(c.Param("ws_id"))
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "invalid ws_id"})
+		return
+	}
+	var in AllowedDomainsIn
+	if err := c.ShouldBindJSON(&in); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
+		return
+	}
+
+	seen := map[string]struct{}{}
+	domains := make([]string, 0, len(in.Domains))
+	for _, raw := range in.Domains {
+		d := normalizeDomain(raw)
+		if d == "" {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "invalid domain: " + raw})
+			return
+		}
+		if _, ok := seen[d]; ok {
+			continue
+		}
+		seen[d] = struct{}{}
+		domains = append(domains, d)
+	}
+
+	// 全置換（DELETE → INSERT）
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace_id = ?", wsUUID).
+			Delete(&model.WorkspaceAllowedDomain{}).Error; err != nil {
+			return err
+		}
+		for _, d := range domains {
+			rec := model.WorkspaceAllowedDomain{WorkspaceID: wsUUID, Domain: d}
+			if err := tx.Create(&rec).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "update failed"})
+		return
+	}
+	c.JSON(http.StatusOK, domains)
+}
+
+// ListJoinable godoc
+// @Summary  List workspaces I can join with my verified email domain
+// @Tags     workspaces
+// @Produce  json
+// @Success  200 {array}  handlers.JoinableWorkspaceRow
+// @Failure  401 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/joinable [get]
+func (h *WorkspacesHandler) ListJoinable(c *gin.Context) {
+	uid := c.GetString("user_id")
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"detail": "unauthorized"})
+		return
+	}
+	rows := []JoinableWorkspaceRow{}
+
+	// 未検証メールでは何も返さない（email_verified=false の IdP アカウントで他社WSに入れないように）
+	domain := emailDomain(c.GetString("verified_email"))
+	if domain == "" {
+		c.JSON(http.StatusOK, rows)
+		return
+	}
+
+	if err := h.db.Raw(`
+		SELECT w.id, w.name, w.created_at,
+		       (SELECT count(*) FROM workspace_members m WHERE m.workspace_id = w.id) AS member_count
+		FROM workspaces w
+		JOIN workspace_allowed_domains d ON d.workspace_id = w.id AND d.domain = ?
+		WHERE w.deleted_at IS NULL
+		AND NOT EXISTS (
+		  SELECT 1 FROM workspace_members wm
+		  WHERE wm.workspace_id = w.id AND wm.user_id = ?
+		)
+		ORDER BY w.name ASC`, domain, uid).
+		Scan(&rows).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
+		return
+	}
+	c.JSON(http.StatusOK, rows)
+}
+
+// Join godoc
+// @Summary  Join a workspace whose allowed domains include my verified email domain
+// @Tags     workspaces
+// @Produce  json
+// @Param    ws_id path string true "Workspace ID (UUID)"
+// @Success  200 {object} map[string]bool "ok: true"
+// @Failure  401 {object} map[string]string
+// @Failure  403 {object} map[string]string
+// @Failure  422 {object} map[string]string
+// @Security Bearer
+// @Router   /workspaces/{ws_id}/join [post]
+func (h *WorkspacesHandler) Join(c *gin.Context) {
+	uid := c.GetString("user_id")
+	if uid == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"detail": "unauthorized"})
+		return
+	}
+	wsUUID, err := uuid.Parse(c.Param("ws_id"))
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": "invalid ws_id"})
+		return
+	}
+
+	domain := emailDomain(c.GetString("verified_email"))
+	if domain == "" {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "verified email required", "code": "email_not_verified"})
+		return
+	}
+
+	var n int64
+	if err := h.db.Model(&model.WorkspaceAllowedDomain{}).
+		Joins("JOIN workspaces w ON w.id = workspace_allowed_domains.workspace_id AND w.deleted_at IS NULL").
+		Where("workspace_allowed_domains.workspace_id = ? AND workspace_allowed_domains.domain = ?", wsUUID, domain).
+		Count(&n).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
+		return
+	}
+	if n == 0 {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "email domain not allowed", "code": "domain_not_allowed"})
+		return
+	}
+
+	// 既にメンバーなら何もしない（role は変えない）
+	rec := model.WorkspaceMember{
+		UserID:      uuid.MustParse(uid),
+		WorkspaceID: wsUUID,
+		Role:        string(authz.RoleMember),
+	}
+	if err := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rec).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"detail": "join failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
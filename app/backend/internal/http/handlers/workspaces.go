@@ -4,21 +4,25 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 
+	"slackgo/internal/authz"
 	"slackgo/internal/model"
 )
 
 type WorkspacesHandler struct {
 	db *gorm.DB
+	// 論理削除から物理削除までの猶予
+	purgeGrace time.Duration
 }
 
-func NewWorkspacesHandler(db *gorm.DB) *WorkspacesHandler {
-	return &WorkspacesHandler{db: db}
+func NewWorkspacesHandler(db *gorm.DB, purgeGrace time.Duration) *WorkspacesHandler {
+	return &WorkspacesHandler{db: db, purgeGrace: purgeGrace}
 }
 
 type CreateWorkspaceIn struct {
@@ -67,7 +71,7 @@ func (h *WorkspacesHandler) Create(c *gin.Context) {
 		wm := model.WorkspaceMember{
 			UserID:      uuid.MustParse(uid),
 			WorkspaceID: ws.ID,
-			Role:        "owner",
+			Role:        string(authz.RoleOwner),
 		}
 		if err := tx.Create(&wm).Error; err != nil {
 			return err
@@ -85,6 +89,7 @@ func (h *WorkspacesHandler) Create(c *gin.Context) {
 // @Summary  List my workspaces
 // @Tags     workspaces
 // @Produce  json
+// @Param    include_deleted query bool false "If true, also returns soft-deleted workspaces I own (restorable)"
 // @Success  200 {array}  model.Workspace
 // @Failure  401 {object} map[string]string
 // @Security Bearer
@@ -97,11 +102,18 @@ func (h *WorkspacesHandler) ListMine(c *gin.Context) {
 		return
 	}
 
-	var ws []model.Workspace
-	if err := h.db.
+	q := h.db.
 		Table("workspaces").
-		Joins("JOIN workspace_members wm ON wm.workspace_id = workspaces.id AND wm.user_id = ?", uid).
-		Find(&ws).Error; err != nil {
+		Joins("JOIN workspace_members wm ON wm.workspace_id = workspaces.id AND wm.user_id = ?", uid)
+	if c.Query("include_deleted") == "true" {
+		// 削除済みは owner にだけ見せる（restore のため）
+		q = q.Where("workspaces.deleted_at IS NULL OR wm.role = ?", string(authz.RoleOwner))
+	} else {
+		q = q.Where("workspaces.deleted_at IS NULL")
+	}
+
+	var ws []model.Workspace
+	if err := q.Find(&ws).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"detail": "list failed"})
 		return
 	}
@@ -111,8 +123,8 @@ func (h *WorkspacesHandler) ListMine(c *gin.Context) {
 type AddWorkspaceMemberIn struct {
 	// 追加するユーザのUUID
 	UserID string `json:"user_id" binding:"required,uuid" example:"6d4c2f52-1f1c-4e7d-92a2-4b2d4a3d9a10"`
-	// 役割（未指定は member）
-	Role string `json:"role" binding:"omitempty,oneof=owner member" example:"member"`
+	// 役割（未指定は member）。owner はここでは付与できない
+	Role string `json:"role" binding:"omitempty,oneof=admin member multi_channel_guest single_channel_guest" example:"member"`
 }
 
 // AddMember godoc
@@ -125,6 +137,7 @@ type AddWorkspaceMemberIn struct {
 // @Success  200 {object} map[string]bool "ok: true"
 // @Failure  400 {object} map[string]string
 // @Failure  401 {object} map[string]string
+// @Failure  403 {object} map[string]string
 // @Failure  404 {object} map[string]string
 // @Failure  422 {object} map[string]string
 // @Security Bearer
@@ -140,9 +153,19 @@ func (h *WorkspacesHandler) AddMember(c *gin.Context) {
 		c.JSON(http.StatusUnprocessableEntity, gin.H{"detail": err.Error()})
 		return
 	}
-	role := in.Role
-	if role == "" {
-		role = "member"
+	role := authz.RoleMember
+	if in.Role != "" {
+		role = authz.Role(in.Role)
+	}
+	// member は一般メンバーでも招待できるが、admin / ゲストの付与は admin 以上のみ
+	inviter, _ := authz.ParseRole(c.GetString("workspace_role"))
+	if inviter.IsGuest() {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "guests cannot invite"})
+		return
+	}
+	if role != authz.RoleMember && !inviter.AtLeast(authz.RoleAdmin) {
+		c.JSON(http.StatusForbidden, gin.H{"detail": "admin only"})
+		return
 	}
 
 	wsUUID, err := uuid.Parse(wsID)
@@ -160,7 +183,7 @@ func (h *WorkspacesHandler) AddMember(c *gin.Context) {
 	rec := model.WorkspaceMember{
 		UserID:      uuidTarget,
 		WorkspaceID: wsUUID,
-		Role:        role,
+		Role:        string(role),
 	}
 	if err := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rec).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"detail": "add member failed"})
@@ -173,21 +196,24 @@ func (h *WorkspacesHandler) AddMember(c *gin.Context) {
 
 type UserRow struct {
 	ID          uuid.UUID `json:"id"`
-	Email       string    `json:"email"`
+	Email       string    `json:"email,omitempty"` // ゲストとしてしか接点の無い相手には返さない
 	DisplayName *string   `json:"display_name,omitempty"`
 }
 
 // SearchUsers godoc
-// @Summary  Search registered users (email/display_name contains q)
+// @Summary  Search users who share a workspace with me (email/display_name contains q).
+// @Description Where I am a guest, only users sharing a channel with me are found, by display_name only and without email.
 // @Tags     users
 // @Produce  json
-// @Param    q     query string true  "query string (part of email or display_name)"
-// @Param    limit query int    false "limit (max 50, default 20)"
+// @Param    q            query string true  "query string (part of email or display_name)"
+// @Param    workspace_id query string false "restrict to members of this workspace"
+// @Param    limit        query int    false "limit (max 50, default 20)"
 // @Success  200 {array}  handlers.UserRow
 // @Failure  400 {object} map[string]string
 // @Security Bearer
 // @Router   /users/search [get]
 func (h *WorkspacesHandler) SearchUsers(c *gin.Context) {
+	uid := c.GetString("user_id")
 	q := strings.TrimSpace(c.Query("q"))
 	if q == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"detail": "q required"})
@@ -200,14 +226,48 @@ func (h *WorkspacesHandler) SearchUsers(c *gin.Context) {
 		}
 	}
 
+	// 自分と同じ（削除されていない）ワークスペースに居るユーザーに限定する。
+	// ゲストで居るワークスペースでは、ディレクトリと同じく同じチャンネルに居る相手だけ（email では探せず、返さない）
+	guestRoles := []string{string(authz.RoleMultiChannelGuest), string(authz.RoleSingleChannelGuest)}
+	member := `EXISTS (
+		SELECT 1 FROM workspace_members a
+		JOIN workspace_members b ON b.workspace_id = a.workspace_id
+		JOIN workspaces w ON w.id = a.workspace_id AND w.deleted_at IS NULL
+		WHERE a.user_id = users.id AND b.user_id = ? AND b.role NOT IN ?`
+	coChannel := `EXISTS (
+		SELECT 1 FROM channel_members a
+		JOIN channel_members b ON b.channel_id = a.channel_id
+		JOIN channels ch ON ch.id = a.channel_id
+		JOIN workspaces w ON w.id = ch.workspace_id AND w.deleted_at IS NULL
+		WHERE a.user_id = users.id AND b.user_id = ?`
+	memberArgs := []any{uid, guestRoles}
+	coChannelArgs := []any{uid}
+	if wsID := c.Query("workspace_id"); wsID != "" {
+		if _, err := uuid.Parse(wsID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"detail": "invalid workspace_id"})
+			return
+		}
+		member += " AND a.workspace_id = ?"
+		coChannel += " AND ch.workspace_id = ?"
+		memberArgs = append(memberArgs, wsID)
+		coChannelArgs = append(coChannelArgs, wsID)
+	}
+	member += ")"
+	coChannel += ")"
+
 	like := "%" + q + "%"
+	where := []any{}
+	where = append(where, memberArgs...)
+	where = append(where, like, like)
+	where = append(where, coChannelArgs...)
+	where = append(where, like)
 	rows := []UserRow{}
-	if err := h.db.
+	tx := h.db.
 		Table("users").
-		Select("id, email, display_name").
-		Where("email ILIKE ? OR display_name ILIKE ?", like, like).
-		Limit(limit).
-		Find(&rows).Error; err != nil {
+		Select("id, CASE WHEN "+member+" THEN email ELSE '' END AS email, display_name", memberArgs...).
+		Where("("+member+" AND (email ILIKE ? OR display_name ILIKE ?)) OR ("+coChannel+" AND display_name ILIKE ?)", where...)
+
+	if err := tx.Limit(limit).Find(&rows).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"detail": "search failed"})
 		return
 	}
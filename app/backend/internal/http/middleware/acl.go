@@ -6,172 +6,143 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+
+	"slackgo/internal/authz"
 )
 
-func RequireWorkspaceMember(db *gorm.DB) gin.HandlerFunc {
+// 判定ロジックは authz パッケージに集約。ここでは gin 用の入出力だけを扱う。
+// 成功時は c.Set("workspace_role", "<role>") を設定する（チャンネル系は所属WSの役割）。
+
+func workspaceParam(c *gin.Context) string {
+	wsID := c.Param("ws_id")
+	if wsID == "" {
+		wsID = c.Query("workspace_id")
+	}
+	return wsID
+}
+
+func channelParam(c *gin.Context) string {
+	chID := c.Param("channel_id")
+	if chID == "" {
+		chID = c.Query("channel_id")
+	}
+	return chID
+}
+
+// RequireWorkspaceRole は min 以上の役割を要求する（ゲストも含めるなら authz.RoleSingleChannelGuest）
+func RequireWorkspaceRole(db *gorm.DB, min authz.Role) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		uid := c.GetString("user_id")
-		wsID := c.Param("ws_id")
-		if wsID == "" {
-			wsID = c.Query("workspace_id")
-		}
-		if uid == "" || wsID == "" {
+		uid, err1 := uuid.Parse(c.GetString("user_id"))
+		wsID, err2 := uuid.Parse(workspaceParam(c))
+		if err1 != nil || err2 != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"detail": "workspace_id required"})
 			return
 		}
-		var n int64
-		if err := db.Table("workspace_members").
-			Where("user_id = ? AND workspace_id = ?", uid, wsID).
-			Count(&n).Error; err != nil || n == 0 {
+		role, err := authz.WorkspaceRole(db, uid, wsID)
+		if err != nil || !role.IsMember() {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"detail": "forbidden"})
 			return
 		}
+		if !role.AtLeast(min) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"detail": string(min) + " only"})
+			return
+		}
+		c.Set("workspace_role", string(role))
 		c.Next()
 	}
 }
 
+// RequireWorkspaceMember はゲストを含む全メンバーを通す
+func RequireWorkspaceMember(db *gorm.DB) gin.HandlerFunc {
+	return RequireWorkspaceRole(db, authz.RoleSingleChannelGuest)
+}
+
+// RequireWorkspaceAdmin は admin / owner のみ通す
+func RequireWorkspaceAdmin(db *gorm.DB) gin.HandlerFunc {
+	return RequireWorkspaceRole(db, authz.RoleAdmin)
+}
+
 func RequireWorkspaceOwner(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		uid := c.GetString("user_id")
-		wsID := c.Param("ws_id")
-		if wsID == "" {
-			wsID = c.Query("workspace_id")
-		}
-		if uid == "" || wsID == "" {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"detail": "workspace_id required"})
-			return
-		}
-		var n int64
-		if err := db.Table("workspace_members").
-			Where("user_id = ? AND workspace_id = ? AND role = 'owner'", uid, wsID).
-			Count(&n).Error; err != nil || n == 0 {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"detail": "owner only"})
-			return
-		}
-		c.Next()
-	}
+	return RequireWorkspaceRole(db, authz.RoleOwner)
 }
 
-func RequireChannelMember(db *gorm.DB) gin.HandlerFunc {
+// requireChannel は channel_id を解決して authz.Channel の結果を check に渡す
+func requireChannel(db *gorm.DB, check func(c *gin.Context, a authz.ChannelAccess) bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		uid := c.GetString("user_id")
-		chID := c.Param("channel_id")
-		if chID == "" {
-			chID = c.Query("channel_id")
+		uid, err1 := uuid.Parse(c.GetString("user_id"))
+		if err1 != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"detail": "unauthorized"})
+			return
 		}
-		if uid == "" || chID == "" {
+		chID, err2 := uuid.Parse(channelParam(c))
+		if err2 != nil {
 			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"detail": "channel_id required"})
 			return
 		}
-		var n int64
-		if err := db.Table("channel_members").
-			Where("user_id = ? AND channel_id = ?", uid, chID).
-			Count(&n).Error; err != nil || n == 0 {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"detail": "forbidden"})
+		a, err := authz.Channel(db, uid, chID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"detail": "lookup failed"})
 			return
 		}
-		c.Next()
-	}
-}
-
-func RequireChannelOwner(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		uid := c.GetString("user_id")
-		chID := c.Param("channel_id")
-		if chID == "" {
-			chID = c.Query("channel_id")
+		if !a.Exists {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"detail": "channel not found"})
+			return
 		}
-		if uid == "" || chID == "" {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"detail": "channel_id required"})
+		// WS付きルートでWS不一致は403
+		if wsID := c.Param("ws_id"); wsID != "" && wsID != a.WorkspaceID.String() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"detail": "forbidden"})
 			return
 		}
-		var n int64
-		if err := db.Table("channel_members").
-			Where("user_id = ? AND channel_id = ? AND role = 'owner'", uid, chID).
-			Count(&n).Error; err != nil || n == 0 {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"detail": "owner only"})
+		if !check(c, a) {
 			return
 		}
+		c.Set("workspace_role", string(a.WorkspaceRole))
 		c.Next()
 	}
 }
 
-type channelInfo struct {
-	WorkspaceID uuid.UUID
-	IsPrivate   bool
+func RequireChannelMember(db *gorm.DB) gin.HandlerFunc {
+	return requireChannel(db, func(c *gin.Context, a authz.ChannelAccess) bool {
+		if !a.WorkspaceRole.IsMember() || !a.IsChannelMember() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"detail": "forbidden"})
+			return false
+		}
+		return true
+	})
 }
 
-// 読み取り可：private→channel member 必須、public→workspace member でOK
-func RequireChannelReadable(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID := c.GetString("user_id")
-		chID := c.Param("channel_id")
-		if userID == "" || chID == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"detail": "unauthorized"})
-			return
+func RequireChannelOwner(db *gorm.DB) gin.HandlerFunc {
+	return requireChannel(db, func(c *gin.Context, a authz.ChannelAccess) bool {
+		if !a.WorkspaceRole.IsMember() || a.ChannelRole != authz.ChannelRoleOwner {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"detail": "owner only"})
+			return false
 		}
+		return true
+	})
+}
 
-		var ch channelInfo
-		if err := db.Raw(`
-			SELECT workspace_id, is_private
-			FROM channels
-			WHERE id = ?`, chID).Scan(&ch).Error; err != nil {
-			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"detail": "channel not found"})
-			return
+// 読み取り可：private→channel member 必須、public→workspace member でOK（ゲストは channel member 必須）
+func RequireChannelReadable(db *gorm.DB) gin.HandlerFunc {
+	return requireChannel(db, func(c *gin.Context, a authz.ChannelAccess) bool {
+		if a.CanRead {
+			return true
 		}
-
-		// private は channel_members が必要
-		if ch.IsPrivate {
-			var ok int
-			if err := db.Raw(`
-				SELECT 1 FROM channel_members
-				WHERE channel_id = ? AND user_id = ? LIMIT 1`, chID, userID).Scan(&ok).Error; err == nil && ok == 1 {
-				c.Next()
-				return
-			}
+		if !a.WorkspaceRole.IsMember() {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"detail": "not a workspace member"})
+		} else {
 			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"detail": "not a channel member"})
-			return
 		}
-
-		// public は workspace_members でOK
-		var ok int
-		if err := db.Raw(`
-			SELECT 1 FROM workspace_members
-			WHERE workspace_id = ? AND user_id = ? LIMIT 1`, ch.WorkspaceID, userID).Scan(&ok).Error; err == nil && ok == 1 {
-			c.Next()
-			return
-		}
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"detail": "not a workspace member"})
-	}
+		return false
+	})
 }
 
-// 書き込み可：方針に合わせて調整（ここでは public→WS member、private→channel member）
 // 書き込み可 : public, privateともにchannel memberの必要がある
 func RequireChannelWritable(db *gorm.DB) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		userID := c.GetString("user_id")
-		chID := c.Param("channel_id")
-		if userID == "" || chID == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"detail": "unauthorized"})
-			return
-		}
-
-		var ch channelInfo
-		if err := db.Raw(`
-			SELECT workspace_id, is_private
-			FROM channels
-			WHERE id = ?`, chID).Scan(&ch).Error; err != nil {
-			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"detail": "channel not found"})
-			return
-		}
-
-		var ok int
-		if err := db.Raw(`
-				SELECT 1 FROM channel_members
-				WHERE channel_id = ? AND user_id = ? LIMIT 1`, chID, userID).Scan(&ok).Error; err == nil && ok == 1 {
-			c.Next()
-			return
+	return requireChannel(db, func(c *gin.Context, a authz.ChannelAccess) bool {
+		if a.CanWrite {
+			return true
 		}
 		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"detail": "not a channel member"})
-	}
+		return false
+	})
 }
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"slackgo/internal/apitoken"
+	"slackgo/internal/auth"
+	"slackgo/internal/authz"
+	"slackgo/internal/identity"
+)
+
+// 認証方式（c.Get("auth_kind")）
+const (
+	AuthKindJWT      = "jwt"
+	AuthKindPersonal = apitoken.KindPersonal
+	AuthKindBot      = apitoken.KindBot
+)
+
+// Authenticate は Bearer トークンを順に試す認証チェーン。
+//   - xoxp- / xoxb- で始まれば PAT / bot トークン（api_tokens）
+//   - それ以外は JWT（auth.Verifier で検証し、identity.Resolver で (issuer, sub) からユーザーを解決・JIT作成）
+//
+// 成功時は c.Set("user_id", "<uuid-string>") / c.Set("user_email", *string|nil) /
+// c.Set("scopes", []string) / c.Set("auth_kind", string) を設定します。
+// JWT の scopes は authz.ScopeAll（対話ログインは Role の判定だけ受ける）。
+// IdP が email_verified=true を返した場合のみ c.Set("verified_email", "<email>") も設定します。
+func Authenticate(db *gorm.DB, ids *identity.Resolver, v auth.Verifier) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"detail": "Missing bearer"})
+			return
+		}
+		raw := strings.TrimPrefix(header, "Bearer ")
+
+		if apitoken.Looks(raw) {
+			authenticateToken(c, db, raw)
+			return
+		}
+
+		// ← ここで auth.Verifier を利用（aud/iss/alg 検証含む）
+		claims, err := v.Verify(raw)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"detail": "invalid token"})
+			return
+		}
+
+		// --- JIT プロビジョニング（(issuer, sub) で解決） ---
+		u, err := ids.Resolve(claims)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"detail": "user lookup failed"})
+			return
+		}
+
+		c.Set("user_id", u.ID.String())
+		c.Set("user_email", u.Email)
+		c.Set("auth_kind", AuthKindJWT)
+		c.Set("scopes", []string{authz.ScopeAll})
+		if claims.EmailVerified && claims.Email != "" {
+			c.Set("verified_email", claims.Email)
+		}
+		c.Next()
+	}
+}
+
+func authenticateToken(c *gin.Context, db *gorm.DB, raw string) {
+	t, err := apitoken.Lookup(db, raw)
+	if errors.Is(err, apitoken.ErrInvalid) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"detail": "invalid token"})
+		return
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"detail": "token lookup failed"})
+		return
+	}
+	var email *string
+	if err := db.Table("users").Select("email").Where("id = ?", t.UserID).Row().Scan(&email); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"detail": "user lookup failed"})
+		return
+	}
+
+	c.Set("user_id", t.UserID.String())
+	c.Set("user_email", email)
+	c.Set("auth_kind", t.Kind)
+	c.Set("token_id", t.ID.String())
+	c.Set("scopes", apitoken.ScopeList(t))
+	c.Next()
+}
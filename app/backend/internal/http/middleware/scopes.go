@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"slackgo/internal/authz"
+)
+
+// Scopes は認証チェーンが設定した付与スコープ
+func Scopes(c *gin.Context) []string {
+	v, _ := c.Get("scopes")
+	s, _ := v.([]string)
+	return s
+}
+
+// HasScope はハンドラ内で追加のスコープ判定をするとき用
+func HasScope(c *gin.Context, scope string) bool {
+	return authz.HasScope(Scopes(c), scope)
+}
+
+// RequireScope は API トークンに scope が付与されているか確認する（JWT は常に通る）
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasScope(c, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"detail": "missing scope: " + scope,
+				"code":   "missing_scope",
+				"needed": scope,
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireInteractive は対話ログイン（JWT）だけを通す。
+// トークン管理・アカウント連携・ワークスペース削除など、トークンに任せたくない操作用
+func RequireInteractive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("auth_kind") != AuthKindJWT {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"detail": "interactive login required",
+				"code":   "interactive_login_required",
+			})
+			return
+		}
+		c.Next()
+	}
+}
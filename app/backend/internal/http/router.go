@@ -1,6 +1,7 @@
 package httpapi
 
 import (
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -10,9 +11,11 @@ import (
 	"gorm.io/gorm"
 
 	"slackgo/internal/auth"
+	"slackgo/internal/authz"
 	"slackgo/internal/http/handlers"
 	"slackgo/internal/http/middleware"
 	"slackgo/internal/http/wsroute"
+	"slackgo/internal/identity"
 	"slackgo/internal/storage"
 	"slackgo/internal/ws"
 
@@ -41,11 +44,17 @@ func NewRouter(
 	msg *handlers.MessagesHandler,
 	ch *handlers.ChannelsHandler,
 	wsH *handlers.WorkspacesHandler,
-	jwtMw gin.HandlerFunc,
+	whH *handlers.WebhooksHandler,
+	cmdH *handlers.CommandsHandler,
+	filesH *handlers.FilesHandler,
+	avatars *handlers.AvatarURLs,
+	authMw gin.HandlerFunc,
 	hub *ws.Hub,
 	db *gorm.DB,
-	s3deps *storage.S3Deps,
-	verifier *auth.Verifier,
+	store storage.Store,
+	verifier auth.Verifier,
+	ids *identity.Resolver,
+	outbound *http.Client, // 外部 URL への送信（events.NewHTTPClient）
 ) *gin.Engine {
 	r := gin.Default()
 
@@ -55,56 +64,161 @@ func NewRouter(
 		AllowOrigins:     allowOrigins,
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"Authorization", "Content-Type", "Accept", "X-Requested-With"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "ETag"}, // ETag はローカルストレージのパート PUT で使う
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
 	r.GET("/health", handlers.Health)
 
-	r.GET("/auth/me", jwtMw, authH.Me)
+	r.GET("/auth/me", authMw, authH.Me)
 
-	api := r.Group("/")
-	api.Use(jwtMw)
-	api.POST("/auth/bootstrap", authH.Bootstrap)
+	// ローカルストレージの署名 URL（URL の署名で認可する。STORAGE_DRIVER=local のときだけ）
+	if ls, ok := store.(*storage.LocalStore); ok {
+		lsH := handlers.NewLocalStorageHandler(ls)
+		r.PUT(storage.LocalRoute+"/*key", lsH.Put)
+		r.GET(storage.LocalRoute+"/*key", lsH.Get)
+	}
 
-	usersH := handlers.NewUsersHandler(db, s3deps)
-	api.GET("/users/me", usersH.GetMe)
-	api.PUT("/users/me", usersH.UpdateMe)
+	// アバター画像（URL の署名で認可する。<img> から直接読めて CDN でキャッシュできる）
+	avatarsH := handlers.NewAvatarsHandler(db, store, avatars)
+	r.GET("/avatars/:file_id", avatarsH.Get)
 
-	filesH := handlers.NewFilesHandler(db, s3deps)
-	api.POST("/workspaces/:ws_id/channels/:channel_id/files/sign-upload",
-		middleware.RequireWorkspaceMember(db), filesH.SignUploadMessage)
-	api.POST("/users/me/avatar/sign-upload", filesH.SignUploadAvatar)
-	api.POST("/files/complete", filesH.Complete)
-	api.GET("/files/:file_id/url", filesH.GetDownloadURL)
+	// incoming webhook（URL 自体が秘密。Authorization ヘッダは不要）
+	r.POST("/hooks/:token", whH.Receive)
 
-	api.POST("/workspaces", wsH.Create)
-	api.GET("/workspaces", wsH.ListMine)
+	// トークン（PAT / bot）は RequireScope で許可したルートだけ呼べる。
+	// RequireInteractive のルートは対話ログイン（JWT）専用
+	scope := middleware.RequireScope
+	interactive := middleware.RequireInteractive()
 
-	api.POST("/workspaces/:ws_id/members", middleware.RequireWorkspaceMember(db), wsH.AddMember)
+	api := r.Group("/")
+	api.Use(authMw)
+	api.POST("/auth/bootstrap", interactive, authH.Bootstrap)
+	api.GET("/auth/identities", interactive, authH.ListIdentities)
+	api.POST("/auth/identities", interactive, authH.LinkIdentity)
+	api.DELETE("/auth/identities/:identity_id", interactive, authH.UnlinkIdentity)
+
+	tokH := handlers.NewTokensHandler(db)
+	api.GET("/auth/tokens", interactive, tokH.ListMine)
+	api.POST("/auth/tokens", interactive, tokH.CreateMine)
+	api.DELETE("/auth/tokens/:token_id", interactive, tokH.RevokeMine)
+
+	usersH := handlers.NewUsersHandler(db, hub, avatars)
+	api.GET("/users/me", scope(authz.ScopeUsersRead), usersH.GetMe)
+	api.PUT("/users/me", scope(authz.ScopeUsersWrite), usersH.UpdateMe)
+	api.GET("/users/:id", scope(authz.ScopeUsersRead), usersH.GetUser)
 
-	api.GET("/users/search", wsH.SearchUsers)
+	api.POST("/workspaces/:ws_id/channels/:channel_id/files/sign-upload",
+		scope(authz.ScopeFilesWrite), middleware.RequireChannelWritable(db), filesH.SignUploadMessage)
+	api.POST("/workspaces/:ws_id/channels/:channel_id/files/preflight",
+		scope(authz.ScopeFilesWrite), middleware.RequireChannelWritable(db), filesH.Preflight)
+	api.POST("/users/me/avatar/sign-upload", scope(authz.ScopeUsersWrite), filesH.SignUploadAvatar)
+	api.POST("/files/complete", scope(authz.ScopeFilesWrite), filesH.Complete)
+	api.POST("/workspaces/:ws_id/channels/:channel_id/files/multipart",
+		scope(authz.ScopeFilesWrite), middleware.RequireChannelWritable(db), filesH.InitiateMultipart)
+	api.POST("/files/multipart/:file_id/parts", scope(authz.ScopeFilesWrite), filesH.PresignParts)
+	api.GET("/files/multipart/:file_id/parts", scope(authz.ScopeFilesWrite), filesH.ListParts)
+	api.POST("/files/multipart/:file_id/complete", scope(authz.ScopeFilesWrite), filesH.CompleteMultipart)
+	api.DELETE("/files/multipart/:file_id", scope(authz.ScopeFilesWrite), filesH.AbortMultipart)
+	api.GET("/files/:file_id/url", scope(authz.ScopeFilesRead), filesH.GetDownloadURL)
+	api.DELETE("/files/:file_id", scope(authz.ScopeFilesWrite), filesH.Delete)
+
+	api.POST("/workspaces", interactive, wsH.Create)
+	api.GET("/workspaces", scope(authz.ScopeWorkspacesRead), wsH.ListMine)
+	// 検証済みメールのドメインで参加できるWS（メンバーでなくても呼べる）
+	api.GET("/workspaces/joinable", interactive, wsH.ListJoinable)
+	api.POST("/workspaces/:ws_id/join", interactive, wsH.Join)
+
+	api.POST("/workspaces/:ws_id/members", scope(authz.ScopeAdmin), middleware.RequireWorkspaceMember(db), wsH.AddMember)
+
+	api.GET("/users/search", scope(authz.ScopeUsersRead), wsH.SearchUsers)
 
 	wsGroup := api.Group("/workspaces/:ws_id")
 	wsGroup.Use(middleware.RequireWorkspaceMember(db))
-	wsGroup.POST("/channels", ch.Create)
-	wsGroup.GET("/channels", ch.ListByWorkspace)
-	wsGroup.POST("/channels/:channel_id/join", ch.JoinSelf)
-
-	api.GET("/channels/:channel_id/membership", middleware.RequireChannelReadable(db), ch.IsMember)
+	wsGroup.POST("/channels", scope(authz.ScopeChannelsWrite), ch.Create)
+	wsGroup.GET("/channels", scope(authz.ScopeChannelsRead), ch.ListByWorkspace)
+	wsGroup.POST("/channels/:channel_id/join", scope(authz.ScopeChannelsWrite), ch.JoinSelf)
+	wsGroup.GET("/members", scope(authz.ScopeUsersRead), usersH.ListWorkspaceMembers)
+	wsGroup.GET("/storage", scope(authz.ScopeFilesRead), filesH.WorkspaceStorage)
+	wsGroup.GET("/files", scope(authz.ScopeFilesRead), filesH.ListWorkspaceFiles)
+	wsGroup.GET("/allowed-domains", scope(authz.ScopeAdmin), wsH.ListAllowedDomains)
+	wsGroup.PUT("/allowed-domains", scope(authz.ScopeAdmin), middleware.RequireWorkspaceOwner(db), wsH.PutAllowedDomains)
+
+	// ワークスペース管理
+	wsGroup.PATCH("", scope(authz.ScopeAdmin), middleware.RequireWorkspaceAdmin(db), wsH.Rename)
+	wsGroup.DELETE("", interactive, middleware.RequireWorkspaceOwner(db), wsH.Delete)
+	wsGroup.POST("/transfer-ownership", interactive, middleware.RequireWorkspaceOwner(db), wsH.TransferOwnership)
+	wsGroup.PATCH("/members/:user_id", scope(authz.ScopeAdmin), middleware.RequireWorkspaceAdmin(db), wsH.ChangeMemberRole)
+	wsGroup.DELETE("/members/:user_id", scope(authz.ScopeAdmin), wsH.RemoveMember) // 自分自身の退出は誰でも可
+
+	// ユーザーグループ（閲覧はメンバー、変更は admin 以上）
+	ugH := handlers.NewUserGroupsHandler(db, hub)
+	wsGroup.GET("/usergroups", scope(authz.ScopeUserGroupsRead), ugH.List)
+	wsGroup.GET("/usergroups/:group_id", scope(authz.ScopeUserGroupsRead), ugH.Get)
+	ugAdmin := wsGroup.Group("/usergroups", scope(authz.ScopeUserGroupsWrite), middleware.RequireWorkspaceAdmin(db))
+	ugAdmin.POST("", ugH.Create)
+	ugAdmin.PATCH("/:group_id", ugH.Update)
+	ugAdmin.DELETE("/:group_id", ugH.Delete)
+	ugAdmin.PUT("/:group_id/members", ugH.SetMembers)
+	ugAdmin.PUT("/:group_id/channels", ugH.SetChannels)
+
+	// bot（管理は admin の対話ログインのみ）
+	bots := wsGroup.Group("/bots", interactive, middleware.RequireWorkspaceAdmin(db))
+	bots.GET("", tokH.ListBots)
+	bots.POST("", tokH.CreateBot)
+	bots.PATCH("/:bot_id", tokH.UpdateBot)
+	bots.DELETE("/:bot_id", tokH.DeactivateBot)
+	bots.POST("/:bot_id/rotate-secret", tokH.RotateBotSecret)
+	bots.GET("/:bot_id/tokens", tokH.ListBotTokens)
+	bots.POST("/:bot_id/tokens", tokH.CreateBotToken)
+	bots.DELETE("/:bot_id/tokens/:token_id", tokH.RevokeBotToken)
+
+	// スラッシュコマンド（一覧はメンバー、独自コマンドの登録は admin の対話ログインのみ）
+	wsGroup.GET("/commands", scope(authz.ScopeChatWrite), cmdH.List)
+	wsGroup.POST("/commands", interactive, middleware.RequireWorkspaceAdmin(db), cmdH.Create)
+	wsGroup.DELETE("/commands/:command_id", interactive, middleware.RequireWorkspaceAdmin(db), cmdH.Delete)
+
+	// イベント購読（外部 URL への配信。管理は admin の対話ログインのみ）
+	evH := handlers.NewEventSubscriptionsHandler(db, outbound)
+	evSubs := wsGroup.Group("/event-subscriptions", interactive, middleware.RequireWorkspaceAdmin(db))
+	evSubs.GET("", evH.List)
+	evSubs.POST("", evH.Create)
+	evSubs.PATCH("/:subscription_id", evH.Update)
+	evSubs.DELETE("/:subscription_id", evH.Delete)
+	evSubs.POST("/:subscription_id/rotate-secret", evH.RotateSecret)
+	evSubs.POST("/:subscription_id/enable", evH.Enable)
+	evSubs.GET("/:subscription_id/deliveries", evH.ListDeliveries)
+
+	// 削除済みWSは RequireWorkspaceMember を通らないので group 外
+	api.POST("/workspaces/:ws_id/restore", interactive, wsH.Restore)
+
+	api.GET("/channels/:channel_id/membership", scope(authz.ScopeChannelsRead), middleware.RequireChannelReadable(db), ch.IsMember)
+	api.GET("/channels/:channel_id/files", scope(authz.ScopeFilesRead), middleware.RequireChannelReadable(db), filesH.ListChannelFiles)
 
 	chGroup := api.Group("/channels/:channel_id")
 	chGroup.Use(middleware.RequireChannelMember(db))
-	chGroup.POST("/members", ch.AddMember)
-	chGroup.GET("/members/search", ch.SearchWorkspaceMembers)
+	chGroup.POST("/members", scope(authz.ScopeChannelsWrite), ch.AddMember)
+	chGroup.GET("/members/search", scope(authz.ScopeUsersRead), ch.SearchWorkspaceMembers)
+	chGroup.PUT("/topic", scope(authz.ScopeChannelsWrite), ch.SetTopic)
+	chGroup.POST("/leave", scope(authz.ScopeChannelsWrite), ch.Leave)
+	// ephemeral（bot から 1 人にだけ見せる。保存しない）
+	ephH := handlers.NewEphemeralHandler(db, hub)
+	chGroup.POST("/ephemeral", scope(authz.ScopeChatWrite), ephH.Post)
+	chGroup.GET("/webhooks", interactive, whH.List)
+	chGroup.POST("/webhooks", interactive, whH.Create)
+	chGroup.DELETE("/webhooks/:webhook_id", interactive, whH.Delete)
 
 	// Messages（メンバーのみ）
 	msgs := api.Group("/channels/:channel_id/messages")
 	// publicであればworkspace memberならば、privateであればchannel memberならば観覧できる
-	msgs.GET("", middleware.RequireChannelReadable(db), msg.List)
+	msgs.GET("", scope(authz.ScopeChannelsHistory), middleware.RequireChannelReadable(db), msg.List)
 	// public, privateともにチャンネルへの書き込みはチャンネルメンバーでなくてはならない
-	msgs.POST("", middleware.RequireChannelWritable(db), msg.Create)
+	msgs.POST("", scope(authz.ScopeChatWrite), middleware.RequireChannelWritable(db), msg.Create)
+	msgs.PATCH("/:message_id", scope(authz.ScopeChatWrite), middleware.RequireChannelWritable(db), msg.Update)
+	// ボタン・セレクトの操作は読めるチャンネルなら誰でも（投稿した bot へ転送）
+	intH := handlers.NewInteractionsHandler(db, hub, msg, outbound)
+	msgs.POST("/:message_id/actions", scope(authz.ScopeChatWrite), middleware.RequireChannelReadable(db), intH.Act)
 
 	// ---- WS AllowedOrigin も ENV から ----
 	wsAllowed := readOriginsEnv("WS_ALLOWED_ORIGIN", "http://localhost:5173")
@@ -116,6 +230,7 @@ func NewRouter(
 		DB:            db,
 		Hub:           hub,
 		Verifier:      verifier,
+		Identities:    ids,
 		AllowedOrigin: firstWSOrigin,
 	})
 
@@ -9,13 +9,15 @@ import (
 	"gorm.io/gorm"
 
 	"slackgo/internal/auth"
+	"slackgo/internal/identity"
 	"slackgo/internal/ws"
 )
 
 type Deps struct {
 	DB            *gorm.DB
 	Hub           *ws.Hub
-	Verifier      *auth.Verifier
+	Verifier      auth.Verifier
+	Identities    *identity.Resolver
 	AllowedOrigin string
 }
 
@@ -62,33 +64,46 @@ func Register(r *gin.Engine, d Deps) {
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
-		uid, err := ensureUserFromSub(d.DB, claims.Sub, claims.Email, claims.Name)
+		u, err := d.Identities.Resolve(claims)
 		if err != nil {
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
+		uid := u.ID
 
 		// 接続権限（read可否）確認
-		ok, err := canReadChannel(d.DB, uid, channel)
+		access, err := channelAccess(d.DB, uid, channel)
 		if err != nil {
 			c.AbortWithStatus(http.StatusInternalServerError)
 			return
 		}
-		if !ok {
+		if !access.CanRead {
 			c.AbortWithStatus(http.StatusForbidden)
 			return
 		}
 
-		// Upgrade → Hubへ参加
+		// Upgrade → Hubへ参加（チャンネル + 所属WS全体向け + 個人宛のルーム）
 		conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 		if err != nil {
 			return
 		}
-		d.Hub.Join(channel, conn)
+		rooms := []string{
+			channel,
+			ws.WorkspaceRoom(access.WorkspaceID.String()),
+			ws.UserRoom(uid.String()),
+		}
+		for _, room := range rooms {
+			d.Hub.Join(room, conn)
+		}
 
 		// 上りは受け捨て（いまはサーバからの配信専用）
 		go func() {
-			defer func() { d.Hub.Leave(channel, conn); conn.Close() }()
+			defer func() {
+				for _, room := range rooms {
+					d.Hub.Leave(room, conn)
+				}
+				conn.Close()
+			}()
 			for {
 				if _, _, err := conn.ReadMessage(); err != nil {
 					return
@@ -0,0 +1,230 @@
+// Package identity は検証済みトークン（issuer, sub）からユーザーを解決する。
+// HTTP ミドルウェア・WebSocket・アカウント連携の各所で同じ規則を使うためにまとめている。
+package identity
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"slackgo/internal/auth"
+	"slackgo/internal/model"
+)
+
+var (
+	// ErrLinkedElsewhere は連携しようとした IdP アカウントが別ユーザーで使われている
+	ErrLinkedElsewhere = errors.New("identity is linked to another user")
+	// ErrLastIdentity は最後の 1 件は外せない（ログインできなくなるため）
+	ErrLastIdentity = errors.New("cannot unlink the last identity")
+	ErrNotFound     = errors.New("identity not found")
+)
+
+type Resolver struct {
+	db *gorm.DB
+	// legacyIssuer からの初回ログインに限り、users.external_id = sub の既存ユーザーを引き継ぐ
+	legacyIssuer string
+}
+
+func NewResolver(db *gorm.DB, legacyIssuer string) *Resolver {
+	return &Resolver{db: db, legacyIssuer: strings.TrimSuffix(legacyIssuer, "/")}
+}
+
+// Resolve は (issuer, sub) のユーザーを返す。無ければ作る（JIT プロビジョニング）
+func (r *Resolver) Resolve(c *auth.Claims) (*model.User, error) {
+	var u model.User
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var ident model.UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", c.Issuer, c.Sub).First(&ident).Error
+		switch {
+		case err == nil:
+			// 毎リクエスト書き込まないよう、1 分以上経っていれば更新
+			now := time.Now()
+			if err := tx.Model(&model.UserIdentity{}).
+				Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", ident.ID, now.Add(-time.Minute)).
+				Update("last_used_at", now).Error; err != nil {
+				return err
+			}
+			return tx.First(&u, "id = ?", ident.UserID).Error
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		found, err := r.claimLegacy(tx, c, &u)
+		if err != nil {
+			return err
+		}
+		if !found {
+			if err := createUser(tx, c, &u); err != nil {
+				return err
+			}
+		}
+		return insertIdentity(tx, u.ID, c)
+	})
+	if err != nil {
+		// 同じ新規ユーザーの同時ログインで unique 違反になったら、作られた方を読み直す
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return r.lookup(c)
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *Resolver) lookup(c *auth.Claims) (*model.User, error) {
+	var u model.User
+	err := r.db.Joins("JOIN user_identities i ON i.user_id = users.id").
+		Where("i.issuer = ? AND i.subject = ?", c.Issuer, c.Sub).
+		First(&u).Error
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// claimLegacy は external_id 時代のユーザーを引き継ぐ。
+// 別 IdP の sub がたまたま一致しても乗っ取れないよう、legacyIssuer と一致する場合だけ
+func (r *Resolver) claimLegacy(tx *gorm.DB, c *auth.Claims, u *model.User) (bool, error) {
+	if r.legacyIssuer == "" || strings.TrimSuffix(c.Issuer, "/") != r.legacyIssuer {
+		return false, nil
+	}
+	err := tx.Where("external_id = ?", c.Sub).
+		Where("NOT EXISTS (SELECT 1 FROM user_identities i WHERE i.user_id = users.id)").
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		First(u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func createUser(tx *gorm.DB, c *auth.Claims, u *model.User) error {
+	*u = model.User{
+		Email:       strPtrOrNil(c.Email),
+		DisplayName: strPtrOrNil(c.Name),
+	}
+	// email は users で一意。別 IdP で同じ email の人が既に居ても自動で統合はしない
+	// （IdP 側の email 確認を信用しきれないため）。email なしで作り、連携は明示的に行ってもらう
+	if u.Email != nil {
+		var n int64
+		if err := tx.Model(&model.User{}).Where("email = ?", *u.Email).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			log.Printf("[identity] email already used by another user, creating %s|%s without email", c.Issuer, c.Sub)
+			u.Email = nil
+		}
+	}
+	return tx.Create(u).Error
+}
+
+func insertIdentity(tx *gorm.DB, userID uuid.UUID, c *auth.Claims) error {
+	now := time.Now()
+	return tx.Create(&model.UserIdentity{
+		UserID:     userID,
+		Issuer:     c.Issuer,
+		Subject:    c.Sub,
+		Email:      strPtrOrNil(c.Email),
+		LastUsedAt: &now,
+	}).Error
+}
+
+// Link は c の IdP アカウントを userID に紐づける。
+// 既に別ユーザーに紐づいていても、そのユーザーが JIT で作られただけの空アカウント
+// （ワークスペース未参加・投稿/アップロードなし・他の IdP なし）なら引き取って削除する
+func (r *Resolver) Link(userID uuid.UUID, c *auth.Claims) (*model.UserIdentity, error) {
+	var out model.UserIdentity
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("issuer = ? AND subject = ?", c.Issuer, c.Sub).
+			First(&out).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if err := insertIdentity(tx, userID, c); err != nil {
+				return err
+			}
+			return tx.Where("issuer = ? AND subject = ?", c.Issuer, c.Sub).First(&out).Error
+		}
+		if err != nil {
+			return err
+		}
+		if out.UserID == userID {
+			return nil // 連携済み
+		}
+
+		other := out.UserID
+		empty, err := isDisposable(tx, other)
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return ErrLinkedElsewhere
+		}
+		if err := tx.Model(&out).Update("user_id", userID).Error; err != nil {
+			return err
+		}
+		out.UserID = userID
+		return tx.Delete(&model.User{}, "id = ?", other).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// isDisposable は uid が他に何も持たない空アカウントか（この identity 以外に紐づきなし）
+func isDisposable(tx *gorm.DB, uid uuid.UUID) (bool, error) {
+	var n int64
+	err := tx.Raw(`
+		SELECT (SELECT count(*) FROM workspace_members WHERE user_id = ?)
+		     + (SELECT count(*) FROM messages          WHERE user_id = ?)
+		     + (SELECT count(*) FROM files             WHERE uploader_id = ?)
+		     + (SELECT count(*) FROM user_identities   WHERE user_id = ?) - 1`,
+		uid, uid, uid, uid).Scan(&n).Error
+	return n == 0, err
+}
+
+// Unlink は userID の identity を外す。最後の 1 件は外せない
+func (r *Resolver) Unlink(userID, identityID uuid.UUID) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		var ids []uuid.UUID
+		if err := tx.Model(&model.UserIdentity{}).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		found := false
+		for _, id := range ids {
+			if id == identityID {
+				found = true
+			}
+		}
+		if !found {
+			return ErrNotFound
+		}
+		if len(ids) == 1 {
+			return ErrLastIdentity
+		}
+		return tx.Delete(&model.UserIdentity{}, "id = ?", identityID).Error
+	})
+}
+
+// List は userID に紐づく identity 一覧
+func (r *Resolver) List(userID uuid.UUID) ([]model.UserIdentity, error) {
+	rows := []model.UserIdentity{}
+	err := r.db.Where("user_id = ?", userID).Order("created_at ASC").Find(&rows).Error
+	return rows, err
+}
+
+func strPtrOrNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
@@ -0,0 +1,159 @@
+// Package imaging はアップロード画像のサムネイル作成とメタデータ除去。
+// 外部ライブラリを使わず標準の image パッケージだけで JPEG / PNG / GIF を扱う（それ以外は ErrUnsupported）。
+// 再エンコードしたサムネイルには EXIF などのメタデータは含まれない
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+const (
+	// MaxPixels を超える画像は展開しない（解凍爆弾よけ）。RGBA で 1 画素 4 バイトなので展開後は最大 96MB ほど
+	MaxPixels   = 24_000_000
+	jpegQuality = 82
+)
+
+var (
+	ErrUnsupported = errors.New("unsupported image format")
+	ErrTooLarge    = errors.New("image has too many pixels")
+)
+
+// Sizes は作るサムネイルの大きさ（長辺。アバターは正方形の一辺）
+var Sizes = []int{64, 360, 720}
+
+// Image は向きを補正済みの画像
+type Image struct {
+	img    *image.RGBA
+	Format string // jpeg / png / gif
+}
+
+func (m *Image) Width() int  { return m.img.Rect.Dx() }
+func (m *Image) Height() int { return m.img.Rect.Dy() }
+
+// Decode は src を展開し、JPEG の EXIF Orientation に従って向きを直す
+func Decode(src []byte) (*Image, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(src))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	var img image.Image
+	switch format {
+	case "jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(src))
+	case "png":
+		img, err = png.Decode(bytes.NewReader(src))
+	case "gif":
+		img, err = gif.Decode(bytes.NewReader(src)) // 先頭フレーム
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	rgba := toRGBA(img)
+	if format == "jpeg" {
+		rgba = orient(rgba, jpegOrientation(src))
+	}
+	return &Image{img: rgba, Format: format}, nil
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Rect, img, b.Min, draw.Src)
+	return dst
+}
+
+// Thumbnail は長辺を size に収めた縮小版（拡大はしない）。square なら中央を正方形に切り抜く
+func (m *Image) Thumbnail(size int, square bool) *image.RGBA {
+	src := m.img
+	if square {
+		side := min(src.Rect.Dx(), src.Rect.Dy())
+		x0 := (src.Rect.Dx() - side) / 2
+		y0 := (src.Rect.Dy() - side) / 2
+		src = src.SubImage(image.Rect(x0, y0, x0+side, y0+side)).(*image.RGBA)
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	if w > size || h > size {
+		if w >= h {
+			w, h = size, max(1, h*size/w)
+		} else {
+			w, h = max(1, w*size/h), size
+		}
+	}
+	return resize(src, w, h)
+}
+
+// Encode はサムネイルを書き出す。透過の可能性がある PNG / GIF は PNG、それ以外は JPEG
+func (m *Image) Encode(img *image.RGBA) (data []byte, contentType, ext string, err error) {
+	var buf bytes.Buffer
+	if m.Format == "png" || m.Format == "gif" {
+		err = png.Encode(&buf, img)
+		return buf.Bytes(), "image/png", "png", err
+	}
+	err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	return buf.Bytes(), "image/jpeg", "jpg", err
+}
+
+// resize は面積平均で縮小する（縦横別々に 2 回）。アルファは事前乗算のまま平均するので縁が黒ずまない
+func resize(src *image.RGBA, w, h int) *image.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+	if w == sw && h == sh {
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(dst, dst.Rect, src, src.Rect.Min, draw.Src)
+		return dst
+	}
+	// 横方向: sw×sh → w×sh
+	tmp := make([]uint32, w*sh*4)
+	for x := 0; x < w; x++ {
+		x0, x1 := span(x, w, sw)
+		for y := 0; y < sh; y++ {
+			var r, g, b, a uint32
+			for sx := x0; sx < x1; sx++ {
+				o := src.PixOffset(src.Rect.Min.X+sx, src.Rect.Min.Y+y)
+				r += uint32(src.Pix[o])
+				g += uint32(src.Pix[o+1])
+				b += uint32(src.Pix[o+2])
+				a += uint32(src.Pix[o+3])
+			}
+			n := uint32(x1 - x0)
+			i := (y*w + x) * 4
+			tmp[i], tmp[i+1], tmp[i+2], tmp[i+3] = r/n, g/n, b/n, a/n
+		}
+	}
+	// 縦方向: w×sh → w×h
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		y0, y1 := span(y, h, sh)
+		n := uint32(y1 - y0)
+		for x := 0; x < w; x++ {
+			var r, g, b, a uint32
+			for sy := y0; sy < y1; sy++ {
+				i := (sy*w + x) * 4
+				r += tmp[i]
+				g += tmp[i+1]
+				b += tmp[i+2]
+				a += tmp[i+3]
+			}
+			o := dst.PixOffset(x, y)
+			dst.Pix[o], dst.Pix[o+1], dst.Pix[o+2], dst.Pix[o+3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// span は縮小後の i 番目の画素が覆う元画像の範囲 [from, to)
+func span(i, dstLen, srcLen int) (int, int) {
+	from := i * srcLen / dstLen
+	to := (i + 1) * srcLen / dstLen
+	return from, max(to, from+1)
+}
@@ -0,0 +1,204 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// --- メタデータ（EXIF / GPS / XMP / テキスト）の除去と向きの補正 ---
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// StripMetadata は画像を再エンコードせずにメタデータだけ取り除く。
+// JPEG は APP1（EXIF・XMP）/ APP13（IPTC）/ コメントを消し、向きが必要なら Orientation だけの EXIF を入れ直す。
+// PNG は eXIf とテキスト系のチャンクを消す。それ以外の形式はそのまま返す（changed=false）
+func StripMetadata(src []byte) (out []byte, changed bool) {
+	switch {
+	case len(src) > 2 && src[0] == 0xFF && src[1] == 0xD8:
+		return stripJPEG(src)
+	case bytes.HasPrefix(src, pngSignature):
+		return stripPNG(src)
+	}
+	return src, false
+}
+
+// jpegSegments は SOS（画像データ）の手前までのセグメントを順に渡す。rest は SOS 以降
+func jpegSegments(src []byte, fn func(marker byte, seg []byte)) (rest []byte, ok bool) {
+	i := 2
+	for i+4 <= len(src) {
+		if src[i] != 0xFF {
+			return nil, false
+		}
+		m := src[i+1]
+		if m == 0xFF { // 埋め草
+			i++
+			continue
+		}
+		if m == 0xDA || m == 0xD9 {
+			return src[i:], true
+		}
+		if m == 0x01 || m >= 0xD0 && m <= 0xD7 {
+			fn(m, src[i:i+2])
+			i += 2
+			continue
+		}
+		n := int(binary.BigEndian.Uint16(src[i+2:]))
+		if n < 2 || i+2+n > len(src) {
+			return nil, false
+		}
+		fn(m, src[i:i+2+n])
+		i += 2 + n
+	}
+	return nil, false
+}
+
+func isExif(seg []byte) bool { return len(seg) > 10 && string(seg[4:10]) == "Exif\x00\x00" }
+
+func stripJPEG(src []byte) ([]byte, bool) {
+	orientation := 1
+	var kept [][]byte
+	dropped := false
+	rest, ok := jpegSegments(src, func(m byte, seg []byte) {
+		switch m {
+		case 0xE1, 0xED, 0xFE: // APP1（EXIF・XMP）、APP13（IPTC）、COM
+			if m == 0xE1 && isExif(seg) {
+				orientation = exifOrientation(seg[10:])
+			}
+			dropped = true
+		default:
+			kept = append(kept, seg)
+		}
+	})
+	if !ok || !dropped {
+		return src, false
+	}
+	var buf bytes.Buffer
+	buf.Write(src[:2])
+	// 向きは JFIF（APP0）の直後、無ければ SOI の直後に入れる
+	if len(kept) > 0 && kept[0][1] == 0xE0 {
+		buf.Write(kept[0])
+		kept = kept[1:]
+	}
+	if orientation != 1 {
+		buf.Write(orientationExif(orientation))
+	}
+	for _, seg := range kept {
+		buf.Write(seg)
+	}
+	buf.Write(rest)
+	return buf.Bytes(), true
+}
+
+// orientationExif は Orientation タグ 1 つだけの APP1 セグメント
+func orientationExif(o int) []byte {
+	seg := []byte{0xFF, 0xE1, 0, 34}
+	seg = append(seg, "Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08"...)
+	seg = append(seg, 0, 1) // エントリ数
+	seg = append(seg, 0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, byte(o), 0, 0)
+	return append(seg, 0, 0, 0, 0) // 次の IFD なし
+}
+
+func stripPNG(src []byte) ([]byte, bool) {
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	dropped := false
+	for i := len(pngSignature); i+12 <= len(src); {
+		n := int(binary.BigEndian.Uint32(src[i:]))
+		end := i + 12 + n
+		if n < 0 || end > len(src) {
+			return src, false
+		}
+		switch string(src[i+4 : i+8]) {
+		case "eXIf", "tEXt", "iTXt", "zTXt", "tIME":
+			dropped = true
+		default:
+			buf.Write(src[i:end])
+		}
+		i = end
+	}
+	if !dropped {
+		return src, false
+	}
+	return buf.Bytes(), true
+}
+
+// jpegOrientation は EXIF の Orientation（1-8）。無ければ 1
+func jpegOrientation(src []byte) int {
+	o := 1
+	jpegSegments(src, func(m byte, seg []byte) {
+		if m == 0xE1 && isExif(seg) && o == 1 {
+			o = exifOrientation(seg[10:])
+		}
+	})
+	return o
+}
+
+// exifOrientation は TIFF ヘッダから IFD0 の 0x0112 を読む
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return 1
+	}
+	off := int(bo.Uint32(tiff[4:]))
+	if off < 8 || off+2 > len(tiff) {
+		return 1
+	}
+	n := int(bo.Uint16(tiff[off:]))
+	for i := 0; i < n; i++ {
+		e := off + 2 + i*12
+		if e+12 > len(tiff) {
+			break
+		}
+		if bo.Uint16(tiff[e:]) == 0x0112 {
+			if v := int(bo.Uint16(tiff[e+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+		}
+	}
+	return 1
+}
+
+// orient は EXIF の向き（1-8）どおりに見えるよう回転・反転する
+func orient(src *image.RGBA, o int) *image.RGBA {
+	if o < 2 || o > 8 {
+		return src
+	}
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch o {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,200 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/model"
+	"slackgo/internal/storage"
+)
+
+// FileGC はファイルの掃除の設定
+type FileGC struct {
+	OrphanAfter time.Duration // これより古い未添付ファイル・未使用アバターを論理削除する
+	Retention   time.Duration // 論理削除からオブジェクトを消すまで
+	DryRun      bool          // 対象をログに出すだけで何も消さない
+}
+
+const (
+	orphanBatch = 500
+	purgeBatch  = 100
+)
+
+// orphanCond は誰からも参照されていないファイル。
+// 添付はどのメッセージにも付いていないもの、アバターはどのユーザーも使っていないもの
+const orphanCond = `f.deleted_at IS NULL AND f.created_at < ? AND (
+	f.purpose = 'message_attachment'
+		AND NOT EXISTS (SELECT 1 FROM message_attachments ma WHERE ma.file_id = f.id)
+	OR f.purpose = 'avatar'
+		AND NOT EXISTS (SELECT 1 FROM users u WHERE u.avatar_file_id = f.id))`
+
+// CollectOrphanFiles はアップロードしたまま使われなかったファイルを論理削除する（実物は PurgeDeletedFiles が消す）
+func CollectOrphanFiles(db *gorm.DB, gc FileGC) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		cutoff := time.Now().Add(-gc.OrphanAfter)
+		if gc.DryRun {
+			var rows []model.File
+			if err := db.WithContext(ctx).Raw(`SELECT * FROM files f WHERE `+orphanCond+` ORDER BY f.created_at LIMIT ?`,
+				cutoff, orphanBatch).Scan(&rows).Error; err != nil {
+				return err
+			}
+			for _, f := range rows {
+				log.Printf("[jobs] dry-run: would soft-delete orphan %s file %s (%s)", f.Purpose, f.ID, f.StorageKey)
+			}
+			return nil
+		}
+		total := int64(0)
+		for ctx.Err() == nil {
+			res := db.WithContext(ctx).Exec(`
+				UPDATE files SET deleted_at = now()
+				WHERE id IN (SELECT f.id FROM files f WHERE `+orphanCond+` ORDER BY f.created_at LIMIT ?)`,
+				cutoff, orphanBatch)
+			if res.Error != nil {
+				return res.Error
+			}
+			total += res.RowsAffected
+			if res.RowsAffected < orphanBatch {
+				break
+			}
+		}
+		if total > 0 {
+			log.Printf("[jobs] soft-deleted %d orphan files", total)
+		}
+		return nil
+	}
+}
+
+// PurgeDeletedFiles は保持期間を過ぎた論理削除済みファイルのオブジェクトとサムネイルを消し、行を物理削除する。
+// ワークスペースの使用量はここで減らす（オブジェクトが残っている間は容量を使っているため）。
+// 重複排除されたファイルは blob の最後の参照が消えたときだけオブジェクトを消す
+func PurgeDeletedFiles(db *gorm.DB, store storage.Store, gc FileGC) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		cutoff := time.Now().Add(-gc.Retention)
+		n, freed := 0, int64(0)
+		for ctx.Err() == nil {
+			var rows []model.File
+			if err := db.WithContext(ctx).Unscoped().
+				Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+				Order("deleted_at").
+				Limit(purgeBatch).
+				Find(&rows).Error; err != nil {
+				return err
+			}
+			purged := 0
+			for _, f := range rows {
+				keys := objectKeys(&f)
+				if gc.DryRun {
+					log.Printf("[jobs] dry-run: would purge file %s: %v", f.ID, keys)
+					continue
+				}
+				if f.BlobID != nil {
+					size, err := purgeBlobFile(ctx, db, store, &f, keys)
+					if err != nil {
+						log.Printf("[jobs] purge file %s: %v", f.ID, err)
+						continue // 次回やり直す
+					}
+					purged++
+					freed += size
+					continue
+				}
+				if err := deleteObjects(ctx, store, keys); err != nil {
+					log.Printf("[jobs] purge file %s: %v", f.ID, err)
+					continue // 次回やり直す
+				}
+				if err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+					res := tx.Unscoped().Delete(&model.File{}, "id = ?", f.ID)
+					if res.Error != nil {
+						return res.Error
+					}
+					// 別のワーカーが先に消していたら使用量は減らさない
+					if res.RowsAffected != 1 || f.WorkspaceID == nil || f.SizeBytes == nil {
+						return nil
+					}
+					return tx.Model(&model.Workspace{}).Where("id = ?", *f.WorkspaceID).
+						Update("storage_used_bytes", gorm.Expr("GREATEST(storage_used_bytes - ?, 0)", *f.SizeBytes)).Error
+				}); err != nil {
+					return err
+				}
+				purged++
+				freed += derefInt64(f.SizeBytes)
+			}
+			n += purged
+			// dry-run や失敗が続くときに同じ行を回り続けないよう、全部消せた満杯のバッチのときだけ続ける
+			if gc.DryRun || len(rows) < purgeBatch || purged < len(rows) {
+				break
+			}
+		}
+		if n > 0 {
+			log.Printf("[jobs] purged %d deleted files (%d bytes)", n, freed)
+		}
+		return nil
+	}
+}
+
+// purgeBlobFile は重複排除された（blob を共有する）ファイルを消す。
+// 行を消せたときだけ blob の参照を 1 減らし、最後の参照だったときだけオブジェクトを消して使用量を減らす。戻り値は減らしたバイト数
+func purgeBlobFile(ctx context.Context, db *gorm.DB, store storage.Store, f *model.File, keys []string) (int64, error) {
+	freed := int64(0)
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// 先に行を消す。別のワーカーが同じ行を処理していたら（0 件）参照は減らさない
+		res := tx.Unscoped().Delete(&model.File{}, "id = ?", f.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 1 {
+			return nil
+		}
+		var blob model.FileBlob
+		if err := tx.Raw(`UPDATE file_blobs SET ref_count = ref_count - 1 WHERE id = ? RETURNING *`, *f.BlobID).
+			Scan(&blob).Error; err != nil {
+			return err
+		}
+		if blob.ID == uuid.Nil || blob.RefCount > 0 {
+			return nil // まだ他のファイルが使っている
+		}
+		// オブジェクトを消せなければ巻き戻して次回やり直す
+		if err := deleteObjects(ctx, store, keys); err != nil {
+			return err
+		}
+		if err := tx.Delete(&model.FileBlob{}, "id = ?", blob.ID).Error; err != nil {
+			return err
+		}
+		freed = blob.SizeBytes
+		return tx.Model(&model.Workspace{}).Where("id = ?", blob.WorkspaceID).
+			Update("storage_used_bytes", gorm.Expr("GREATEST(storage_used_bytes - ?, 0)", blob.SizeBytes)).Error
+	})
+	return freed, err
+}
+
+// objectKeys は元のオブジェクトとサムネイルのキー
+func objectKeys(f *model.File) []string {
+	keys := []string{f.StorageKey}
+	var thumbs []model.Thumbnail
+	if len(f.Thumbnails) > 0 && json.Unmarshal(f.Thumbnails, &thumbs) == nil {
+		for _, t := range thumbs {
+			keys = append(keys, t.StorageKey)
+		}
+	}
+	return keys
+}
+
+func deleteObjects(ctx context.Context, store storage.Store, keys []string) error {
+	for _, k := range keys {
+		if err := store.Delete(ctx, k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func derefInt64(p *int64) int64 {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
@@ -0,0 +1,98 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/model"
+	"slackgo/internal/storage"
+)
+
+const hashBatch = 2
+
+// HashFiles は complete で同期に計算しなかった（hash_pending の）ファイルの SHA-256 を計算して記録する。
+// ワークスペースにまだ同じ内容が無ければ、そのオブジェクトを blob にして以降のアップロードの重複排除に使う。
+// 既にあれば記録するだけで差し替えない（スキャンや画像処理が読んでいる最中のことがあるため）
+func HashFiles(db *gorm.DB, store storage.Store) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		// 取り出しと同時に lease を付ける（落ちたプロセスの分は lease 切れで拾い直す）
+		var files []model.File
+		if err := db.WithContext(ctx).Raw(`
+			UPDATE files SET hash_lease_until = now() + interval '30 minutes'
+			WHERE id IN (
+				SELECT id FROM files
+				WHERE deleted_at IS NULL AND hash_pending
+					AND (hash_lease_until IS NULL OR hash_lease_until < now())
+				ORDER BY created_at
+				LIMIT ?
+				FOR UPDATE SKIP LOCKED)
+			RETURNING *`, hashBatch).
+			Scan(&files).Error; err != nil {
+			return err
+		}
+		for i := range files {
+			f := &files[i]
+			sum, err := storage.HashObject(ctx, store, f.StorageKey)
+			if errors.Is(err, storage.ErrNotFound) {
+				// 実物が無い（消された）ものは諦める
+				if err := db.WithContext(ctx).Model(&model.File{}).Where("id = ?", f.ID).
+					Updates(map[string]any{"hash_pending": false, "hash_lease_until": nil}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				log.Printf("[jobs] hash file %s: %v", f.ID, err)
+				if err := db.WithContext(ctx).Model(&model.File{}).Where("id = ?", f.ID).
+					Update("hash_lease_until", gorm.Expr("now() + interval '1 minute'")).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := recordHash(ctx, db, f, sum); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// errFileGone は計算している間にファイルが削除された
+var errFileGone = errors.New("file was deleted")
+
+// recordHash は sum を f に書き、同じ内容の blob が無ければ f のオブジェクトで作る
+func recordHash(ctx context.Context, db *gorm.DB, f *model.File, sum string) error {
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		updates := map[string]any{"sha256_hex": sum, "hash_pending": false, "hash_lease_until": nil}
+		if f.WorkspaceID != nil && f.BlobID == nil {
+			var blob model.FileBlob
+			if err := tx.Raw(`
+				INSERT INTO file_blobs (workspace_id, sha256_hex, storage_key, size_bytes, ref_count)
+				VALUES (?, ?, ?, ?, 1)
+				ON CONFLICT (workspace_id, sha256_hex) DO NOTHING
+				RETURNING *`, *f.WorkspaceID, sum, f.StorageKey, derefInt64(f.SizeBytes)).Scan(&blob).Error; err != nil {
+				return err
+			}
+			if blob.ID != uuid.Nil {
+				updates["blob_id"] = blob.ID
+			}
+		}
+		// 削除済みなら blob を作らない（ロールバックし、purge には blob 無しのファイルとして消させる）
+		res := tx.Model(&model.File{}).Where("id = ?", f.ID).Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errFileGone
+		}
+		return nil
+	})
+	if errors.Is(err, errFileGone) {
+		return nil
+	}
+	return err
+}
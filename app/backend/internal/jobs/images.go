@@ -0,0 +1,155 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"slackgo/internal/imaging"
+	"slackgo/internal/model"
+	"slackgo/internal/storage"
+)
+
+const (
+	imageBatch       = 8
+	imageMaxAttempts = 3
+	// imageMaxBytes より大きい画像は処理しない（サムネイル無しで元画像だけ）
+	imageMaxBytes = 50 << 20
+)
+
+// ProcessImages は complete された画像の後処理を行う。
+// 元画像から EXIF / GPS などのメタデータを取り除いて置き換え、imaging.Sizes のサムネイルを
+// 元画像の横（<storage_key>.thumb<size>.<ext>）に書き、縦横の大きさを記録する。アバターは正方形に切り抜く。
+// ウイルススキャンで clean になり、SHA-256 も計算済み（アップロードされた内容のハッシュを残すため）のものだけを扱う
+func ProcessImages(db *gorm.DB, store storage.Store) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		// 取り出しと同時に lease を付ける（落ちたプロセスの分は lease 切れで拾い直す）
+		var files []model.File
+		if err := db.WithContext(ctx).Raw(`
+			UPDATE files SET image_status = ?, image_attempts = image_attempts + 1,
+				image_lease_until = now() + interval '5 minutes'
+			WHERE id IN (
+				SELECT id FROM files
+				WHERE deleted_at IS NULL AND scan_status = ? AND NOT hash_pending AND (image_status = ?
+					OR image_status = ? AND image_lease_until < now())
+				ORDER BY created_at
+				LIMIT ?
+				FOR UPDATE SKIP LOCKED)
+			RETURNING *`,
+			model.ImageProcessing, model.ScanClean, model.ImagePending, model.ImageProcessing, imageBatch).
+			Scan(&files).Error; err != nil {
+			return err
+		}
+		for i := range files {
+			f := &files[i]
+			if err := processImage(ctx, db, store, f); err != nil {
+				status := model.ImagePending
+				if f.ImageAttempts >= imageMaxAttempts {
+					status = model.ImageFailed
+				}
+				log.Printf("[jobs] image %s (attempt %d): %v", f.ID, f.ImageAttempts, err)
+				if err := db.WithContext(ctx).Model(&model.File{}).Where("id = ?", f.ID).
+					Updates(map[string]any{"image_status": status, "image_lease_until": nil}).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func processImage(ctx context.Context, db *gorm.DB, store storage.Store, f *model.File) error {
+	skip := func() error {
+		return db.WithContext(ctx).Model(&model.File{}).Where("id = ?", f.ID).
+			Updates(map[string]any{"image_status": model.ImageSkipped, "image_lease_until": nil}).Error
+	}
+	src, err := store.Get(ctx, f.StorageKey, imageMaxBytes)
+	if errors.Is(err, storage.ErrObjectTooLarge) {
+		return skip()
+	}
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]any{}
+
+	// 元画像のメタデータ（撮影位置など）を消して置き換える
+	if clean, changed := imaging.StripMetadata(src); changed {
+		etag, err := store.Put(ctx, f.StorageKey, derefContentType(f), clean)
+		if err != nil {
+			return fmt.Errorf("replace original: %w", err)
+		}
+		delta := int64(len(clean)) - int64(len(src))
+		updates["size_bytes"], updates["etag"] = int64(len(clean)), etag
+		if f.WorkspaceID != nil && delta != 0 {
+			if err := db.WithContext(ctx).Model(&model.Workspace{}).Where("id = ?", *f.WorkspaceID).
+				Update("storage_used_bytes", gorm.Expr("GREATEST(storage_used_bytes + ?, 0)", delta)).Error; err != nil {
+				return err
+			}
+		}
+		// 同じ blob を共有するファイルは同じオブジェクトを指しているので、blob と一緒に大きさを合わせる。
+		// sha256_hex はアップロードされた内容のハッシュのまま残す（同じ元画像の preflight がこの blob に当たり続けるように）
+		if f.BlobID != nil {
+			if err := db.WithContext(ctx).Model(&model.FileBlob{}).Where("id = ?", *f.BlobID).
+				Update("size_bytes", len(clean)).Error; err != nil {
+				return err
+			}
+			if err := db.WithContext(ctx).Model(&model.File{}).Where("blob_id = ? AND id <> ?", *f.BlobID, f.ID).
+				Updates(map[string]any{"size_bytes": len(clean), "etag": etag}).Error; err != nil {
+				return err
+			}
+		}
+		src = clean
+	}
+
+	img, err := imaging.Decode(src)
+	if errors.Is(err, imaging.ErrUnsupported) || errors.Is(err, imaging.ErrTooLarge) {
+		if len(updates) > 0 {
+			if err := db.WithContext(ctx).Model(&model.File{}).Where("id = ?", f.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return skip()
+	}
+	if err != nil {
+		return err
+	}
+
+	square := f.Purpose == "avatar"
+	thumbs := make([]model.Thumbnail, 0, len(imaging.Sizes))
+	for _, size := range imaging.Sizes {
+		t := img.Thumbnail(size, square)
+		data, ct, ext, err := img.Encode(t)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%s.thumb%d.%s", f.StorageKey, size, ext)
+		if _, err := store.Put(ctx, key, ct, data); err != nil {
+			return fmt.Errorf("put thumbnail: %w", err)
+		}
+		thumbs = append(thumbs, model.Thumbnail{
+			Size: size, StorageKey: key, Width: t.Rect.Dx(), Height: t.Rect.Dy(), ContentType: ct,
+		})
+	}
+	raw, err := json.Marshal(thumbs)
+	if err != nil {
+		return err
+	}
+	updates["width"], updates["height"] = img.Width(), img.Height()
+	updates["thumbnails"] = raw
+	updates["image_status"] = model.ImageDone
+	updates["image_lease_until"] = nil
+	return db.WithContext(ctx).Model(&model.File{}).Where("id = ?", f.ID).Updates(updates).Error
+}
+
+func derefContentType(f *model.File) string {
+	if f.ContentType == nil || strings.TrimSpace(*f.ContentType) == "" {
+		return "application/octet-stream"
+	}
+	return *f.ContentType
+}
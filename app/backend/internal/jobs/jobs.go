@@ -0,0 +1,25 @@
+// Package jobs はAPIプロセス内で動かす定期ジョブ（purge / GC など）をまとめたもの。
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Every は interval ごとに fn を実行する。ctx がキャンセルされると戻る。
+// 起動直後にも1回実行する。エラーはログに出すだけで次回も実行する。
+func Every(ctx context.Context, name string, interval time.Duration, fn func(ctx context.Context) error) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := fn(ctx); err != nil {
+			log.Printf("[jobs] %s: %v", name, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
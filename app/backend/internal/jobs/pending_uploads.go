@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"slackgo/internal/model"
+	"slackgo/internal/storage"
+)
+
+// ExpirePendingUploads は complete されないまま期限を過ぎたアップロードを片付ける。
+// PUT 済みでも files に登録されていないオブジェクトは誰からも参照されないので消す（マルチパートは abort も）
+func ExpirePendingUploads(db *gorm.DB, store storage.Store) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var rows []model.PendingUpload
+		if err := db.WithContext(ctx).
+			Where("expires_at <= now()").
+			Order("expires_at").
+			Limit(500).
+			Find(&rows).Error; err != nil {
+			return err
+		}
+		n := 0
+		for _, p := range rows {
+			if err := discardPendingUpload(ctx, store, &p); err != nil {
+				log.Printf("[jobs] pending upload %s: delete object: %v", p.ID, err)
+				continue // 次回やり直す
+			}
+			if err := db.WithContext(ctx).Delete(&model.PendingUpload{}, "id = ?", p.ID).Error; err != nil {
+				return err
+			}
+			n++
+		}
+		if n > 0 {
+			log.Printf("[jobs] expired %d pending uploads", n)
+		}
+		return nil
+	}
+}
+
+// discardPendingUpload は complete されなかったアップロードのオブジェクトを消す。
+// マルチパートは abort したうえでキーも消す（ストレージ側の組み立てまで済んで登録できなかったものが残るため）
+func discardPendingUpload(ctx context.Context, store storage.Store, p *model.PendingUpload) error {
+	if p.UploadID != nil {
+		if err := store.AbortMultipart(ctx, p.StorageKey, *p.UploadID); err != nil {
+			return err
+		}
+	}
+	return store.Delete(ctx, p.StorageKey)
+}
+
+// abandonedMultipartAge より古く、pending_uploads に無いマルチパートは捨てる
+const abandonedMultipartAge = 48 * time.Hour
+
+// AbortAbandonedMultipart は DB の記録が無くなったマルチパートアップロード（complete 後の失敗や
+// 手作業での削除などで取り残されたもの）を abort する。パートは abort するまで容量を使い続けるため
+func AbortAbandonedMultipart(db *gorm.DB, store storage.Store) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		uploads, err := store.ListMultipartUploads(ctx, store.KeyPrefix())
+		if err != nil {
+			return err
+		}
+		n := 0
+		for _, u := range uploads {
+			if time.Since(u.Initiated) < abandonedMultipartAge {
+				continue
+			}
+			var known int64
+			if err := db.WithContext(ctx).Model(&model.PendingUpload{}).
+				Where("upload_id = ?", u.UploadID).Count(&known).Error; err != nil {
+				return err
+			}
+			if known > 0 {
+				continue // ExpirePendingUploads に任せる
+			}
+			if err := store.AbortMultipart(ctx, u.Key, u.UploadID); err != nil {
+				log.Printf("[jobs] abort multipart %s: %v", u.Key, err)
+				continue
+			}
+			n++
+		}
+		if n > 0 {
+			log.Printf("[jobs] aborted %d abandoned multipart uploads", n)
+		}
+		return nil
+	}
+}
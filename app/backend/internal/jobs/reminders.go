@@ -0,0 +1,48 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/model"
+	"slackgo/internal/ws"
+)
+
+// DeliverReminders は remind_at を過ぎた /remind を本人のルームへ通知する。
+// 取り出しと同時に lease を付け（二重には送らない）、接続中の本人へ送れたものだけ delivered_at を入れる。
+// 接続が無かったものは lease が切れてから送り直す（オフラインの間に来たリマインダーも再接続後に届く）
+func DeliverReminders(db *gorm.DB, hub *ws.Hub) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var rows []model.Reminder
+		if err := db.WithContext(ctx).Raw(`
+			UPDATE reminders SET lease_until = now() + interval '30 seconds'
+			WHERE id IN (
+				SELECT id FROM reminders
+				WHERE delivered_at IS NULL AND remind_at <= now()
+					AND (lease_until IS NULL OR lease_until < now())
+				ORDER BY remind_at
+				LIMIT 500
+				FOR UPDATE SKIP LOCKED)
+			RETURNING *`).Scan(&rows).Error; err != nil {
+			return err
+		}
+		var sent []uuid.UUID
+		for _, r := range rows {
+			b, err := json.Marshal(map[string]any{"type": "reminder", "reminder": r})
+			if err != nil {
+				return err
+			}
+			if hub.Broadcast(ws.UserRoom(r.UserID.String()), b) > 0 {
+				sent = append(sent, r.ID)
+			}
+		}
+		if len(sent) == 0 {
+			return nil
+		}
+		return db.WithContext(ctx).Model(&model.Reminder{}).Where("id IN ?", sent).
+			Updates(map[string]any{"delivered_at": gorm.Expr("now()"), "lease_until": nil}).Error
+	}
+}
@@ -0,0 +1,122 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"slackgo/internal/model"
+	"slackgo/internal/scan"
+	"slackgo/internal/storage"
+	"slackgo/internal/ws"
+)
+
+const (
+	scanBatch       = 4
+	scanMaxAttempts = 10
+)
+
+// ScanFiles は complete された（pending_scan の）ファイルを scanner に通して clean / infected にし、
+// アップロードした本人のルームへ file_scanned を送る。maxBytes やスキャナーの上限より大きいものは調べずに unscanned にする（0 は無制限）。
+// スキャナーが答えられなかったときは pending_scan のまま少しずつ間を空けてやり直し（結果が出るまで配らない）、
+// scanMaxAttempts 回やっても判定できないものと実物が無いものは scan_failed にして諦める
+func ScanFiles(db *gorm.DB, store storage.Store, scanner scan.Scanner, maxBytes int64, hub *ws.Hub) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		// 取り出しと同時に lease を付ける（落ちたプロセスの分は lease 切れで拾い直す）
+		var files []model.File
+		if err := db.WithContext(ctx).Raw(`
+			UPDATE files SET scan_attempts = scan_attempts + 1, scan_lease_until = now() + interval '10 minutes'
+			WHERE id IN (
+				SELECT id FROM files
+				WHERE deleted_at IS NULL AND scan_status = ?
+					AND (scan_lease_until IS NULL OR scan_lease_until < now())
+				ORDER BY created_at
+				LIMIT ?
+				FOR UPDATE SKIP LOCKED)
+			RETURNING *`, model.ScanPending, scanBatch).
+			Scan(&files).Error; err != nil {
+			return err
+		}
+		for i := range files {
+			f := &files[i]
+			res, err := scanFile(ctx, store, scanner, maxBytes, f)
+			status := model.ScanClean
+			switch {
+			case err == nil && res.Infected:
+				status = model.ScanInfected
+			case errors.Is(err, errScanSkipped), errors.Is(err, scan.ErrTooLarge):
+				log.Printf("[jobs] scan file %s: %d bytes is over the scan limit, marking unscanned", f.ID, derefInt64(f.SizeBytes))
+				status = model.ScanSkipped
+			case errors.Is(err, storage.ErrNotFound):
+				// 実物が無い（消された）ものはやり直しても同じ
+				log.Printf("[jobs] scan file %s: object is missing, marking scan_failed", f.ID)
+				status = model.ScanFailed
+			case err != nil && f.ScanAttempts >= scanMaxAttempts:
+				log.Printf("[jobs] scan file %s (attempt %d): %v; giving up", f.ID, f.ScanAttempts, err)
+				status = model.ScanFailed
+			case err != nil:
+				log.Printf("[jobs] scan file %s (attempt %d): %v", f.ID, f.ScanAttempts, err)
+				// 試行ごとに 1 分ずつ間を空ける（スキャナーが止まっている間に回数を使い切らないように）
+				if err := db.WithContext(ctx).Model(&model.File{}).Where("id = ?", f.ID).
+					Update("scan_lease_until", gorm.Expr("now() + ? * interval '1 minute'", f.ScanAttempts)).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := recordScan(ctx, db, f, status, res.Signature); err != nil {
+				return err
+			}
+			if f.ScanStatus == model.ScanInfected {
+				log.Printf("[jobs] file %s is infected: %s", f.ID, res.Signature)
+			}
+			b, err := json.Marshal(map[string]any{"type": "file_scanned", "file": f})
+			if err != nil {
+				return err
+			}
+			hub.Broadcast(ws.UserRoom(f.UploaderID.String()), b)
+		}
+		return nil
+	}
+}
+
+// errScanSkipped はスキャナーの上限より大きいので調べなかった
+var errScanSkipped = errors.New("file is over the scan limit")
+
+func scanFile(ctx context.Context, store storage.Store, scanner scan.Scanner, maxBytes int64, f *model.File) (scan.Result, error) {
+	// SCAN_DRIVER=none はそもそも調べない設定なので上限も関係ない
+	if _, noop := scanner.(scan.Noop); !noop && maxBytes > 0 && derefInt64(f.SizeBytes) > maxBytes {
+		return scan.Result{}, errScanSkipped
+	}
+	r, err := store.Reader(ctx, f.StorageKey)
+	if err != nil {
+		return scan.Result{}, err
+	}
+	defer r.Close()
+	return scanner.Scan(ctx, r)
+}
+
+// recordScan は結果（status と、infected のときは検出したシグネチャ）を f と行に書く。clean 以外は画像の後処理もしない
+func recordScan(ctx context.Context, db *gorm.DB, f *model.File, status, signature string) error {
+	now := time.Now()
+	f.ScanStatus, f.ScannedAt, f.ScanLeaseUntil = status, &now, nil
+	if status == model.ScanInfected {
+		f.ScanSignature = &signature
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.File{}).Where("id = ?", f.ID).Updates(map[string]any{
+			"scan_status": f.ScanStatus, "scan_signature": f.ScanSignature, "scanned_at": now, "scan_lease_until": nil,
+		}).Error; err != nil {
+			return err
+		}
+		if f.ScanStatus == model.ScanClean || f.ImageStatus == nil || *f.ImageStatus != model.ImagePending {
+			return nil
+		}
+		skipped := model.ImageSkipped
+		f.ImageStatus = &skipped
+		return tx.Model(&model.File{}).Where("id = ?", f.ID).Update("image_status", model.ImageSkipped).Error
+	})
+}
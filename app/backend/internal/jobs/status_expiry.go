@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/events"
+	"slackgo/internal/profile"
+	"slackgo/internal/ws"
+)
+
+// ExpireStatuses は期限切れのカスタムステータスを消し、同じWSのメンバーへ通知する。
+// 読み取り側（profile.StatusOf）でも期限切れは隠すので、ここは後始末と通知のため。
+func ExpireStatuses(db *gorm.DB, hub *ws.Hub) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var evs events.Batch
+		if err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			var ids []uuid.UUID
+			if err := tx.Raw(`
+				UPDATE users
+				SET status_emoji = NULL, status_text = NULL, status_expires_at = NULL
+				WHERE status_expires_at IS NOT NULL AND status_expires_at <= now()
+				RETURNING id`).Scan(&ids).Error; err != nil {
+				return err
+			}
+			for _, id := range ids {
+				if err := profile.Publish(tx, &evs, id); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		evs.Broadcast(hub)
+		return nil
+	}
+}
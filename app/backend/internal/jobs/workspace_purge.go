@@ -0,0 +1,103 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/model"
+	"slackgo/internal/storage"
+)
+
+// PurgeWorkspaces は猶予期間を過ぎた論理削除済みワークスペースを物理削除する。
+// channels / messages / members などは ON DELETE CASCADE で消えるが、ストレージのオブジェクトは消えないので
+// 先にファイル（サムネイル・blob を含む）と未完了のアップロードを片付け、全部消せたワークスペースだけ行を消す。
+// purge_after を過ぎたワークスペースは復元できないので、片付けの途中で戻ることはない
+func PurgeWorkspaces(db *gorm.DB, store storage.Store) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		var ids []uuid.UUID
+		if err := db.WithContext(ctx).Model(&model.Workspace{}).
+			Where("deleted_at IS NOT NULL AND purge_after <= now()").
+			Order("purge_after").
+			Limit(10).
+			Pluck("id", &ids).Error; err != nil {
+			return err
+		}
+		n := 0
+		for _, id := range ids {
+			if ctx.Err() != nil {
+				break
+			}
+			if err := drainWorkspaceStorage(ctx, db, store, id); err != nil {
+				log.Printf("[jobs] purge workspace %s: %v", id, err)
+				continue // 次回やり直す
+			}
+			res := db.WithContext(ctx).Exec(`
+				DELETE FROM workspaces
+				WHERE id = ? AND deleted_at IS NOT NULL AND purge_after <= now()`, id)
+			if res.Error != nil {
+				return res.Error
+			}
+			n += int(res.RowsAffected)
+		}
+		if n > 0 {
+			log.Printf("[jobs] purged %d workspaces", n)
+		}
+		return nil
+	}
+}
+
+// drainWorkspaceStorage はワークスペースのファイル・blob・未完了アップロードのオブジェクトを消し、行も消す。
+// オブジェクトを消せなかった行は残す（行が残っている間はワークスペースも消さない）
+func drainWorkspaceStorage(ctx context.Context, db *gorm.DB, store storage.Store, wsID uuid.UUID) error {
+	for {
+		var files []model.File
+		if err := db.WithContext(ctx).Unscoped().
+			Where("workspace_id = ?", wsID).
+			Limit(purgeBatch).
+			Find(&files).Error; err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			break
+		}
+		for _, f := range files {
+			if err := deleteObjects(ctx, store, objectKeys(&f)); err != nil {
+				return fmt.Errorf("file %s: %w", f.ID, err)
+			}
+			if err := db.WithContext(ctx).Unscoped().Delete(&model.File{}, "id = ?", f.ID).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	var blobs []model.FileBlob
+	if err := db.WithContext(ctx).Where("workspace_id = ?", wsID).Find(&blobs).Error; err != nil {
+		return err
+	}
+	for _, b := range blobs {
+		if err := store.Delete(ctx, b.StorageKey); err != nil {
+			return fmt.Errorf("blob %s: %w", b.ID, err)
+		}
+		if err := db.WithContext(ctx).Delete(&model.FileBlob{}, "id = ?", b.ID).Error; err != nil {
+			return err
+		}
+	}
+
+	var uploads []model.PendingUpload
+	if err := db.WithContext(ctx).Where("workspace_id = ?", wsID).Find(&uploads).Error; err != nil {
+		return err
+	}
+	for _, p := range uploads {
+		if err := discardPendingUpload(ctx, store, &p); err != nil {
+			return fmt.Errorf("pending upload %s: %w", p.ID, err)
+		}
+		if err := db.WithContext(ctx).Delete(&model.PendingUpload{}, "id = ?", p.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,15 +12,150 @@ type User struct {
 	ID           uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
 	Email        *string    `gorm:"uniqueIndex;omitempty"                          json:"email"`
 	DisplayName  *string    `json:"display_name,omitempty"`
-	ExternalID   *string    `json:"external_id,omitempty"`
+	ExternalID   *string    `json:"external_id,omitempty"` // 旧方式（sub のみ）。新規ユーザーは UserIdentity を使う
 	AvatarFileID *uuid.UUID `json:"avatar_file_id,omitempty"`
+	IsBot        bool       `gorm:"not null;default:false"                         json:"is_bot"`
 	CreatedAt    time.Time  `json:"created_at"`
+
+	// プロフィール
+	Title    *string `json:"title,omitempty"`
+	Phone    *string `json:"phone,omitempty"`
+	Timezone *string `json:"timezone,omitempty"` // IANA 名
+	Pronouns *string `json:"pronouns,omitempty"`
+
+	// カスタムステータス（StatusExpiresAt を過ぎたら無効。ジョブが定期的に消す）
+	StatusEmoji     *string    `json:"status_emoji,omitempty"`
+	StatusText      *string    `json:"status_text,omitempty"`
+	StatusExpiresAt *time.Time `json:"status_expires_at,omitempty"`
+}
+
+// UserIdentity は IdP 上のアカウント（issuer, subject）とユーザーの対応。1 ユーザーに複数紐づけられる
+type UserIdentity struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;index"                       json:"user_id"`
+	Issuer     string     `gorm:"not null"                                       json:"issuer"`
+	Subject    string     `gorm:"not null"                                       json:"subject"`
+	Email      *string    `json:"email,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Bot はワークスペースに属する bot ユーザー（UserID は users.is_bot=true の行）
+type Bot struct {
+	UserID        uuid.UUID  `gorm:"type:uuid;primaryKey"  json:"user_id"`
+	WorkspaceID   uuid.UUID  `gorm:"type:uuid;not null"    json:"workspace_id"`
+	Name          string     `gorm:"not null"              json:"name"`
+	CreatedBy     *uuid.UUID `gorm:"type:uuid"             json:"created_by,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeactivatedAt *time.Time `json:"deactivated_at,omitempty"`
+
+	// インタラクティブ要素（ボタン等）の操作を受け取る URL。SigningSecret は応答に含めない
+	InteractionURL *string `json:"interaction_url,omitempty"`
+	SigningSecret  *string `gorm:"size:128" json:"-"`
+}
+
+// APIToken は PAT / bot トークン。平文は発行時に一度だけ返し、TokenHash（SHA-256）だけ保存する
+type APIToken struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index"                       json:"user_id"`
+	Kind        string     `gorm:"not null"                                       json:"kind"` // personal / bot
+	Name        string     `gorm:"not null"                                       json:"name"`
+	TokenHash   string     `gorm:"not null;uniqueIndex"                           json:"-"`
+	TokenPrefix string     `gorm:"not null"                                       json:"token_prefix"` // 一覧での見分け用
+	Scopes      string     `gorm:"not null;default:''"                            json:"scopes"`       // 空白区切り
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	CreatedBy   *uuid.UUID `gorm:"type:uuid"                                      json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// IncomingWebhook はチャンネルへ投稿する秘密 URL。投稿者は BotUserID の bot
+type IncomingWebhook struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	WorkspaceID uuid.UUID  `gorm:"type:uuid;not null"                             json:"workspace_id"`
+	ChannelID   uuid.UUID  `gorm:"type:uuid;not null;index"                       json:"channel_id"`
+	BotUserID   uuid.UUID  `gorm:"type:uuid;not null"                             json:"bot_user_id"`
+	Name        string     `gorm:"not null"                                       json:"name"`
+	TokenHash   string     `gorm:"not null;uniqueIndex"                           json:"-"`
+	TokenPrefix string     `gorm:"not null"                                       json:"token_prefix"`
+	CreatedBy   *uuid.UUID `gorm:"type:uuid"                                      json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+}
+
+// SlashCommand はワークスペース独自のスラッシュコマンド（外部 URL へ転送）
+type SlashCommand struct {
+	ID            uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	WorkspaceID   uuid.UUID  `gorm:"type:uuid;not null"                             json:"workspace_id"`
+	Command       string     `gorm:"not null"                                       json:"command"` // 先頭の / を除いた小文字
+	URL           string     `gorm:"not null"                                       json:"url"`
+	Description   *string    `json:"description,omitempty"`
+	UsageHint     *string    `json:"usage_hint,omitempty"`
+	SigningSecret string     `gorm:"not null"                                       json:"-"`
+	BotUserID     uuid.UUID  `gorm:"type:uuid;not null"                             json:"bot_user_id"`
+	CreatedBy     *uuid.UUID `gorm:"type:uuid"                                      json:"created_by,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// Reminder は /remind で設定した通知
+type Reminder struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	WorkspaceID uuid.UUID  `gorm:"type:uuid;not null"                             json:"workspace_id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index"                       json:"user_id"`
+	ChannelID   *uuid.UUID `gorm:"type:uuid"                                      json:"channel_id,omitempty"`
+	Text        string     `gorm:"not null"                                       json:"text"`
+	RemindAt    time.Time  `gorm:"not null"                                       json:"remind_at"`
+	CreatedBy   *uuid.UUID `gorm:"type:uuid"                                      json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	LeaseUntil  *time.Time `json:"-"` // jobs.DeliverReminders が送り直すまで
+}
+
+// EventSubscription は外部 URL へのイベント配信設定
+type EventSubscription struct {
+	ID                  uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	WorkspaceID         uuid.UUID  `gorm:"type:uuid;not null;index"                       json:"workspace_id"`
+	Name                string     `gorm:"not null"                                       json:"name"`
+	URL                 string     `gorm:"not null"                                       json:"url"`
+	EventTypes          string     `gorm:"not null"                                       json:"event_types"` // 空白区切り
+	SigningSecret       string     `gorm:"not null"                                       json:"-"`
+	VerifiedAt          *time.Time `json:"verified_at,omitempty"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+	DisabledReason      *string    `json:"disabled_reason,omitempty"`
+	ConsecutiveFailures int        `gorm:"not null;default:0"                             json:"consecutive_failures"`
+	CreatedBy           *uuid.UUID `gorm:"type:uuid"                                      json:"created_by,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
+
+// EventDelivery は配信 outbox の 1 行（サブスクリプション × イベント）
+type EventDelivery struct {
+	ID             uuid.UUID       `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	SubscriptionID uuid.UUID       `gorm:"type:uuid;not null"                             json:"subscription_id"`
+	EventID        uuid.UUID       `gorm:"type:uuid;not null"                             json:"event_id"`
+	EventType      string          `gorm:"not null"                                       json:"event_type"`
+	Payload        json.RawMessage `gorm:"type:jsonb;not null"                            json:"payload"`
+	Status         string          `gorm:"not null;default:pending"                       json:"status"` // pending / delivered / failed
+	Attempts       int             `gorm:"not null;default:0"                             json:"attempts"`
+	NextAttemptAt  time.Time       `gorm:"not null"                                       json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code,omitempty"`
+	LastError      *string         `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
 }
 
 type Workspace struct {
 	ID        uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
 	Name      string    `gorm:"not null"                                       json:"name"`
 	CreatedAt time.Time `json:"created_at"`
+
+	// 論理削除。PurgeAfter を過ぎると purge ジョブが物理削除する
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	PurgeAfter *time.Time `json:"purge_after,omitempty"`
+
+	// 添付ファイルの使用量と上限（NULL は設定の既定値）。GET /workspaces/:ws_id/storage で見る
+	StorageUsedBytes  int64  `gorm:"not null;default:0" json:"-"`
+	StorageQuotaBytes *int64 `json:"-"`
 }
 
 type Channel struct {
@@ -28,6 +164,7 @@ type Channel struct {
 	Workspace   Workspace  `gorm:"foreignKey:WorkspaceID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
 	Name        string     `gorm:"not null"                                                                            json:"name"`
 	IsPrivate   bool       `json:"is_private"`
+	Topic       *string    `json:"topic,omitempty"`
 	CreatedBy   *uuid.UUID `gorm:"type:uuid"                                                                           json:"created_by,omitempty"`
 	Creator     *User      `gorm:"foreignKey:CreatedBy;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL"    json:"-"`
 	CreatedAt   time.Time  `json:"created_at"`
@@ -49,6 +186,18 @@ type Message struct {
 	CreatedAt    time.Time  `json:"created_at"`
 	EditedAt     *time.Time `json:"edited_at,omitempty"`
 
+	// incoming webhook からの投稿（UserID は webhook の bot）。Username / IconURL は表示の上書き
+	WebhookID *uuid.UUID `gorm:"type:uuid" json:"webhook_id,omitempty"`
+	Username  *string    `json:"username,omitempty"`
+	IconURL   *string    `json:"icon_url,omitempty"`
+
+	// NULL は通常投稿。/me の投稿は "me_message"
+	Subtype *string `json:"subtype,omitempty"`
+
+	// 書式。Rich は Text を解析した AST（richtext.Document）、Blocks は bot が送った構造（[]richtext.Block）
+	Rich   json.RawMessage `gorm:"type:jsonb" json:"rich,omitempty"`
+	Blocks json.RawMessage `gorm:"type:jsonb" json:"blocks,omitempty"`
+
 	// 追加: 添付ファイル (N:N)
 	Attachments []File `gorm:"many2many:message_attachments;joinForeignKey:MessageID;joinReferences:FileID" json:"attachments,omitempty"`
 }
@@ -56,13 +205,22 @@ type Message struct {
 type WorkspaceMember struct {
 	UserID      uuid.UUID `gorm:"type:uuid;not null;index:idx_ws_member,unique" json:"user_id"`
 	WorkspaceID uuid.UUID `gorm:"type:uuid;not null;index:idx_ws_member,unique" json:"workspace_id"`
-	Role        string    `gorm:"not null;default:member"                       json:"role"`
+	Role        string    `gorm:"not null;default:member"                       json:"role"` // owner/admin/member/*_guest（authz.Role）
 	CreatedAt   time.Time `json:"created_at"`
 
 	User      User      `gorm:"constraint:OnDelete:CASCADE;foreignKey:UserID;references:ID"      json:"-"`
 	Workspace Workspace `gorm:"constraint:OnDelete:CASCADE;foreignKey:WorkspaceID;references:ID" json:"-"`
 }
 
+// WorkspaceAllowedDomain は検証済みメールのドメインで自動参加できるワークスペースの設定
+type WorkspaceAllowedDomain struct {
+	WorkspaceID uuid.UUID `gorm:"type:uuid;primaryKey" json:"workspace_id"`
+	Domain      string    `gorm:"type:text;primaryKey" json:"domain"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	Workspace Workspace `gorm:"constraint:OnDelete:CASCADE;foreignKey:WorkspaceID;references:ID" json:"-"`
+}
+
 type ChannelMember struct {
 	UserID    uuid.UUID `gorm:"type:uuid;not null;index:idx_ch_member,unique" json:"user_id"`
 	ChannelID uuid.UUID `gorm:"type:uuid;not null;index:idx_ch_member,unique" json:"channel_id"`
@@ -73,6 +231,39 @@ type ChannelMember struct {
 	Channel Channel `gorm:"constraint:OnDelete:CASCADE;foreignKey:ChannelID;references:ID" json:"-"`
 }
 
+// UserGroup はワークスペース内の @handle で呼べるグループ
+type UserGroup struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	WorkspaceID uuid.UUID  `gorm:"type:uuid;not null;index"                       json:"workspace_id"`
+	Handle      string     `gorm:"not null"                                       json:"handle"`
+	Name        string     `gorm:"not null"                                       json:"name"`
+	Description *string    `json:"description,omitempty"`
+	CreatedBy   *uuid.UUID `gorm:"type:uuid"                                      json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+
+	Workspace Workspace `gorm:"constraint:OnDelete:CASCADE;foreignKey:WorkspaceID;references:ID" json:"-"`
+}
+
+type UserGroupMember struct {
+	GroupID   uuid.UUID `gorm:"type:uuid;primaryKey" json:"group_id"`
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// UserGroupChannel はグループのデフォルトチャンネル（グループ加入時に自動参加）
+type UserGroupChannel struct {
+	GroupID   uuid.UUID `gorm:"type:uuid;primaryKey" json:"group_id"`
+	ChannelID uuid.UUID `gorm:"type:uuid;primaryKey" json:"channel_id"`
+}
+
+// MessageMention はメンション通知（グループ経由なら ViaGroupID が入る）
+type MessageMention struct {
+	MessageID  uuid.UUID  `gorm:"type:uuid;primaryKey" json:"message_id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;primaryKey" json:"user_id"`
+	ViaGroupID *uuid.UUID `gorm:"type:uuid"            json:"via_group_id,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
 // ===== ここからファイル機能 =====
 
 // File は files テーブル
@@ -92,17 +283,113 @@ type File struct {
 	OwnerUserID *uuid.UUID `gorm:"type:uuid;index:idx_files_owner_user" json:"owner_user_id,omitempty"`
 	OwnerUser   User       `gorm:"foreignKey:OwnerUserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
 
-	UploaderID  uuid.UUID      `gorm:"type:uuid;not null;index:idx_files_uploader" json:"uploader_id"`
-	Uploader    User           `gorm:"foreignKey:UploaderID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
-	Filename    string         `gorm:"type:text;not null" json:"filename"`
-	ContentType *string        `gorm:"type:text" json:"content_type,omitempty"`
-	SizeBytes   *int64         `gorm:"type:bigint" json:"size_bytes,omitempty"`
-	ETag        *string        `gorm:"column:etag" json:"etag,omitempty"`
-	SHA256Hex   *string        `gorm:"type:text" json:"sha256_hex,omitempty"`
-	StorageKey  string         `gorm:"type:text;not null" json:"storage_key"`
-	IsImage     bool           `gorm:"not null;default:false" json:"is_image"`
-	CreatedAt   time.Time      `gorm:"index:idx_files_created" json:"created_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+	UploaderID  uuid.UUID `gorm:"type:uuid;not null;index:idx_files_uploader" json:"uploader_id"`
+	Uploader    User      `gorm:"foreignKey:UploaderID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE" json:"-"`
+	Filename    string    `gorm:"type:text;not null" json:"filename"`
+	ContentType *string   `gorm:"type:text" json:"content_type,omitempty"`
+	SizeBytes   *int64    `gorm:"type:bigint" json:"size_bytes,omitempty"`
+	ETag        *string   `gorm:"column:etag" json:"etag,omitempty"`
+	// SHA256Hex はアップロードされた内容のハッシュ。画像はこの後メタデータを消して置き換えるので、
+	// ダウンロードした中身（size_bytes / etag）とは一致しないことがある（同じ画像の重複排除はこの値で続けて効く）
+	SHA256Hex  *string `gorm:"type:text" json:"sha256_hex,omitempty"`
+	StorageKey string  `gorm:"type:text;not null" json:"storage_key"`
+	IsImage    bool    `gorm:"not null;default:false" json:"is_image"`
+	// BlobID は内容で重複排除したオブジェクト（FileBlob）。nil は 1 ファイル 1 オブジェクト（アバターと古いファイル）
+	BlobID    *uuid.UUID     `gorm:"type:uuid" json:"-"`
+	CreatedAt time.Time      `gorm:"index:idx_files_created" json:"created_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+
+	// 画像の後処理（jobs.ProcessImages）。Thumbnails は []Thumbnail
+	Width           *int            `json:"width,omitempty"`
+	Height          *int            `json:"height,omitempty"`
+	Thumbnails      json.RawMessage `gorm:"type:jsonb" json:"thumbnails,omitempty" swaggertype:"array,object"`
+	ImageStatus     *string         `json:"image_status,omitempty"` // pending / processing / done / skipped / failed
+	ImageAttempts   int             `gorm:"not null;default:0" json:"-"`
+	ImageLeaseUntil *time.Time      `json:"-"`
+
+	// ウイルススキャン（jobs.ScanFiles）。clean になるまでダウンロード URL は出さない
+	ScanStatus     string     `gorm:"type:text;not null;default:pending_scan" json:"scan_status"` // pending_scan / clean / infected / unscanned / scan_failed
+	ScanSignature  *string    `json:"scan_signature,omitempty"`                                   // infected のとき検出したシグネチャ
+	ScannedAt      *time.Time `json:"scanned_at,omitempty"`
+	ScanAttempts   int        `gorm:"not null;default:0" json:"-"`
+	ScanLeaseUntil *time.Time `json:"-"`
+
+	// SHA-256 の計算待ち（jobs.HashFiles）。complete で同期に計算しなかった大きいファイル
+	HashPending    bool       `gorm:"not null;default:false" json:"hash_pending,omitempty"`
+	HashLeaseUntil *time.Time `json:"-"`
+}
+
+const (
+	ImagePending    = "pending"
+	ImageProcessing = "processing"
+	ImageDone       = "done"
+	ImageSkipped    = "skipped" // 対応していない形式・大きすぎる画像
+	ImageFailed     = "failed"
+)
+
+const (
+	ScanPending  = "pending_scan"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+	ScanSkipped  = "unscanned"   // スキャナーの上限より大きくて調べていない
+	ScanFailed   = "scan_failed" // 実物が無い・何度やっても判定できなかった（配らない）
+)
+
+// Thumbnail は元画像の横に置く縮小版（アバターは正方形）
+type Thumbnail struct {
+	Size        int    `json:"size"` // 長辺（正方形なら一辺）の上限
+	StorageKey  string `json:"storage_key"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type"`
+}
+
+// Thumbnail は指定サイズのサムネイル。まだ作られていなければ nil
+func (f *File) Thumbnail(size int) *Thumbnail {
+	if len(f.Thumbnails) == 0 {
+		return nil
+	}
+	var ts []Thumbnail
+	if json.Unmarshal(f.Thumbnails, &ts) != nil {
+		return nil
+	}
+	for i := range ts {
+		if ts[i].Size == size {
+			return &ts[i]
+		}
+	}
+	return nil
+}
+
+// FileBlob はワークスペース内で同じ内容のファイルが共有するオブジェクト。RefCount は参照している files の数。
+// SHA256Hex はアップロードされた内容のハッシュで、画像のメタデータを消した後も変えない（SizeBytes は置き換え後の大きさ）
+type FileBlob struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:gen_random_uuid();primaryKey" json:"id"`
+	WorkspaceID uuid.UUID `gorm:"type:uuid;not null" json:"workspace_id"`
+	SHA256Hex   string    `gorm:"not null" json:"sha256_hex"`
+	StorageKey  string    `gorm:"not null" json:"storage_key"`
+	SizeBytes   int64     `gorm:"not null" json:"size_bytes"`
+	RefCount    int       `gorm:"not null;default:0" json:"ref_count"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// PendingUpload は署名 URL を発行済みで、まだ complete されていないアップロード（ID がそのまま files.id になる）
+type PendingUpload struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey" json:"id"`
+	UploaderID  uuid.UUID  `gorm:"type:uuid;not null" json:"uploader_id"`
+	Purpose     string     `gorm:"not null" json:"purpose"`
+	WorkspaceID *uuid.UUID `gorm:"type:uuid" json:"workspace_id,omitempty"`
+	ChannelID   *uuid.UUID `gorm:"type:uuid" json:"channel_id,omitempty"`
+	StorageKey  string     `gorm:"not null;uniqueIndex" json:"storage_key"`
+	Filename    string     `gorm:"not null" json:"filename"`
+	ContentType *string    `json:"content_type,omitempty"`
+	SizeBytes   *int64     `json:"size_bytes,omitempty"` // 署名時の申告値
+	CreatedAt   time.Time  `json:"created_at"`
+	ExpiresAt   time.Time  `gorm:"index" json:"expires_at"`
+
+	// マルチパートのときだけ（S3 の UploadId とパートサイズ）
+	UploadID *string `json:"upload_id,omitempty"`
+	PartSize *int64  `json:"part_size,omitempty"`
 }
 
 // MessageAttachment は明示的な中間テーブル（任意：many2manyだけでも動く）
@@ -0,0 +1,108 @@
+// Package profile はユーザープロフィールの公開表現と、その変更通知（user_updated）をまとめたもの。
+// handlers（GET /users/:id, PUT /users/me）と jobs（ステータス期限切れ）の両方から使う。
+package profile
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"slackgo/internal/events"
+	"slackgo/internal/model"
+	"slackgo/internal/ws"
+)
+
+type Status struct {
+	Emoji     string     `json:"emoji"`
+	Text      string     `json:"text"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Profile は他のメンバーに見せるプロフィール
+type Profile struct {
+	ID           uuid.UUID  `json:"id"`
+	Email        *string    `json:"email,omitempty"`
+	DisplayName  *string    `json:"display_name,omitempty"`
+	AvatarFileID *uuid.UUID `json:"avatar_file_id,omitempty"`
+	AvatarURL    *string    `json:"avatar_url,omitempty"` // 署名URL（呼び出し側で付与）
+	Title        *string    `json:"title,omitempty"`
+	Phone        *string    `json:"phone,omitempty"`
+	Timezone     *string    `json:"timezone,omitempty"`
+	Pronouns     *string    `json:"pronouns,omitempty"`
+	Status       *Status    `json:"status,omitempty"`
+	IsBot        bool       `json:"is_bot"`
+}
+
+// StatusOf は有効なステータスを返す。未設定・期限切れは nil
+func StatusOf(u *model.User, now time.Time) *Status {
+	if u.StatusExpiresAt != nil && !now.Before(*u.StatusExpiresAt) {
+		return nil
+	}
+	emoji, text := deref(u.StatusEmoji), deref(u.StatusText)
+	if emoji == "" && text == "" {
+		return nil
+	}
+	return &Status{Emoji: emoji, Text: text, ExpiresAt: u.StatusExpiresAt}
+}
+
+func FromUser(u *model.User) Profile {
+	return Profile{
+		ID:           u.ID,
+		Email:        u.Email,
+		DisplayName:  u.DisplayName,
+		AvatarFileID: u.AvatarFileID,
+		Title:        u.Title,
+		Phone:        u.Phone,
+		Timezone:     u.Timezone,
+		Pronouns:     u.Pronouns,
+		Status:       StatusOf(u, time.Now()),
+		IsBot:        u.IsBot,
+	}
+}
+
+// Outbound は外部の購読先（イベント購読・webhook）へ送るプロフィール。連絡先（email / phone）は含めない
+func (p Profile) Outbound() Profile {
+	p.Email, p.Phone = nil, nil
+	return p
+}
+
+func Load(db *gorm.DB, userID uuid.UUID) (*Profile, error) {
+	var u model.User
+	if err := db.First(&u, "id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	p := FromUser(&u)
+	return &p, nil
+}
+
+// Publish は user_updated イベントをユーザーが所属する全ワークスペースのルーム宛てに evs へ積む。
+// 更新と同じ tx で呼び、コミット後に evs.Broadcast する。外部の購読先へは Outbound（連絡先なし）を送る
+func Publish(db *gorm.DB, evs *events.Batch, userID uuid.UUID) error {
+	p, err := Load(db, userID)
+	if err != nil {
+		return err
+	}
+	var wsIDs []uuid.UUID
+	if err := db.Table("workspace_members wm").
+		Joins("JOIN workspaces w ON w.id = wm.workspace_id AND w.deleted_at IS NULL").
+		Where("wm.user_id = ?", userID).
+		Pluck("wm.workspace_id", &wsIDs).Error; err != nil {
+		return err
+	}
+	ev := map[string]any{"type": "user_updated", "user": p}
+	outbound := map[string]any{"type": "user_updated", "user": p.Outbound()}
+	for _, id := range wsIDs {
+		if err := evs.AddWithOutbound(db, ws.WorkspaceRoom(id.String()), ev, outbound); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
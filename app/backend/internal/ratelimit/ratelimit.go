@@ -0,0 +1,72 @@
+// Package ratelimit はキー（webhook ID など）ごとのトークンバケット。
+// プロセス内メモリのみ（API を複数台にしたら台数ぶん緩くなる点に注意）。
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type Limiter struct {
+	mu      sync.Mutex
+	rate    float64 // 1 秒あたりの補充数
+	burst   float64
+	buckets map[string]*bucket
+}
+
+// New は perMinute 回/分、瞬間的には burst 回まで許す Limiter を作る
+func New(perMinute, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(burst),
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow は 1 回分消費できれば true。false のときは次に空くまでの待ち時間を返す
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if l.rate <= 0 {
+		return false, time.Minute
+	}
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// Sweep は満タンまで回復したバケットを捨てる（メモリ掃除。定期ジョブから呼ぶ）
+func (l *Limiter) Sweep() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for k, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package richtext はメッセージ本文の書式。
+// Slack 風 mrkdwn のサブセットを AST（Document）に変換し、bot 向けの Block Kit 風 JSON（Blocks）を検証する。
+// クライアントは text ではなく AST を描画すれば、どこでも同じ見た目になる。
+package richtext
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Version は AST の形式。互換性のない変更をしたら上げる
+const Version = 1
+
+// ブロック要素
+const (
+	NodeParagraph = "paragraph"  // Children: インライン
+	NodeCodeBlock = "code_block" // Text, Lang
+	NodeQuote     = "quote"      // Children: ブロック
+	NodeList      = "list"       // Ordered, Start, Children: list_item
+	NodeListItem  = "list_item"  // Indent, Children: インライン
+)
+
+// インライン要素
+const (
+	NodeText           = "text" // Text
+	NodeBold           = "bold" // Children
+	NodeItalic         = "italic"
+	NodeStrike         = "strike"
+	NodeCode           = "code"            // Text
+	NodeLink           = "link"            // URL, Children（ラベル。無ければ URL を表示）
+	NodeUserMention    = "user_mention"    // UserID
+	NodeChannelMention = "channel_mention" // ChannelID, Text（<#id|name> の name）
+	NodeLineBreak      = "line_break"
+)
+
+// Node は AST の 1 要素。Type ごとに使うフィールドが決まっている（上の定数のコメント参照）
+type Node struct {
+	Type      string     `json:"type"`
+	Text      string     `json:"text,omitempty"`
+	Children  []Node     `json:"children,omitempty"`
+	Lang      string     `json:"lang,omitempty"`
+	URL       string     `json:"url,omitempty"`
+	UserID    *uuid.UUID `json:"user_id,omitempty"`
+	ChannelID *uuid.UUID `json:"channel_id,omitempty"`
+	Ordered   bool       `json:"ordered,omitempty"`
+	Start     int        `json:"start,omitempty"`
+	Indent    int        `json:"indent,omitempty"`
+}
+
+// Document は 1 メッセージ分の AST
+type Document struct {
+	Version int    `json:"version"`
+	Blocks  []Node `json:"blocks"`
+}
+
+const (
+	maxNodes = 20000
+	maxDepth = 12
+	maxURL   = 3000
+	maxLang  = 32
+)
+
+var ErrInvalid = errors.New("invalid message format")
+
+func invalid(format string, a ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, a...))
+}
+
+// Validate は AST が形式どおりか（種類・入れ子・URL・大きさ）を確かめる
+func Validate(d *Document) error {
+	if d.Version != Version {
+		return invalid("unsupported version %d", d.Version)
+	}
+	n := 0
+	for _, b := range d.Blocks {
+		if err := validateBlock(&b, 1, &n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func count(n *int, depth int) error {
+	*n++
+	if *n > maxNodes {
+		return invalid("too many nodes")
+	}
+	if depth > maxDepth {
+		return invalid("nesting too deep")
+	}
+	return nil
+}
+
+func validateBlock(b *Node, depth int, n *int) error {
+	if err := count(n, depth); err != nil {
+		return err
+	}
+	switch b.Type {
+	case NodeParagraph:
+		return validateInlines(b.Children, depth+1, n)
+	case NodeCodeBlock:
+		if len(b.Lang) > maxLang {
+			return invalid("code block language too long")
+		}
+		return nil
+	case NodeQuote:
+		for i := range b.Children {
+			if err := validateBlock(&b.Children[i], depth+1, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	case NodeList:
+		for i := range b.Children {
+			it := &b.Children[i]
+			if it.Type != NodeListItem {
+				return invalid("list may only contain list_item")
+			}
+			if err := count(n, depth+1); err != nil {
+				return err
+			}
+			if it.Indent < 0 || it.Indent > 3 {
+				return invalid("list indent out of range")
+			}
+			if err := validateInlines(it.Children, depth+2, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return invalid("unknown block type %q", b.Type)
+}
+
+func validateInlines(nodes []Node, depth int, n *int) error {
+	for i := range nodes {
+		in := &nodes[i]
+		if err := count(n, depth); err != nil {
+			return err
+		}
+		switch in.Type {
+		case NodeText, NodeCode, NodeLineBreak:
+		case NodeBold, NodeItalic, NodeStrike:
+			if err := validateInlines(in.Children, depth+1, n); err != nil {
+				return err
+			}
+		case NodeLink:
+			if err := ValidateURL(in.URL); err != nil {
+				return err
+			}
+			if err := validateInlines(in.Children, depth+1, n); err != nil {
+				return err
+			}
+		case NodeUserMention:
+			if in.UserID == nil {
+				return invalid("user_mention without user_id")
+			}
+		case NodeChannelMention:
+			if in.ChannelID == nil {
+				return invalid("channel_mention without channel_id")
+			}
+		default:
+			return invalid("unknown inline type %q", in.Type)
+		}
+	}
+	return nil
+}
+
+// ValidateURL はリンクとして許す URL か（http / https / mailto のみ）
+func ValidateURL(raw string) error {
+	if raw == "" || len(raw) > maxURL {
+		return invalid("url is empty or too long")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return invalid("malformed url")
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return invalid("url without host")
+		}
+	case "mailto":
+		if u.Opaque == "" {
+			return invalid("mailto without address")
+		}
+	default:
+		return invalid("url scheme %q is not allowed", u.Scheme)
+	}
+	return nil
+}
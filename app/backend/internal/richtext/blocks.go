@@ -0,0 +1,399 @@
+package richtext
+
+import (
+	"bytes"
+	"encoding/json"
+	"unicode/utf8"
+)
+
+// --- Block Kit 風の構造化メッセージ（bot 向け） ---
+// 未知のフィールド・種類は受け付けない。mrkdwn のテキストにはサーバーで AST（rich）を付ける
+
+const (
+	BlockSection = "section"
+	BlockHeader  = "header"
+	BlockDivider = "divider"
+	BlockContext = "context"
+	BlockActions = "actions"
+
+	TextPlain    = "plain_text"
+	TextMarkdown = "mrkdwn"
+
+	ElementButton = "button"
+	ElementImage  = "image"
+	ElementSelect = "static_select"
+)
+
+const (
+	MaxBlocksBytes = 48 << 10
+	maxBlocks      = 50
+	maxBlockID     = 255
+	maxSectionText = 3000
+	maxFields      = 10
+	maxFieldText   = 2000
+	maxHeaderText  = 150
+	maxContextElem = 10
+	maxActionElem  = 25
+	maxButtonText  = 75
+	maxActionID    = 255
+	maxValue       = 2000
+	maxAltText     = 2000
+	maxOptions     = 100
+	maxOptionText  = 75
+	maxOptionValue = 150
+	maxPlaceholder = 150
+)
+
+// TextObject はブロック内のテキスト
+type TextObject struct {
+	Type string    `json:"type"` // plain_text / mrkdwn
+	Text string    `json:"text"`
+	Rich *Document `json:"rich,omitempty"` // mrkdwn の AST（入力は無視してサーバーで作る）
+}
+
+// Button は section の accessory または actions の要素
+type Button struct {
+	Type     string     `json:"type"` // button
+	Text     TextObject `json:"text"` // plain_text
+	ActionID string     `json:"action_id"`
+	Value    string     `json:"value,omitempty"`
+	URL      string     `json:"url,omitempty"`
+	Style    string     `json:"style,omitempty"` // primary / danger
+}
+
+// Image は context の画像要素
+type Image struct {
+	Type     string `json:"type"` // image
+	ImageURL string `json:"image_url"`
+	AltText  string `json:"alt_text"`
+}
+
+// Option は static_select の選択肢
+type Option struct {
+	Text  TextObject `json:"text"` // plain_text
+	Value string     `json:"value"`
+}
+
+// Select は選択肢から 1 つ選ぶ要素（static_select）
+type Select struct {
+	Type          string      `json:"type"` // static_select
+	ActionID      string      `json:"action_id"`
+	Placeholder   *TextObject `json:"placeholder,omitempty"`
+	Options       []Option    `json:"options"`
+	InitialOption *Option     `json:"initial_option,omitempty"`
+}
+
+// Element は accessory / context / actions の要素（type によって中身が変わる）
+type Element struct {
+	Text   *TextObject
+	Image  *Image
+	Button *Button
+	Select *Select
+}
+
+func (e Element) MarshalJSON() ([]byte, error) {
+	switch {
+	case e.Text != nil:
+		return json.Marshal(e.Text)
+	case e.Image != nil:
+		return json.Marshal(e.Image)
+	case e.Button != nil:
+		return json.Marshal(e.Button)
+	case e.Select != nil:
+		return json.Marshal(e.Select)
+	}
+	return []byte("null"), nil
+}
+
+func (e *Element) UnmarshalJSON(b []byte) error {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(b, &head); err != nil {
+		return err
+	}
+	switch head.Type {
+	case TextPlain, TextMarkdown:
+		e.Text = &TextObject{}
+		return decodeStrict(b, e.Text)
+	case ElementImage:
+		e.Image = &Image{}
+		return decodeStrict(b, e.Image)
+	case ElementButton:
+		e.Button = &Button{}
+		return decodeStrict(b, e.Button)
+	case ElementSelect:
+		e.Select = &Select{}
+		return decodeStrict(b, e.Select)
+	}
+	return invalid("unknown element type %q", head.Type)
+}
+
+// Block は 1 ブロック。type ごとに使うフィールドが決まっている
+type Block struct {
+	Type      string       `json:"type"`
+	BlockID   string       `json:"block_id,omitempty"`
+	Text      *TextObject  `json:"text,omitempty"`      // section / header
+	Fields    []TextObject `json:"fields,omitempty"`    // section
+	Accessory *Element     `json:"accessory,omitempty"` // section（button / static_select）
+	Elements  []Element    `json:"elements,omitempty"`  // context / actions
+}
+
+func decodeStrict(b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return invalid("%s", err.Error())
+	}
+	return nil
+}
+
+// ParseBlocks は JSON 配列を検証して返す（mrkdwn には rich を付け直す）
+func ParseBlocks(raw []byte) ([]Block, error) {
+	if len(raw) > MaxBlocksBytes {
+		return nil, invalid("blocks exceed %d bytes", MaxBlocksBytes)
+	}
+	var blocks []Block
+	if err := decodeStrict(raw, &blocks); err != nil {
+		return nil, err
+	}
+	if len(blocks) == 0 {
+		return nil, invalid("blocks must not be empty")
+	}
+	if len(blocks) > maxBlocks {
+		return nil, invalid("at most %d blocks", maxBlocks)
+	}
+	v := blockValidator{blockIDs: map[string]bool{}, actionIDs: map[string]bool{}}
+	for i := range blocks {
+		if err := v.block(&blocks[i]); err != nil {
+			return nil, err
+		}
+	}
+	return blocks, nil
+}
+
+type blockValidator struct {
+	blockIDs  map[string]bool
+	actionIDs map[string]bool
+}
+
+func (v *blockValidator) block(b *Block) error {
+	if b.BlockID != "" {
+		if len(b.BlockID) > maxBlockID {
+			return invalid("block_id too long")
+		}
+		if v.blockIDs[b.BlockID] {
+			return invalid("duplicate block_id %q", b.BlockID)
+		}
+		v.blockIDs[b.BlockID] = true
+	}
+
+	switch b.Type {
+	case BlockSection:
+		if len(b.Elements) > 0 {
+			return invalid("section does not take elements")
+		}
+		if b.Text == nil && len(b.Fields) == 0 {
+			return invalid("section needs text or fields")
+		}
+		if b.Text != nil {
+			if err := text(b.Text, maxSectionText, false); err != nil {
+				return err
+			}
+		}
+		if len(b.Fields) > maxFields {
+			return invalid("section has more than %d fields", maxFields)
+		}
+		for i := range b.Fields {
+			if err := text(&b.Fields[i], maxFieldText, false); err != nil {
+				return err
+			}
+		}
+		if b.Accessory != nil {
+			return v.interactive(b.Accessory, "accessory")
+		}
+	case BlockHeader:
+		if b.Text == nil || len(b.Fields) > 0 || b.Accessory != nil || len(b.Elements) > 0 {
+			return invalid("header takes only text")
+		}
+		return text(b.Text, maxHeaderText, true)
+	case BlockDivider:
+		if b.Text != nil || len(b.Fields) > 0 || b.Accessory != nil || len(b.Elements) > 0 {
+			return invalid("divider takes no content")
+		}
+	case BlockContext:
+		if b.Text != nil || len(b.Fields) > 0 || b.Accessory != nil {
+			return invalid("context takes only elements")
+		}
+		if len(b.Elements) == 0 || len(b.Elements) > maxContextElem {
+			return invalid("context needs 1-%d elements", maxContextElem)
+		}
+		for _, e := range b.Elements {
+			switch {
+			case e.Text != nil:
+				if err := text(e.Text, maxSectionText, false); err != nil {
+					return err
+				}
+			case e.Image != nil:
+				if err := ValidateURL(e.Image.ImageURL); err != nil {
+					return err
+				}
+				if e.Image.AltText == "" || utf8.RuneCountInString(e.Image.AltText) > maxAltText {
+					return invalid("image needs alt_text up to %d characters", maxAltText)
+				}
+			default:
+				return invalid("context elements must be text or image")
+			}
+		}
+	case BlockActions:
+		if b.Text != nil || len(b.Fields) > 0 || b.Accessory != nil {
+			return invalid("actions takes only elements")
+		}
+		if len(b.Elements) == 0 || len(b.Elements) > maxActionElem {
+			return invalid("actions needs 1-%d elements", maxActionElem)
+		}
+		for i := range b.Elements {
+			if err := v.interactive(&b.Elements[i], "actions elements"); err != nil {
+				return err
+			}
+		}
+	default:
+		return invalid("unknown block type %q", b.Type)
+	}
+	return nil
+}
+
+// interactive は button か static_select だけを許す
+func (v *blockValidator) interactive(e *Element, where string) error {
+	switch {
+	case e.Button != nil:
+		return v.button(e.Button)
+	case e.Select != nil:
+		return v.selectElem(e.Select)
+	}
+	return invalid("%s must be buttons or selects", where)
+}
+
+func (v *blockValidator) actionID(id string) error {
+	if id == "" || len(id) > maxActionID {
+		return invalid("action_id is required (up to %d bytes)", maxActionID)
+	}
+	if v.actionIDs[id] {
+		return invalid("duplicate action_id %q", id)
+	}
+	v.actionIDs[id] = true
+	return nil
+}
+
+func (v *blockValidator) selectElem(s *Select) error {
+	if err := v.actionID(s.ActionID); err != nil {
+		return err
+	}
+	if s.Placeholder != nil {
+		if err := text(s.Placeholder, maxPlaceholder, true); err != nil {
+			return err
+		}
+	}
+	if len(s.Options) == 0 || len(s.Options) > maxOptions {
+		return invalid("select needs 1-%d options", maxOptions)
+	}
+	seen := map[string]bool{}
+	for i := range s.Options {
+		o := &s.Options[i]
+		if err := text(&o.Text, maxOptionText, true); err != nil {
+			return err
+		}
+		if o.Value == "" || len(o.Value) > maxOptionValue {
+			return invalid("option value is required (up to %d bytes)", maxOptionValue)
+		}
+		if seen[o.Value] {
+			return invalid("duplicate option value %q", o.Value)
+		}
+		seen[o.Value] = true
+	}
+	if s.InitialOption != nil {
+		if _, ok := s.Option(s.InitialOption.Value); !ok {
+			return invalid("initial_option must be one of options")
+		}
+		if err := text(&s.InitialOption.Text, maxOptionText, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Option は value の選択肢を返す
+func (s *Select) Option(value string) (*Option, bool) {
+	for i := range s.Options {
+		if s.Options[i].Value == value {
+			return &s.Options[i], true
+		}
+	}
+	return nil, false
+}
+
+// FindAction は action_id の操作要素（button / static_select）と、それを含むブロックの block_id を返す
+func FindAction(blocks []Block, actionID string) (blockID string, e *Element, ok bool) {
+	match := func(e *Element) bool {
+		return e != nil && (e.Button != nil && e.Button.ActionID == actionID ||
+			e.Select != nil && e.Select.ActionID == actionID)
+	}
+	for i := range blocks {
+		b := &blocks[i]
+		if match(b.Accessory) {
+			return b.BlockID, b.Accessory, true
+		}
+		for j := range b.Elements {
+			if match(&b.Elements[j]) {
+				return b.BlockID, &b.Elements[j], true
+			}
+		}
+	}
+	return "", nil, false
+}
+
+func (v *blockValidator) button(b *Button) error {
+	if err := text(&b.Text, maxButtonText, true); err != nil {
+		return err
+	}
+	if err := v.actionID(b.ActionID); err != nil {
+		return err
+	}
+	if len(b.Value) > maxValue {
+		return invalid("button value too long")
+	}
+	if b.URL != "" {
+		if err := ValidateURL(b.URL); err != nil {
+			return err
+		}
+	}
+	if b.Style != "" && b.Style != "primary" && b.Style != "danger" {
+		return invalid("button style must be primary or danger")
+	}
+	return nil
+}
+
+// text はテキストを検証し、mrkdwn なら rich を作る。plainOnly なら plain_text だけ許す
+func text(t *TextObject, limit int, plainOnly bool) error {
+	switch t.Type {
+	case TextPlain:
+		t.Rich = nil
+	case TextMarkdown:
+		if plainOnly {
+			return invalid("mrkdwn is not allowed here")
+		}
+		t.Rich = Parse(t.Text)
+	default:
+		return invalid("text type must be plain_text or mrkdwn")
+	}
+	if t.Text == "" {
+		return invalid("text must not be empty")
+	}
+	if utf8.RuneCountInString(t.Text) > limit {
+		return invalid("text exceeds %d characters", limit)
+	}
+	if t.Rich != nil {
+		return Validate(t.Rich)
+	}
+	return nil
+}
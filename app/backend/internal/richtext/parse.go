@@ -0,0 +1,351 @@
+package richtext
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Parse は Slack 風 mrkdwn を AST にする。どんな入力でもエラーにはならない（解釈できない記号は文字のまま）。
+//
+//	*bold*  _italic_  ~strike~  `code`  ```lang 改行 コード ```
+//	> 引用   - 箇条書き   1. 番号付き
+//	<https://example.com|ラベル>  https://example.com  <@user_id>  <#channel_id|name>
+func Parse(src string) *Document {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	return &Document{Version: Version, Blocks: parseBlocks(strings.Split(src, "\n"), 0)}
+}
+
+var (
+	fenceLangRe = regexp.MustCompile("^```([A-Za-z0-9_+#.-]{1,32})$")
+	bulletRe    = regexp.MustCompile(`^([ \t]*)[-*•][ \t]+(.*)$`)
+	orderedRe   = regexp.MustCompile(`^([ \t]*)(\d{1,6})[.)][ \t]+(.*)$`)
+	quoteRe     = regexp.MustCompile(`^>[ \t]?(.*)$`)
+)
+
+func parseBlocks(lines []string, depth int) []Node {
+	var out []Node
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			out = append(out, paragraph(para))
+			para = nil
+		}
+	}
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			nodes, next := parseFence(lines, i)
+			out = append(out, nodes...)
+			i = next
+		case depth == 0 && quoteRe.MatchString(line):
+			// 引用の中の引用は作らない（Slack と同じく 1 段まで）
+			flush()
+			var q []string
+			for ; i < len(lines); i++ {
+				m := quoteRe.FindStringSubmatch(lines[i])
+				if m == nil {
+					break
+				}
+				q = append(q, m[1])
+			}
+			out = append(out, Node{Type: NodeQuote, Children: parseBlocks(q, depth+1)})
+		case bulletRe.MatchString(line) || orderedRe.MatchString(line):
+			flush()
+			node, next := parseList(lines, i)
+			out = append(out, node)
+			i = next
+		case trimmed == "":
+			flush()
+			i++
+		default:
+			para = append(para, line)
+			i++
+		}
+	}
+	flush()
+	return out
+}
+
+// parseFence は ``` から閉じの ``` までをコードにする。閉じが無ければ末尾まで
+func parseFence(lines []string, i int) ([]Node, int) {
+	first := strings.TrimSpace(lines[i])[3:]
+
+	// 1 行で閉じている ```code```
+	if j := strings.Index(first, "```"); j >= 0 {
+		nodes := []Node{{Type: NodeCodeBlock, Text: first[:j]}}
+		if rest := strings.TrimSpace(first[j+3:]); rest != "" {
+			nodes = append(nodes, paragraph([]string{rest}))
+		}
+		return nodes, i + 1
+	}
+
+	node := Node{Type: NodeCodeBlock}
+	var body []string
+	if m := fenceLangRe.FindStringSubmatch("```" + first); m != nil {
+		node.Lang = strings.ToLower(m[1])
+	} else if first != "" {
+		body = append(body, first) // ``` の直後から本文
+	}
+	i++
+	for ; i < len(lines); i++ {
+		t := strings.TrimRight(lines[i], " \t")
+		if strings.HasSuffix(t, "```") {
+			if before := strings.TrimSuffix(t, "```"); strings.TrimSpace(before) != "" {
+				body = append(body, before)
+			}
+			i++
+			break
+		}
+		body = append(body, lines[i])
+	}
+	node.Text = strings.Join(body, "\n")
+	return []Node{node}, i
+}
+
+func parseList(lines []string, i int) (Node, int) {
+	ordered := !bulletRe.MatchString(lines[i])
+	list := Node{Type: NodeList, Ordered: ordered}
+	for ; i < len(lines); i++ {
+		var indent, text string
+		if ordered {
+			m := orderedRe.FindStringSubmatch(lines[i])
+			if m == nil {
+				break
+			}
+			if len(list.Children) == 0 {
+				if n, _ := strconv.Atoi(m[2]); n != 1 {
+					list.Start = n
+				}
+			}
+			indent, text = m[1], m[3]
+		} else {
+			m := bulletRe.FindStringSubmatch(lines[i])
+			if m == nil {
+				break
+			}
+			indent, text = m[1], m[2]
+		}
+		list.Children = append(list.Children, Node{
+			Type:     NodeListItem,
+			Indent:   indentLevel(indent),
+			Children: parseInline(strings.TrimSpace(text), ""),
+		})
+	}
+	return list, i
+}
+
+// indentLevel は空白 2 つ（またはタブ 1 つ）で 1 段。最大 3
+func indentLevel(s string) int {
+	w := 0
+	for _, r := range s {
+		if r == '\t' {
+			w += 2
+		} else {
+			w++
+		}
+	}
+	return min(w/2, 3)
+}
+
+func paragraph(lines []string) Node {
+	p := Node{Type: NodeParagraph}
+	for i, l := range lines {
+		if i > 0 {
+			p.Children = append(p.Children, Node{Type: NodeLineBreak})
+		}
+		p.Children = append(p.Children, parseInline(strings.TrimRight(l, " \t"), "")...)
+	}
+	return p
+}
+
+var markerTypes = map[byte]string{'*': NodeBold, '_': NodeItalic, '~': NodeStrike}
+
+// maxAngle より長い <...> は書式にしない（URL の上限 + ラベル）
+const maxAngle = maxURL + 1000
+
+// 裸の URL として拾う書き出し
+var bareURLPrefixes = []string{"https://", "http://", "mailto:"}
+
+// parseInline は 1 行分のインライン要素。active は外側で使用中の記号（同じ記号の入れ子は作らない）。
+// 閉じ記号などの位置は先に indexInline で集めておき、開き記号ごとに残りを探し直さない（閉じていない記号が多くても線形）
+func parseInline(s, active string) []Node {
+	idx := indexInline(s)
+	var out []Node
+	var buf strings.Builder
+	flush := func() {
+		if buf.Len() > 0 {
+			out = append(out, Node{Type: NodeText, Text: buf.String()})
+			buf.Reset()
+		}
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch c {
+		case '`':
+			if j := idx.marks['`'].next(i + 1); j > i+1 {
+				flush()
+				out = append(out, Node{Type: NodeCode, Text: s[i+1 : j]})
+				i = j + 1
+				continue
+			}
+		case '<':
+			if end := idx.marks['>'].next(i); end > 0 && end-i-1 <= maxAngle {
+				if n, ok := parseAngle(s[i+1:end], active); ok {
+					flush()
+					out = append(out, n)
+					i = end + 1
+					continue
+				}
+			}
+		case '*', '_', '~':
+			if !strings.ContainsRune(active, rune(c)) && canOpen(s, i) {
+				if j := idx.marks[c].next(i + 2); j > 0 {
+					flush()
+					out = append(out, Node{Type: markerTypes[c], Children: parseInline(s[i+1:j], active+string(c))})
+					i = j + 1
+					continue
+				}
+			}
+		case 'h', 'm':
+			if i == 0 || !isWordByte(s[i-1]) {
+				// 書き出しから空白・< > の手前までが URL
+				end := idx.urlStops.next(i)
+				if end < 0 {
+					end = len(s)
+				}
+				if p := bareURLPrefix(s[i:end]); p > 0 && end-i > p {
+					u := strings.TrimRight(s[i:end], ".,;:!?)]}'\"")
+					if ValidateURL(u) == nil {
+						flush()
+						out = append(out, Node{Type: NodeLink, URL: u})
+						i += len(u)
+						continue
+					}
+				}
+			}
+		}
+		buf.WriteByte(c)
+		i++
+	}
+	flush()
+	return out
+}
+
+// parseAngle は <@id> / <#id|name> / <url|label> の <> の中身を読む
+func parseAngle(inner, active string) (Node, bool) {
+	switch {
+	case strings.HasPrefix(inner, "@"):
+		id, err := uuid.Parse(inner[1:])
+		if err != nil {
+			return Node{}, false
+		}
+		return Node{Type: NodeUserMention, UserID: &id}, true
+	case strings.HasPrefix(inner, "#"):
+		raw, name, _ := strings.Cut(inner[1:], "|")
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return Node{}, false
+		}
+		return Node{Type: NodeChannelMention, ChannelID: &id, Text: name}, true
+	}
+	target, label, _ := strings.Cut(inner, "|")
+	if ValidateURL(target) != nil {
+		return Node{}, false
+	}
+	n := Node{Type: NodeLink, URL: target}
+	if label != "" {
+		n.Children = parseInline(label, active)
+	}
+	return n, true
+}
+
+// canOpen: 記号の直後が空白でなく、直前が英数字でない（snake_case や 2*3*4 を書式にしない）
+func canOpen(s string, i int) bool {
+	if i+1 >= len(s) || isSpace(s[i+1]) || s[i+1] == s[i] {
+		return false
+	}
+	return i == 0 || !isWordByte(s[i-1])
+}
+
+// canClose: 閉じ記号になれるか。直前が空白でなく、直後が英数字でないもの
+func canClose(s string, j int) bool {
+	if j == 0 || isSpace(s[j-1]) {
+		return false
+	}
+	return j+1 >= len(s) || !isWordByte(s[j+1])
+}
+
+// positions は 1 行の中のある記号の位置（昇順）。next で前から順に使う
+type positions struct {
+	at []int
+	k  int
+}
+
+// next は from 以降で最初の位置（無ければ -1）。from は呼ぶたびに増えていくこと
+func (p *positions) next(from int) int {
+	if p == nil {
+		return -1
+	}
+	for p.k < len(p.at) && p.at[p.k] < from {
+		p.k++
+	}
+	if p.k == len(p.at) {
+		return -1
+	}
+	return p.at[p.k]
+}
+
+// inlineIndex は 1 行の中の記号の位置
+type inlineIndex struct {
+	marks    map[byte]*positions // 閉じになれる * _ ~ と、` >
+	urlStops positions           // 裸の URL の終わり（空白と < >）
+}
+
+// indexInline は s を 1 回走査して inlineIndex を作る
+func indexInline(s string) *inlineIndex {
+	idx := &inlineIndex{marks: map[byte]*positions{}}
+	for j := 0; j < len(s); j++ {
+		c := s[j]
+		switch c {
+		case ' ', '\t', '\n', '\f', '\r', '<':
+			idx.urlStops.at = append(idx.urlStops.at, j)
+			continue
+		case '>':
+			idx.urlStops.at = append(idx.urlStops.at, j)
+		case '*', '_', '~':
+			if !canClose(s, j) {
+				continue
+			}
+		case '`':
+		default:
+			continue
+		}
+		if idx.marks[c] == nil {
+			idx.marks[c] = &positions{}
+		}
+		idx.marks[c].at = append(idx.marks[c].at, j)
+	}
+	return idx
+}
+
+// bareURLPrefix は s が裸の URL の書き出しで始まればその長さ、でなければ 0
+func bareURLPrefix(s string) int {
+	for _, p := range bareURLPrefixes {
+		if strings.HasPrefix(s, p) {
+			return len(p)
+		}
+	}
+	return 0
+}
+
+func isSpace(b byte) bool { return b == ' ' || b == '\t' }
+
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9'
+}
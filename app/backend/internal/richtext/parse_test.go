@@ -0,0 +1,60 @@
+package richtext
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseInline(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want []Node
+	}{
+		{"bold", "*a* b", []Node{{Type: NodeBold, Children: []Node{{Type: NodeText, Text: "a"}}}, {Type: NodeText, Text: " b"}}},
+		{"snake_case", "a_b_c", []Node{{Type: NodeText, Text: "a_b_c"}}},
+		{"unclosed", "*a _b", []Node{{Type: NodeText, Text: "*a _b"}}},
+		{"code", "`*a*`", []Node{{Type: NodeCode, Text: "*a*"}}},
+		{"url", "see https://example.com/a.", []Node{{Type: NodeText, Text: "see "}, {Type: NodeLink, URL: "https://example.com/a"}, {Type: NodeText, Text: "."}}},
+		{"angle link", "<https://example.com|x>", []Node{{Type: NodeLink, URL: "https://example.com", Children: []Node{{Type: NodeText, Text: "x"}}}}},
+		{"angle unclosed", "<https://example.com", []Node{{Type: NodeText, Text: "<"}, {Type: NodeLink, URL: "https://example.com"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseInline(tt.in, "")
+			if !equalNodes(got, tt.want) {
+				t.Errorf("parseInline(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+// 閉じていない記号が並んでも本文の上限（40000 文字）で詰まらないこと
+func TestParsePathological(t *testing.T) {
+	const n = 40000
+	for _, unit := range []string{"*a ", "_a ", "~a ", "`", "<", "<@", "http://", "*_~`<"} {
+		s := strings.Repeat(unit, n/len(unit))
+		start := time.Now()
+		d := Parse(s)
+		if el := time.Since(start); el > 2*time.Second {
+			t.Errorf("Parse(%q x %d) took %v", unit, n/len(unit), el)
+		}
+		if len(d.Blocks) == 0 {
+			t.Errorf("Parse(%q x %d) returned no blocks", unit, n/len(unit))
+		}
+	}
+}
+
+func equalNodes(a, b []Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := a[i], b[i]
+		if x.Type != y.Type || x.Text != y.Text || x.URL != y.URL || !equalNodes(x.Children, y.Children) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,108 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	clamdChunk   = 64 << 10
+	clamdTimeout = 5 * time.Minute
+)
+
+// Clamd は clamd に INSTREAM で本文を送って調べる（TCP か unix ソケット）
+type Clamd struct {
+	Network string // tcp / unix
+	Address string
+	Timeout time.Duration // 1 ファイルの送信から結果までの上限
+}
+
+// NewClamd は tcp://host:port / unix:///path / host:port を受け付ける
+func NewClamd(addr string) (*Clamd, error) {
+	c := &Clamd{Network: "tcp", Address: addr, Timeout: clamdTimeout}
+	switch {
+	case strings.HasPrefix(addr, "tcp://"):
+		c.Address = strings.TrimPrefix(addr, "tcp://")
+	case strings.HasPrefix(addr, "unix://"):
+		c.Network, c.Address = "unix", strings.TrimPrefix(addr, "unix://")
+	}
+	if c.Address == "" {
+		return nil, errors.New("CLAMD_ADDRESS is required for SCAN_DRIVER=clamd")
+	}
+	return c, nil
+}
+
+func (c *Clamd) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	d := net.Dialer{Timeout: 10 * time.Second}
+	conn, err := d.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamd dial: %w", err)
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(c.Timeout)
+	if dl, ok := ctx.Deadline(); ok && dl.Before(deadline) {
+		deadline = dl
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return Result{}, err
+	}
+
+	// z 付きのコマンドは NUL 区切り。本文は「4 バイトの長さ（big endian）+ データ」を繰り返し、長さ 0 で終わる
+	werr := c.stream(conn, r)
+	reply, rerr := bufio.NewReader(conn).ReadString(0)
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	if reply == "" {
+		// 大きすぎて途中で切られたときなどは応答の方に理由がある
+		if werr != nil {
+			return Result{}, fmt.Errorf("clamd stream: %w", werr)
+		}
+		return Result{}, fmt.Errorf("clamd reply: %w", rerr)
+	}
+	return parseClamdReply(reply)
+}
+
+func (c *Clamd) stream(conn net.Conn, r io.Reader) error {
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+	buf := make([]byte, 4+clamdChunk)
+	for {
+		n, err := io.ReadFull(r, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			if _, werr := conn.Write(buf[:4+n]); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// parseClamdReply は "stream: OK" / "stream: <signature> FOUND" / "... ERROR" を読む。
+// StreamMaxLength を超えたときの "INSTREAM size limit exceeded. ERROR" は ErrTooLarge
+func parseClamdReply(reply string) (Result, error) {
+	body := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case body == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(body, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(body, " FOUND")}, nil
+	case strings.Contains(body, "size limit exceeded"):
+		return Result{}, fmt.Errorf("%w: %s", ErrTooLarge, reply)
+	}
+	return Result{}, fmt.Errorf("clamd: %s", reply)
+}
@@ -0,0 +1,51 @@
+// Package scan はアップロードされたファイルのウイルススキャン。
+// jobs.ScanFiles が complete 後のファイルを Scanner に通し、結果が出るまではダウンロード URL を出さない
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"slackgo/internal/config"
+)
+
+// Scanner は本文を読んで感染しているかを返す。判定できなかったときは error（後でやり直す）
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// ErrTooLarge はスキャナーの上限（clamd の StreamMaxLength など）を超えていて調べられなかった。やり直しても同じ
+var ErrTooLarge = errors.New("file is over the scanner's size limit")
+
+// Result はスキャン結果。Signature は検出したシグネチャ名（Infected のときだけ）
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+const (
+	DriverNone  = "none"
+	DriverClamd = "clamd"
+)
+
+// Noop は何も調べずにすべて clean とする（SCAN_DRIVER=none。開発用）
+type Noop struct{}
+
+func (Noop) Scan(context.Context, io.Reader) (Result, error) {
+	return Result{}, nil
+}
+
+// New は SCAN_DRIVER で選んだ Scanner を作る
+func New(c config.Config) (Scanner, error) {
+	switch c.ScanDriver {
+	case DriverNone, "":
+		log.Printf("[scan] SCAN_DRIVER=none: uploaded files are marked clean without scanning")
+		return Noop{}, nil
+	case DriverClamd:
+		return NewClamd(c.ClamdAddress)
+	}
+	return nil, fmt.Errorf("unknown SCAN_DRIVER %q (none | clamd)", c.ScanDriver)
+}
@@ -0,0 +1,531 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"slackgo/internal/config"
+)
+
+// --- ローカルディスクのストレージ（開発・オフライン・テスト用） ---
+// 署名 URL は API 自身の /storage/local/<key> を指す。クエリに有効期限と条件（Content-Type・長さ）を入れ、
+// HMAC-SHA256 で署名するので、S3 の署名 URL と同じく改ざん・期限切れ・申告と違う内容は受け付けない。
+//
+//	<root>/objects/<key>                 本体
+//	<root>/meta/<key>.json               Content-Type と ETag
+//	<root>/multipart/<upload_id>/        進行中のマルチパート（upload.json とパート <n> / <n>.etag）
+
+// LocalRoute は LocalStore の署名 URL を受けるルート（router で登録する）
+const LocalRoute = "/storage/local"
+
+const (
+	LocalOpPut  = "put"
+	LocalOpGet  = "get"
+	LocalOpPart = "part"
+)
+
+var (
+	ErrBadSignature = errors.New("invalid signature")
+	ErrURLExpired   = errors.New("signed url expired")
+	ErrSizeMismatch = errors.New("body length does not match the signed length")
+	errBadKey       = errors.New("invalid storage key")
+)
+
+type LocalStore struct {
+	root    string
+	baseURL string // 例: http://localhost:8000/storage/local
+	secret  []byte
+	prefix  string
+	expire  time.Duration
+}
+
+var _ Store = (*LocalStore)(nil)
+
+func NewLocalStore(c config.Config) (*LocalStore, error) {
+	// 署名 URL の鍵。認証の鍵（JWT_SECRET）とは分ける
+	if len(c.LocalStorageSecret) < config.MinSecretBytes {
+		return nil, fmt.Errorf("LOCAL_STORAGE_SECRET of at least %d bytes is required for STORAGE_DRIVER=local", config.MinSecretBytes)
+	}
+	root, err := filepath.Abs(c.LocalStorageDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range []string{"objects", "meta", "multipart"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0o755); err != nil {
+			return nil, err
+		}
+	}
+	return &LocalStore{
+		root:    root,
+		baseURL: c.APIPublicURL + LocalRoute,
+		secret:  []byte(c.LocalStorageSecret),
+		prefix:  c.S3Prefix,
+		expire:  time.Duration(c.S3URLExpirySec) * time.Second,
+	}, nil
+}
+
+func (s *LocalStore) Expiry() time.Duration { return s.expire }
+func (s *LocalStore) KeyPrefix() string     { return s.prefix }
+
+// ---- 署名 ----
+
+// LocalGrant は検証済みの署名 URL が許す操作
+type LocalGrant struct {
+	Op          string
+	ContentType string // put: 付けるべき Content-Type / get: 返す Content-Type
+	Length      int64  // put / part: 本文の長さ
+	Disposition string // get: Content-Disposition
+	UploadID    string // part
+	PartNumber  int32  // part
+}
+
+func (s *LocalStore) mac(key string, q url.Values) string {
+	m := hmac.New(sha256.New, s.secret)
+	m.Write([]byte(key + "\n" + q.Encode()))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+func (s *LocalStore) signURL(key string, q url.Values) string {
+	q.Set("exp", strconv.FormatInt(time.Now().Add(s.expire).Unix(), 10))
+	q.Set("sig", s.mac(key, q))
+	return s.baseURL + (&url.URL{Path: "/" + key}).EscapedPath() + "?" + q.Encode()
+}
+
+// Verify は署名 URL のクエリを確かめて、許された操作を返す
+func (s *LocalStore) Verify(key string, q url.Values) (*LocalGrant, error) {
+	rest := url.Values{}
+	for k, v := range q {
+		if k != "sig" {
+			rest[k] = v
+		}
+	}
+	if !hmac.Equal([]byte(q.Get("sig")), []byte(s.mac(key, rest))) {
+		return nil, ErrBadSignature
+	}
+	exp, err := strconv.ParseInt(q.Get("exp"), 10, 64)
+	if err != nil {
+		return nil, ErrBadSignature
+	}
+	if time.Now().Unix() > exp {
+		return nil, ErrURLExpired
+	}
+	g := &LocalGrant{
+		Op:          q.Get("op"),
+		ContentType: q.Get("ct"),
+		Disposition: q.Get("cd"),
+		UploadID:    q.Get("upload_id"),
+	}
+	if v := q.Get("len"); v != "" {
+		if g.Length, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return nil, ErrBadSignature
+		}
+	}
+	if v := q.Get("part"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return nil, ErrBadSignature
+		}
+		g.PartNumber = int32(n)
+	}
+	return g, nil
+}
+
+func (s *LocalStore) SignUpload(_ context.Context, storageKey, contentType string, size int64) (SignedUpload, error) {
+	q := url.Values{"op": {LocalOpPut}, "len": {strconv.FormatInt(size, 10)}}
+	headers := map[string]string{"Content-Length": strconv.FormatInt(size, 10)}
+	if contentType != "" {
+		q.Set("ct", contentType)
+		headers["Content-Type"] = contentType
+	}
+	return SignedUpload{URL: s.signURL(storageKey, q), Headers: headers}, nil
+}
+
+func (s *LocalStore) SignDownload(_ context.Context, storageKey, filename, contentType, disposition string) (string, error) {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	q := url.Values{
+		"op": {LocalOpGet},
+		"ct": {contentType},
+		"cd": {fmt.Sprintf(`%s; filename="%s"`, disposition, url.PathEscape(filename))},
+	}
+	return s.signURL(storageKey, q), nil
+}
+
+// ---- オブジェクト ----
+
+type localMeta struct {
+	ContentType string `json:"content_type"`
+	ETag        string `json:"etag"`
+}
+
+// objectPath は key をディスク上のパスにする（.. で root の外へ出られないように）
+func (s *LocalStore) objectPath(dir, key, suffix string) (string, error) {
+	clean := path.Clean("/" + key)
+	if clean == "/" || key == "" {
+		return "", errBadKey
+	}
+	return filepath.Join(s.root, dir, filepath.FromSlash(clean)) + suffix, nil
+}
+
+// WriteObject は本文を書き込む（一時ファイルに書いてから置き換える）。長さが size と違えば ErrSizeMismatch
+func (s *LocalStore) WriteObject(storageKey, contentType string, r io.Reader, size int64) (string, error) {
+	p, err := s.objectPath("objects", storageKey, "")
+	if err != nil {
+		return "", err
+	}
+	h := md5.New()
+	if err := writeFile(p, io.TeeReader(r, h), size); err != nil {
+		return "", err
+	}
+	etag := hex.EncodeToString(h.Sum(nil))
+	return etag, s.writeMeta(storageKey, localMeta{ContentType: contentType, ETag: etag})
+}
+
+func (s *LocalStore) writeMeta(storageKey string, m localMeta) error {
+	p, err := s.objectPath("meta", storageKey, ".json")
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return writeFile(p, bytes.NewReader(raw), int64(len(raw)))
+}
+
+// writeFile は r をちょうど size バイト書く（size < 0 なら長さを問わない）
+func writeFile(p string, r io.Reader, size int64) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	src := r
+	if size >= 0 {
+		src = io.LimitReader(r, size+1)
+	}
+	n, err := io.Copy(tmp, src)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if size >= 0 && n != size {
+		return ErrSizeMismatch
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Open は本文と属性を返す（呼び出し側で Close する）。無ければ ErrNotFound
+func (s *LocalStore) Open(storageKey string) (*os.File, *ObjectInfo, error) {
+	p, err := s.objectPath("objects", storageKey, "")
+	if err != nil {
+		return nil, nil, ErrNotFound
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := s.info(storageKey, f)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+func (s *LocalStore) info(storageKey string, f *os.File) (*ObjectInfo, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		return nil, ErrNotFound
+	}
+	info := &ObjectInfo{SizeBytes: st.Size()}
+	mp, _ := s.objectPath("meta", storageKey, ".json")
+	if raw, err := os.ReadFile(mp); err == nil {
+		var m localMeta
+		if json.Unmarshal(raw, &m) == nil {
+			info.ETag, info.ContentType = m.ETag, m.ContentType
+		}
+	}
+	return info, nil
+}
+
+func (s *LocalStore) Head(_ context.Context, storageKey string) (*ObjectInfo, error) {
+	f, info, err := s.Open(storageKey)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return info, nil
+}
+
+func (s *LocalStore) Delete(_ context.Context, storageKey string) error {
+	for _, d := range []struct{ dir, suffix string }{{"objects", ""}, {"meta", ".json"}} {
+		p, err := s.objectPath(d.dir, storageKey, d.suffix)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *LocalStore) Copy(ctx context.Context, srcKey, dstKey string) error {
+	f, info, err := s.Open(srcKey)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = s.WriteObject(dstKey, info.ContentType, f, info.SizeBytes)
+	return err
+}
+
+func (s *LocalStore) Get(_ context.Context, storageKey string, maxBytes int64) ([]byte, error) {
+	f, info, err := s.Open(storageKey)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if info.SizeBytes > maxBytes {
+		return nil, ErrObjectTooLarge
+	}
+	return io.ReadAll(f)
+}
+
+func (s *LocalStore) Reader(_ context.Context, storageKey string) (io.ReadCloser, error) {
+	f, _, err := s.Open(storageKey)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (s *LocalStore) Put(_ context.Context, storageKey, contentType string, data []byte) (string, error) {
+	return s.WriteObject(storageKey, contentType, bytes.NewReader(data), int64(len(data)))
+}
+
+// ---- マルチパート ----
+
+type localUpload struct {
+	Key         string    `json:"key"`
+	ContentType string    `json:"content_type"`
+	Initiated   time.Time `json:"initiated"`
+}
+
+var uploadIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+func (s *LocalStore) uploadDir(uploadID string) (string, error) {
+	if !uploadIDPattern.MatchString(uploadID) {
+		return "", ErrNotFound
+	}
+	return filepath.Join(s.root, "multipart", uploadID), nil
+}
+
+// loadUpload は進行中のアップロード。key が違うものは無いものとして扱う
+func (s *LocalStore) loadUpload(storageKey, uploadID string) (string, *localUpload, error) {
+	dir, err := s.uploadDir(uploadID)
+	if err != nil {
+		return "", nil, err
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, "upload.json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil, ErrNotFound
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	var u localUpload
+	if err := json.Unmarshal(raw, &u); err != nil {
+		return "", nil, err
+	}
+	if storageKey != "" && u.Key != storageKey {
+		return "", nil, ErrNotFound
+	}
+	return dir, &u, nil
+}
+
+func (s *LocalStore) CreateMultipart(_ context.Context, storageKey, contentType string) (string, error) {
+	if _, err := s.objectPath("objects", storageKey, ""); err != nil {
+		return "", err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	uploadID := hex.EncodeToString(b)
+	dir, _ := s.uploadDir(uploadID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	raw, err := json.Marshal(localUpload{Key: storageKey, ContentType: contentType, Initiated: time.Now()})
+	if err != nil {
+		return "", err
+	}
+	return uploadID, writeFile(filepath.Join(dir, "upload.json"), bytes.NewReader(raw), int64(len(raw)))
+}
+
+func (s *LocalStore) PresignPart(_ context.Context, storageKey, uploadID string, n int32, length int64) (PresignedPart, error) {
+	q := url.Values{
+		"op":        {LocalOpPart},
+		"upload_id": {uploadID},
+		"part":      {strconv.Itoa(int(n))},
+		"len":       {strconv.FormatInt(length, 10)},
+	}
+	return PresignedPart{
+		PartNumber: n,
+		URL:        s.signURL(storageKey, q),
+		Headers:    map[string]string{"Content-Length": strconv.FormatInt(length, 10)},
+	}, nil
+}
+
+// WritePart はパートを書き込んで ETag（MD5）を返す
+func (s *LocalStore) WritePart(storageKey, uploadID string, n int32, r io.Reader, size int64) (string, error) {
+	dir, _, err := s.loadUpload(storageKey, uploadID)
+	if err != nil {
+		return "", err
+	}
+	h := md5.New()
+	name := filepath.Join(dir, strconv.Itoa(int(n)))
+	if err := writeFile(name, io.TeeReader(r, h), size); err != nil {
+		return "", err
+	}
+	etag := hex.EncodeToString(h.Sum(nil))
+	return etag, writeFile(name+".etag", strings.NewReader(etag), int64(len(etag)))
+}
+
+func (s *LocalStore) ListParts(_ context.Context, storageKey, uploadID string) ([]Part, error) {
+	dir, _, err := s.loadUpload(storageKey, uploadID)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var parts []Part
+	for _, e := range entries {
+		n, err := strconv.ParseInt(e.Name(), 10, 32)
+		if err != nil {
+			continue // upload.json / *.etag / 一時ファイル
+		}
+		st, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+		etag, err := os.ReadFile(filepath.Join(dir, e.Name()+".etag"))
+		if err != nil {
+			continue // 書き込み途中
+		}
+		parts = append(parts, Part{PartNumber: int32(n), ETag: string(etag), SizeBytes: st.Size()})
+	}
+	slices.SortFunc(parts, func(a, b Part) int { return int(a.PartNumber - b.PartNumber) })
+	return parts, nil
+}
+
+// CompleteMultipart はパートを番号順につなぐ。ETag は S3 と同じく「各パートの MD5 をつないだ MD5-パート数」
+func (s *LocalStore) CompleteMultipart(ctx context.Context, storageKey, uploadID string, parts []Part) error {
+	dir, u, err := s.loadUpload(storageKey, uploadID)
+	if err != nil {
+		return err
+	}
+	have, err := s.ListParts(ctx, storageKey, uploadID)
+	if err != nil {
+		return err
+	}
+	etags := map[int32]string{}
+	for _, p := range have {
+		etags[p.PartNumber] = p.ETag
+	}
+	sorted := slices.Clone(parts)
+	slices.SortFunc(sorted, func(a, b Part) int { return int(a.PartNumber - b.PartNumber) })
+
+	readers := make([]io.Reader, 0, len(sorted))
+	sums := md5.New()
+	for _, p := range sorted {
+		etag, ok := etags[p.PartNumber]
+		if !ok || etag != strings.Trim(p.ETag, `"`) {
+			return fmt.Errorf("part %d is missing or its etag does not match", p.PartNumber)
+		}
+		f, err := os.Open(filepath.Join(dir, strconv.Itoa(int(p.PartNumber))))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		readers = append(readers, f)
+		b, _ := hex.DecodeString(etag)
+		sums.Write(b)
+	}
+	p, err := s.objectPath("objects", storageKey, "")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(p, io.MultiReader(readers...), -1); err != nil {
+		return err
+	}
+	etag := fmt.Sprintf("%s-%d", hex.EncodeToString(sums.Sum(nil)), len(sorted))
+	if err := s.writeMeta(storageKey, localMeta{ContentType: u.ContentType, ETag: etag}); err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (s *LocalStore) AbortMultipart(_ context.Context, storageKey, uploadID string) error {
+	dir, _, err := s.loadUpload(storageKey, uploadID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (s *LocalStore) ListMultipartUploads(_ context.Context, prefix string) ([]MultipartUpload, error) {
+	entries, err := os.ReadDir(filepath.Join(s.root, "multipart"))
+	if err != nil {
+		return nil, err
+	}
+	var out []MultipartUpload
+	for _, e := range entries {
+		_, u, err := s.loadUpload("", e.Name())
+		if err != nil {
+			continue
+		}
+		if strings.HasPrefix(u.Key, prefix) {
+			out = append(out, MultipartUpload{Key: u.Key, UploadID: e.Name(), Initiated: u.Initiated})
+		}
+	}
+	return out, nil
+}
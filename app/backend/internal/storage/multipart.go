@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// --- マルチパートアップロード（大きなファイル用） ---
+// パートごとに署名 URL を発行し、ブラウザが並列・再試行しながら PUT する
+
+const (
+	MinPartSize     = 5 << 20  // S3 の下限（最後のパート以外）
+	DefaultPartSize = 16 << 20 // 既定のパートサイズ
+	MaxParts        = 10000
+)
+
+// PartSizeFor は size を MaxParts 以内に収めるパートサイズ（MiB 単位に切り上げ）
+func PartSizeFor(size int64) int64 {
+	ps := int64(DefaultPartSize)
+	if need := (size + MaxParts - 1) / MaxParts; need > ps {
+		ps = (need + (1 << 20) - 1) &^ ((1 << 20) - 1)
+	}
+	return ps
+}
+
+// PartCount はパート数。PartLength はそのパートの長さ（最後だけ短い）
+func PartCount(size, partSize int64) int32 {
+	return int32((size + partSize - 1) / partSize)
+}
+
+func PartLength(size, partSize int64, n int32) int64 {
+	start := int64(n-1) * partSize
+	return min(partSize, size-start)
+}
+
+// Part はアップロード済み（または complete に渡す）パート
+type Part struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+	SizeBytes  int64  `json:"size_bytes,omitempty"`
+}
+
+// PresignedPart はパートの PUT 先。Headers はそのまま付ける（Content-Length が署名に入っている）
+type PresignedPart struct {
+	PartNumber int32             `json:"part_number"`
+	URL        string            `json:"url"`
+	Headers    map[string]string `json:"headers"`
+}
+
+// MultipartUpload は進行中のマルチパートアップロード（janitor 用）
+type MultipartUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+}
+
+func (s *S3Deps) CreateMultipart(ctx context.Context, storageKey, contentType string) (string, error) {
+	in := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(storageKey),
+	}
+	if contentType != "" {
+		in.ContentType = aws.String(contentType)
+	}
+	out, err := s.Client.CreateMultipartUpload(ctx, in)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+// PresignPart は 1 パート分の PUT を署名する（長さも署名に含める）
+func (s *S3Deps) PresignPart(ctx context.Context, storageKey, uploadID string, n int32, length int64) (PresignedPart, error) {
+	out, err := s.Presign.PresignUploadPart(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(s.Bucket),
+		Key:           aws.String(storageKey),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int32(n),
+		ContentLength: aws.Int64(length),
+	}, func(o *s3.PresignOptions) { o.Expires = s.Expire })
+	if err != nil {
+		return PresignedPart{}, err
+	}
+	return PresignedPart{PartNumber: n, URL: out.URL, Headers: ClientHeaders(out.SignedHeader)}, nil
+}
+
+// ClientHeaders は署名済みヘッダのうちクライアントが付けるもの（Host は除く）
+func ClientHeaders(h http.Header) map[string]string {
+	out := map[string]string{}
+	for k, v := range h {
+		if !strings.EqualFold(k, "host") && len(v) > 0 {
+			out[k] = v[0]
+		}
+	}
+	return out
+}
+
+// ListParts はアップロード済みのパート（再開用）。無いアップロードは ErrNotFound
+func (s *S3Deps) ListParts(ctx context.Context, storageKey, uploadID string) ([]Part, error) {
+	var parts []Part
+	p := s3.NewListPartsPaginator(s.Client, &s3.ListPartsInput{
+		Bucket:   aws.String(s.Bucket),
+		Key:      aws.String(storageKey),
+		UploadId: aws.String(uploadID),
+	})
+	for p.HasMorePages() {
+		out, err := p.NextPage(ctx)
+		if err != nil {
+			if isNotFound(err) {
+				return nil, ErrNotFound
+			}
+			return nil, err
+		}
+		for _, pt := range out.Parts {
+			parts = append(parts, Part{
+				PartNumber: aws.ToInt32(pt.PartNumber),
+				ETag:       strings.Trim(aws.ToString(pt.ETag), `"`),
+				SizeBytes:  aws.ToInt64(pt.Size),
+			})
+		}
+	}
+	return parts, nil
+}
+
+// CompleteMultipart はパートを番号順につなげてオブジェクトにする
+func (s *S3Deps) CompleteMultipart(ctx context.Context, storageKey, uploadID string, parts []Part) error {
+	sorted := slices.Clone(parts)
+	slices.SortFunc(sorted, func(a, b Part) int { return int(a.PartNumber - b.PartNumber) })
+	completed := make([]types.CompletedPart, 0, len(sorted))
+	for _, p := range sorted {
+		completed = append(completed, types.CompletedPart{
+			PartNumber: aws.Int32(p.PartNumber),
+			ETag:       aws.String(`"` + strings.Trim(p.ETag, `"`) + `"`),
+		})
+	}
+	_, err := s.Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(s.Bucket),
+		Key:             aws.String(storageKey),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil && isNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// AbortMultipart はアップロード済みのパートを捨てる（既に無ければ何もしない）
+func (s *S3Deps) AbortMultipart(ctx context.Context, storageKey, uploadID string) error {
+	_, err := s.Client.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(s.Bucket),
+		Key:      aws.String(storageKey),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// ListMultipartUploads は prefix 配下で進行中のマルチパートアップロード
+func (s *S3Deps) ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error) {
+	var out []MultipartUpload
+	in := &s3.ListMultipartUploadsInput{Bucket: aws.String(s.Bucket), Prefix: aws.String(prefix)}
+	for {
+		page, err := s.Client.ListMultipartUploads(ctx, in)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range page.Uploads {
+			out = append(out, MultipartUpload{
+				Key:       aws.ToString(u.Key),
+				UploadID:  aws.ToString(u.UploadId),
+				Initiated: aws.ToTime(u.Initiated),
+			})
+		}
+		if !aws.ToBool(page.IsTruncated) {
+			return out, nil
+		}
+		in.KeyMarker, in.UploadIdMarker = page.NextKeyMarker, page.NextUploadIdMarker
+	}
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"errors"
+	"mime"
+	"strings"
+
+	"slackgo/internal/config"
+)
+
+// Limit は用途（purpose）ごとのアップロード制限
+type Limit struct {
+	MaxBytes     int64
+	AllowedTypes []string // "image/png" や "image/*"。空なら何でも可
+}
+
+// UploadPolicy はアップロードの制限一式。署名時と complete 時の両方で使う
+type UploadPolicy struct {
+	Limits map[string]Limit // purpose -> 制限
+	// WorkspaceQuota はワークスペースごとの既定の容量（バイト）。0 は無制限。
+	// workspaces.storage_quota_bytes があればそちらを優先する
+	WorkspaceQuota int64
+	// ServeUnscanned は大きすぎてスキャンしなかった（unscanned の）ファイルもダウンロードさせるか
+	ServeUnscanned bool
+}
+
+var (
+	ErrSizeRequired    = errors.New("size_bytes is required")
+	ErrTooLarge        = errors.New("file is too large")
+	ErrUnsupportedType = errors.New("content type is not allowed")
+	ErrUnknownPurpose  = errors.New("unknown purpose")
+)
+
+func NewUploadPolicy(c config.Config) UploadPolicy {
+	return UploadPolicy{
+		Limits: map[string]Limit{
+			"message_attachment": {MaxBytes: c.UploadMaxBytes, AllowedTypes: splitTypes(c.UploadAllowedTypes)},
+			"avatar":             {MaxBytes: c.AvatarMaxBytes, AllowedTypes: splitTypes(c.AvatarAllowedTypes)},
+		},
+		WorkspaceQuota: c.WorkspaceStorageQuota,
+		ServeUnscanned: c.ScanServeUnscanned,
+	}
+}
+
+func splitTypes(s string) []string {
+	var out []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// Check は申告（または実際）のサイズと Content-Type が purpose の制限内か
+func (p UploadPolicy) Check(purpose string, size int64, contentType string) error {
+	l, ok := p.Limits[purpose]
+	if !ok {
+		return ErrUnknownPurpose
+	}
+	if size <= 0 {
+		return ErrSizeRequired
+	}
+	if l.MaxBytes > 0 && size > l.MaxBytes {
+		return ErrTooLarge
+	}
+	if !l.Allows(contentType) {
+		return ErrUnsupportedType
+	}
+	return nil
+}
+
+// Allows は Content-Type（パラメータは無視）が許可リストに入っているか
+func (l Limit) Allows(contentType string) bool {
+	if len(l.AllowedTypes) == 0 {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, a := range l.AllowedTypes {
+		if a == mt || strings.HasSuffix(a, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+	return false
+}
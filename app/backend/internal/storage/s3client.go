@@ -2,9 +2,14 @@
 package storage
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"slackgo/internal/config"
@@ -76,7 +81,26 @@ func NewS3Deps(ctx context.Context, c config.Config) (*S3Deps, error) {
 	}, nil
 }
 
-func (s *S3Deps) SignGetURL(
+var _ Store = (*S3Deps)(nil)
+
+// SignUpload は PUT を署名する。Content-Type と Content-Length が署名に入るので、申告と違う内容は S3 が受け付けない
+func (s *S3Deps) SignUpload(ctx context.Context, storageKey, contentType string, size int64) (SignedUpload, error) {
+	in := &s3.PutObjectInput{
+		Bucket:        aws.String(s.Bucket),
+		Key:           aws.String(storageKey),
+		ContentLength: aws.Int64(size),
+	}
+	if contentType != "" {
+		in.ContentType = aws.String(contentType)
+	}
+	out, err := s.Presign.PresignPutObject(ctx, in, func(o *s3.PresignOptions) { o.Expires = s.Expire })
+	if err != nil {
+		return SignedUpload{}, err
+	}
+	return SignedUpload{URL: out.URL, Headers: ClientHeaders(out.SignedHeader)}, nil
+}
+
+func (s *S3Deps) SignDownload(
 	ctx context.Context,
 	storageKey string,
 	filename string,
@@ -105,3 +129,122 @@ func (s *S3Deps) SignGetURL(
 }
 
 func (s *S3Deps) Expiry() time.Duration { return s.Expire }
+func (s *S3Deps) KeyPrefix() string     { return s.Prefix }
+
+// ErrNotFound はオブジェクトが存在しない
+var ErrNotFound = errors.New("object not found")
+
+// ObjectInfo は HEAD で分かるオブジェクトの実際の属性
+type ObjectInfo struct {
+	SizeBytes   int64
+	ETag        string // 前後の " は外す
+	ContentType string
+}
+
+// Head はオブジェクトの実サイズ・ETag・Content-Type を返す。無ければ ErrNotFound
+func (s *S3Deps) Head(ctx context.Context, storageKey string) (*ObjectInfo, error) {
+	out, err := s.Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(storageKey),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &ObjectInfo{
+		SizeBytes:   aws.ToInt64(out.ContentLength),
+		ETag:        strings.Trim(aws.ToString(out.ETag), `"`),
+		ContentType: aws.ToString(out.ContentType),
+	}, nil
+}
+
+// Delete はオブジェクトを消す（無くてもエラーにしない）
+func (s *S3Deps) Delete(ctx context.Context, storageKey string) error {
+	_, err := s.Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(storageKey),
+	})
+	if err != nil && !isNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// Copy はバケット内でオブジェクトを複製する（5GB まで）
+func (s *S3Deps) Copy(ctx context.Context, srcKey, dstKey string) error {
+	_, err := s.Client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:     aws.String(s.Bucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String((&url.URL{Path: s.Bucket + "/" + srcKey}).EscapedPath()), // / は残してエスケープ
+	})
+	if err != nil && isNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// isNotFound: HEAD の 404 は本文が無いので、エラー型ではなくステータスで判定する
+func isNotFound(err error) bool {
+	var re interface{ HTTPStatusCode() int }
+	return errors.As(err, &re) && re.HTTPStatusCode() == http.StatusNotFound
+}
+
+// ErrObjectTooLarge は Get の上限を超えた
+var ErrObjectTooLarge = errors.New("object is larger than the limit")
+
+// Get はオブジェクトを読み込む（maxBytes を超えるものは読まない）
+func (s *S3Deps) Get(ctx context.Context, storageKey string, maxBytes int64) ([]byte, error) {
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(storageKey),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	defer out.Body.Close()
+	if aws.ToInt64(out.ContentLength) > maxBytes {
+		return nil, ErrObjectTooLarge
+	}
+	data, err := io.ReadAll(io.LimitReader(out.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, ErrObjectTooLarge
+	}
+	return data, nil
+}
+
+func (s *S3Deps) Reader(ctx context.Context, storageKey string) (io.ReadCloser, error) {
+	out, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(storageKey),
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+// Put はサーバー側で作ったオブジェクト（サムネイルなど）を書き込み、ETag を返す
+func (s *S3Deps) Put(ctx context.Context, storageKey, contentType string, data []byte) (string, error) {
+	out, err := s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.Bucket),
+		Key:           aws.String(storageKey),
+		Body:          bytes.NewReader(data),
+		ContentLength: aws.Int64(int64(len(data))),
+		ContentType:   aws.String(contentType),
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(aws.ToString(out.ETag), `"`), nil
+}
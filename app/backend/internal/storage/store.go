@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"slackgo/internal/config"
+)
+
+// Store はファイル本体を置くオブジェクトストレージ。
+// S3（MinIO を含む）の S3Deps と、API 自身が署名付き URL を受けるローカルディスクの LocalStore がある
+type Store interface {
+	// SignUpload は PUT の署名 URL。Content-Type と長さを署名に含める（返る Headers をそのまま付けて PUT する）
+	SignUpload(ctx context.Context, storageKey, contentType string, size int64) (SignedUpload, error)
+	// SignDownload は GET の署名 URL。disposition は inline / attachment
+	SignDownload(ctx context.Context, storageKey, filename, contentType, disposition string) (string, error)
+	Head(ctx context.Context, storageKey string) (*ObjectInfo, error)
+	Delete(ctx context.Context, storageKey string) error
+	Copy(ctx context.Context, srcKey, dstKey string) error
+	Get(ctx context.Context, storageKey string, maxBytes int64) ([]byte, error)
+	// Reader は本文を順に読む（大きなオブジェクトのハッシュ計算など）。呼び出し側で Close する
+	Reader(ctx context.Context, storageKey string) (io.ReadCloser, error)
+	Put(ctx context.Context, storageKey, contentType string, data []byte) (string, error)
+
+	Multipart
+
+	// KeyPrefix はこのアプリのオブジェクトを置く先頭のパス。Expiry は署名 URL の有効期間
+	KeyPrefix() string
+	Expiry() time.Duration
+}
+
+// Multipart は大きなファイルのマルチパートアップロード
+type Multipart interface {
+	CreateMultipart(ctx context.Context, storageKey, contentType string) (string, error)
+	PresignPart(ctx context.Context, storageKey, uploadID string, n int32, length int64) (PresignedPart, error)
+	ListParts(ctx context.Context, storageKey, uploadID string) ([]Part, error)
+	CompleteMultipart(ctx context.Context, storageKey, uploadID string, parts []Part) error
+	AbortMultipart(ctx context.Context, storageKey, uploadID string) error
+	ListMultipartUploads(ctx context.Context, prefix string) ([]MultipartUpload, error)
+}
+
+// SignedUpload は PUT 先と、PUT に付けるヘッダ
+type SignedUpload struct {
+	URL     string
+	Headers map[string]string
+}
+
+// HashObject はオブジェクトの SHA-256（16 進）を読みながら計算する
+func HashObject(ctx context.Context, s Store, storageKey string) (string, error) {
+	r, err := s.Reader(ctx, storageKey)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+const (
+	DriverS3    = "s3"
+	DriverLocal = "local"
+)
+
+// New は STORAGE_DRIVER で選んだ Store を作る
+func New(ctx context.Context, c config.Config) (Store, error) {
+	switch c.StorageDriver {
+	case DriverS3, "":
+		s, err := NewS3Deps(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if s.Bucket == "" {
+			return nil, fmt.Errorf("S3_BUCKET is required for STORAGE_DRIVER=s3")
+		}
+		return s, nil
+	case DriverLocal:
+		log.Printf("[storage] STORAGE_DRIVER=local: files are kept under %s and served by this API", c.LocalStorageDir)
+		return NewLocalStore(c)
+	}
+	return nil, fmt.Errorf("unknown STORAGE_DRIVER %q (s3 | local)", c.StorageDriver)
+}
@@ -6,13 +6,27 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// ルーム名。チャンネルはチャンネルIDそのまま、WS全体向けは "ws:<id>"、個人宛は "user:<id>"
+func WorkspaceRoom(workspaceID string) string { return "ws:" + workspaceID }
+func UserRoom(userID string) string           { return "user:" + userID }
+
+// client は1接続。gorilla/websocket は同時書き込み不可なので接続ごとにロックする
+type client struct {
+	mu    sync.Mutex
+	rooms int
+}
+
 type Hub struct {
 	mu       sync.RWMutex
 	channels map[string]map[*websocket.Conn]struct{}
+	clients  map[*websocket.Conn]*client
 }
 
 func NewHub() *Hub {
-	return &Hub{channels: map[string]map[*websocket.Conn]struct{}{}}
+	return &Hub{
+		channels: map[string]map[*websocket.Conn]struct{}{},
+		clients:  map[*websocket.Conn]*client{},
+	}
 }
 
 func (h *Hub) Join(channel string, conn *websocket.Conn) {
@@ -21,19 +35,69 @@ func (h *Hub) Join(channel string, conn *websocket.Conn) {
 	if h.channels[channel] == nil {
 		h.channels[channel] = map[*websocket.Conn]struct{}{}
 	}
+	if _, ok := h.channels[channel][conn]; ok {
+		return
+	}
 	h.channels[channel][conn] = struct{}{}
+	cl := h.clients[conn]
+	if cl == nil {
+		cl = &client{}
+		h.clients[conn] = cl
+	}
+	cl.rooms++
 }
 
 func (h *Hub) Leave(channel string, conn *websocket.Conn) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
+	if _, ok := h.channels[channel][conn]; !ok {
+		return
+	}
 	delete(h.channels[channel], conn)
+	if len(h.channels[channel]) == 0 {
+		delete(h.channels, channel)
+	}
+	if cl := h.clients[conn]; cl != nil {
+		cl.rooms--
+		if cl.rooms <= 0 {
+			delete(h.clients, conn)
+		}
+	}
 }
 
-func (h *Hub) Broadcast(channel string, payload []byte) {
+// Broadcast は channel のルームに居る全接続に送る。送った接続数を返す
+func (h *Hub) Broadcast(channel string, payload []byte) int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	for c := range h.channels[channel] {
-		_ = c.WriteMessage(websocket.TextMessage, payload)
+		h.write(c, payload)
+	}
+	return len(h.channels[channel])
+}
+
+// BroadcastToUser は channel と userID の個人宛ルームの両方に居る接続（＝そのユーザーがそのチャンネルを開いている接続）だけに送る。
+// ephemeral メッセージ用。送った接続数を返す
+func (h *Hub) BroadcastToUser(channel, userID string, payload []byte) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	mine := h.channels[UserRoom(userID)]
+	n := 0
+	for c := range h.channels[channel] {
+		if _, ok := mine[c]; ok {
+			h.write(c, payload)
+			n++
+		}
+	}
+	return n
+}
+
+// write は h.mu（読み取り）保持中に呼ぶ
+func (h *Hub) write(conn *websocket.Conn, payload []byte) {
+	cl := h.clients[conn]
+	if cl == nil {
+		return
 	}
+	cl.mu.Lock()
+	_ = conn.WriteMessage(websocket.TextMessage, payload)
+	cl.mu.Unlock()
 }